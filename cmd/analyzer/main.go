@@ -5,6 +5,7 @@ import (
     "flag"
     "fmt"
     "math"
+    "math/rand"
     "os"
     "strconv"
     "time"
@@ -14,7 +15,9 @@ import (
     "gonum.org/v1/plot/plotutil"
     "gonum.org/v1/plot/vg"
 
+    "antifraude/internal/data"
     "antifraude/internal/features"
+    "antifraude/internal/fx"
     "antifraude/internal/models"
 )
 
@@ -28,20 +31,29 @@ func main() {
     dataPath := flag.String("data", "data/synthetic.csv", "CSV de entrada")
     outImg := flag.String("out_img", "cmd/api/static/learning_curve.png", "PNG de saída")
     outCsv := flag.String("out_csv", "data/learning_curve.csv", "CSV de saída")
+    sample := flag.Int("sample", 0, "Usar uma amostra de reservatório de N linhas do CSV (0 = todas)")
+    workers := flag.Int("workers", 0, "Goroutines na vetorização (0 = número de CPUs)")
+    rejectsPath := flag.String("rejects", "data/analyzer_rejected_rows.csv", "Relatório das linhas recusadas na validação")
+    fxPath := flag.String("fx_rates", "data/fx_rates.csv", "CSV de câmbio (date,currency,rate em BRL por unidade)")
     flag.Parse()
 
-    X, y := loadXY(*dataPath)
-    if len(X) == 0 { fmt.Println("Dataset vazio"); return }
+    rates, err := fx.Load(*fxPath)
+    if err != nil {
+        fmt.Println("Tabela de câmbio indisponível; apenas BRL será aceito:", err)
+        rates = fx.New("BRL")
+    }
+    X, y := loadXY(*dataPath, *rejectsPath, rates, *sample, *workers)
+    if X == nil || X.Rows() == 0 { fmt.Println("Dataset vazio"); return }
 
-    split := int(0.8 * float64(len(X)))
-    Xtrain, ytrain := X[:split], y[:split]
-    Xtest, ytest := X[split:], y[split:]
+    split := int(0.8 * float64(X.Rows()))
+    Xtrain, ytrain := models.Range(X, 0, split), y[:split]
+    Xtest, ytest := models.Range(X, split, X.Rows()), y[split:]
 
     sizes := make([]int, 0, *points)
     for i := 1; i <= *points; i++ {
         frac := float64(i) / float64(*points)
-        s := int(math.Max(100, frac*float64(len(Xtrain))))
-        if s > len(Xtrain) { s = len(Xtrain) }
+        s := int(math.Max(100, frac*float64(split)))
+        if s > split { s = split }
         sizes = append(sizes, s)
     }
 
@@ -49,12 +61,12 @@ func main() {
     testAcc := make([]float64, len(sizes))
 
     for k, s := range sizes {
-        subX := Xtrain[:s]
+        subX := models.Range(Xtrain, 0, s)
         subY := ytrain[:s]
         mdl := buildModel(*algo, *estimators, *maxDepth, *minSamples, *lr)
-        if err := mdl.Fit(subX, subY); err != nil { fmt.Println("Falha treino:", err); return }
-        pTrain := mdl.Predict(subX)
-        pTest := mdl.Predict(Xtest)
+        if err := mdl.FitDataset(subX, subY, 2, nil); err != nil { fmt.Println("Falha treino:", err); return }
+        pTrain := models.PredictDataset(mdl, subX)
+        pTest := models.PredictDataset(mdl, Xtest)
         trainAcc[k] = accuracy(subY, pTrain)
         testAcc[k] = accuracy(ytest, pTest)
         fmt.Printf("%s | size=%d | train=%.3f | test=%.3f\n", mdl.Name(), s, trainAcc[k], testAcc[k])
@@ -73,36 +85,50 @@ func main() {
     }
 }
 
-func loadXY(path string) ([][]float64, []int) {
-    f, err := os.Open(path)
+// loadXY converte os valores para BRL antes de vetorizar, como o trainer e a
+// API: sem isso despesas em moeda estrangeira seriam avaliadas como BRL. A
+// matriz é montada bloco a bloco, sem guardar as despesas.
+func loadXY(path, rejectsPath string, rates *fx.Table, sample, workers int) (*data.Matrix, []int) {
+    rd, err := data.OpenReader(path, data.NewValidator(rates))
     if err != nil { fmt.Println("Falha ao abrir CSV:", err); return nil, nil }
-    defer f.Close()
-    r := csv.NewReader(f)
-    rows, err := r.ReadAll()
-    if err != nil || len(rows) < 2 { fmt.Println("CSV inválido"); return nil, nil }
-    X := make([][]float64, 0, len(rows)-1)
-    y := make([]int, 0, len(rows)-1)
-    for i := 1; i < len(rows); i++ {
-        row := rows[i]
-        reqDate, _ := time.Parse("2006-01-02", row[5])
-        travelDate, _ := time.Parse("2006-01-02", row[6])
-        amount, _ := strconv.ParseFloat(row[9], 64)
-        fraud, _ := strconv.Atoi(row[14])
-        e := features.BuildExpense(
-            row[0], row[1], row[2], row[3], row[4],
-            reqDate, travelDate,
-            row[7], row[8],
-            amount,
-            row[10], row[11], row[12], row[13],
-        )
-        v, _ := features.Vectorize(e)
-        X = append(X, v)
-        y = append(y, fraud)
+    defer rd.Close()
+    _, names := features.Vectorize(data.Expense{})
+    m := data.NewMatrix(names, 0)
+    var y []int
+    var exps []data.Expense
+    add := func(records []data.Record) error {
+        exps = exps[:0]
+        for _, rec := range records {
+            e, err := features.ToBase(rates, rec.Expense)
+            if err != nil { rd.Rejects.Add(rec.Line, rec.Expense.ExpenseID, err); continue }
+            exps = append(exps, e)
+            if rec.Label == data.LabelFraud { y = append(y, 1) } else { y = append(y, 0) }
+        }
+        m.AppendParallel(exps, workers, func(e data.Expense) []float64 { v, _ := features.Vectorize(e); return v })
+        return nil
+    }
+    if sample > 0 {
+        var records []data.Record
+        total, err := rd.Sample(sample, rand.New(rand.NewSource(time.Now().UnixNano())), func(rec data.Record) error { records = append(records, rec); return nil })
+        if err != nil { fmt.Println("CSV inválido:", err); return nil, nil }
+        fmt.Printf("Amostra de reservatório: %d de %d linhas válidas\n", len(records), total)
+        add(records)
+    } else if err := rd.Chunks(10000, add); err != nil {
+        fmt.Println("CSV inválido:", err)
+        return nil, nil
+    }
+    if rd.Rejects.Len() > 0 {
+        fmt.Printf("Linhas recusadas na validação: %d %v\n", rd.Rejects.Len(), rd.Rejects.ByField())
+        if err := rd.Rejects.Write(rejectsPath); err != nil {
+            fmt.Println("Erro ao salvar relatório de recusadas:", err)
+        } else {
+            fmt.Println("Relatório de recusadas salvo em:", rejectsPath)
+        }
     }
-    return X, y
+    return m, y
 }
 
-func buildModel(algo string, estimators, maxDepth, minSamples int, lr float64) models.Model {
+func buildModel(algo string, estimators, maxDepth, minSamples int, lr float64) models.DatasetModel {
     switch algo {
     case "rf":
         rf := models.NewRandomForest()
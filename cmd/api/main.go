@@ -1,23 +1,45 @@
 package main
 
 import (
+    "bytes"
+    "encoding/base64"
     "encoding/csv"
     "encoding/gob"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
     "net/http"
     "os"
     "path/filepath"
     "strconv"
     "strings"
+    "sync"
     "time"
 
+    svg "github.com/ajstarks/svgo"
     "github.com/gin-gonic/gin"
+    "go.uber.org/zap"
 
+    "antifraude/internal/approvers"
+    "antifraude/internal/data"
+    "antifraude/internal/dedup"
     "antifraude/internal/features"
+    "antifraude/internal/featurestore"
+    "antifraude/internal/fx"
+    "antifraude/internal/merchants"
+    "antifraude/internal/policy"
     "antifraude/internal/models"
+    "antifraude/internal/receipts"
     "antifraude/pkg/utils"
 )
 
-type ruleModel struct{}
+type ruleModel struct{ schema *features.Schema }
+
+func newRuleModel() *ruleModel {
+    _, names := features.Vectorize(data.Expense{})
+    return &ruleModel{schema: features.NewSchema(names, nil)}
+}
 
 func (r *ruleModel) Fit(X [][]float64, y []int) error { return nil }
 func (r *ruleModel) Predict(X [][]float64) []int {
@@ -35,18 +57,29 @@ func (r *ruleModel) PredictProba(X [][]float64) []float64 {
 }
 func (r *ruleModel) Name() string { return "RuleModel" }
 func (r *ruleModel) score(v []float64) float64 {
+    f := func(name string) float64 { return r.schema.Value(v, name) }
     s := 0.05
-    if v[2] == 1 { s += 0.35 }
-    if v[3] == 1 { s += 0.1 }
-    if v[4] == 1 { s += 0.15 }
-    if v[5] == 1 { s += 0.15 }
-    if v[len(v)-3] == 1 && v[0] > 200 { s += 0.2 }
-    if v[1] < 0 { s += 0.3 }
+    if f("MesmoAprovador") == 1 { s += 0.35 }
+    if f("SolicitanteViajante") == 1 { s += 0.1 }
+    if f("ValorInteiro") == 1 { s += 0.15 }
+    if f("ValorMultiplo5") == 1 { s += 0.15 }
+    if f("Cat_Taxi") == 1 && f("Amount") > 200 { s += 0.2 }
+    if f("IntervaloSolicitante") < 0 { s += 0.3 }
     if s > 0.95 { s = 0.95 }
     return s
 }
 
 var model models.Model
+var modelPath string
+var conformal *models.Conformal
+var vectorizer *features.Vectorizer
+var typologyClasses []string
+var store *featurestore.Store
+var feedbackMu sync.Mutex
+var rates *fx.Table
+var receiptIndex *receipts.Index
+var travelPolicy *policy.Policy
+var validator *data.Validator
 
 type catRule struct { Min float64; Max float64; HardMax float64 }
 var categoryRules = map[string]catRule{
@@ -57,6 +90,14 @@ var categoryRules = map[string]catRule{
     "hospedagem":  {Min: 80, Max: 600, HardMax: 5000},
 }
 
+// Limites de aprovação por item (categoria x cargo) usados na detecção de
+// fracionamento: os do modelo, APPROVAL_LIMITS (YAML) ou o padrão.
+var approvalLimits = features.DefaultApprovalLimits()
+
+// tripDailyLimit é o gasto médio por dia de viagem acima do qual a viagem
+// inteira é sinalizada.
+var tripDailyLimit = 1500.0
+
 func validateAmount(category string, amount float64) (bool, string) {
     if amount <= 0 { return false, "valor deve ser maior que zero" }
     return true, ""
@@ -138,6 +179,19 @@ func main() {
                 model = &gb
             }
         }
+    case "ht", "hat":
+        path = filepath.Join("models", algo+"_model.gob")
+        ht := models.NewHoeffdingTree()
+        ht.Adaptive = algo == "hat"
+        if f, err := os.Open(path); err == nil {
+            defer f.Close()
+            dec := gob.NewDecoder(f)
+            var saved models.HoeffdingTree
+            if err := dec.Decode(&saved); err == nil && saved.Root != nil {
+                ht = &saved
+            }
+        }
+        model = ht
     default:
         path = filepath.Join("models", "dt_model.gob")
         if f, err := os.Open(path); err == nil {
@@ -149,7 +203,118 @@ func main() {
             }
         }
     }
-    if model == nil { model = &ruleModel{} }
+    if model == nil { model = newRuleModel() }
+    modelPath = path
+    if _, ok := model.(*ruleModel); !ok {
+        base := strings.TrimSuffix(path, "_model.gob")
+        if vz, err := features.LoadVectorizer(base + "_features.gob"); err == nil {
+            vectorizer = vz
+        } else {
+            // Sem o vetorizador do treino os vetores não batem com o modelo.
+            logger.Error("Falha ao carregar o vetorizador do modelo; usando regras", zap.String("model", path), zap.Error(err))
+            model = newRuleModel()
+        }
+    }
+    if _, ok := model.(*ruleModel); !ok {
+        base := strings.TrimSuffix(path, "_model.gob")
+        if sc, err := features.LoadSchema(base + "_schema.gob"); err == nil {
+            if err := sc.Check(vectorizer.Names()); err != nil {
+                logger.Fatal("Modelo incompatível com o vetorizador atual", zap.String("model", path), zap.Error(err))
+            }
+            logger.Info("Schema de features verificado", zap.String("hash", sc.Hash), zap.Int("features", len(sc.Names)))
+            typologyClasses = sc.Classes
+        } else {
+            logger.Warn("Modelo sem schema de features; verificação de consistência desativada", zap.String("model", path))
+        }
+    }
+    fxPath := os.Getenv("FX_RATES")
+    if fxPath == "" { fxPath = filepath.Join("data", "fx_rates.csv") }
+    if t, err := fx.Load(fxPath); err == nil {
+        rates = t
+    } else {
+        logger.Warn("Tabela de câmbio indisponível; apenas BRL será aceito", zap.Error(err))
+        rates = fx.New("BRL")
+    }
+    validator = data.NewValidator(rates)
+    if vectorizer != nil { vectorizer.SetFX(rates) }
+    if cal := vectorizer.Calendar(); cal != nil {
+        logger.Info("Calendário de feriados do modelo", zap.String("versao", cal.Version))
+    }
+    if mp := vectorizer.Merchants(); mp != nil {
+        if path := os.Getenv("MERCHANT_LIST"); path != "" {
+            if err := mp.List.Load(path); err != nil { logger.Fatal("Falha ao ler lista de estabelecimentos", zap.String("path", path), zap.Error(err)) }
+        }
+        logger.Info("Lista de estabelecimentos", zap.Int("entradas", len(mp.List.Entries)))
+    }
+    // as features de fracionamento usam sempre os limites salvos com o modelo;
+    // APPROVAL_LIMITS muda só os alertas da resposta
+    if si := vectorizer.Splits(); si != nil { approvalLimits = si.Limits }
+    limitsPath := os.Getenv("APPROVAL_LIMITS")
+    if limitsPath == "" && vectorizer.Splits() == nil { limitsPath = filepath.Join("data", "approval_limits.yaml") }
+    if limitsPath != "" {
+        if lim, err := features.LoadApprovalLimits(limitsPath); err == nil {
+            approvalLimits = lim
+        } else {
+            logger.Warn("Limites de aprovação indisponíveis; usando os do modelo ou o padrão", zap.String("path", limitsPath), zap.Error(err))
+        }
+    }
+    // a tabela salva com o modelo não muda (as features de quilometragem
+    // dependem dela); CITY_DISTANCES carrega uma política à parte, usada só
+    // nos alertas da resposta
+    travelPolicy = vectorizer.Policy()
+    distPath := os.Getenv("CITY_DISTANCES")
+    if travelPolicy == nil && distPath == "" { distPath = filepath.Join("data", "city_distances.csv") }
+    if distPath != "" {
+        pl := policy.New()
+        if err := pl.LoadDistances(distPath); err == nil {
+            travelPolicy = pl
+        } else {
+            logger.Warn("Tabela de distâncias indisponível; usando a do modelo", zap.String("path", distPath), zap.Error(err))
+        }
+    }
+    if travelPolicy == nil { travelPolicy = policy.New() }
+    logger.Info("Política de viagem", zap.Int("trechos", len(travelPolicy.Distances)), zap.Float64("taxa_km", travelPolicy.MileageRate))
+    if vectorizer.HasStep("history") {
+        storePath := os.Getenv("FEATURE_STORE")
+        if storePath == "" { storePath = filepath.Join("data", "feature_store.gob") }
+        st, err := featurestore.Open(storePath)
+        if err != nil {
+            logger.Warn("Falha ao abrir feature store; iniciando vazio", zap.Error(err))
+            st = featurestore.New(storePath)
+        }
+        store = st
+        vectorizer.SetStore(store)
+        go func() {
+            for range time.Tick(30 * time.Second) {
+                if store.Dirty() {
+                    if err := store.Save(); err != nil { logger.Warn("Falha ao salvar feature store", zap.Error(err)) }
+                }
+            }
+        }()
+    }
+    receiptPath := os.Getenv("RECEIPT_INDEX")
+    if receiptPath == "" { receiptPath = filepath.Join("data", "receipt_index.gob") }
+    if ix, err := receipts.Open(receiptPath); err == nil {
+        receiptIndex = ix
+    } else {
+        logger.Warn("Falha ao abrir índice de recibos; iniciando vazio", zap.Error(err))
+        receiptIndex = receipts.New(receiptPath)
+    }
+    go func() {
+        for range time.Tick(30 * time.Second) {
+            if receiptIndex.Dirty() {
+                if err := receiptIndex.Save(); err != nil { logger.Warn("Falha ao salvar índice de recibos", zap.Error(err)) }
+            }
+        }
+    }()
+    if f, err := os.Open(strings.TrimSuffix(path, "_model.gob") + "_conformal.gob"); err == nil {
+        var cf models.Conformal
+        if err := gob.NewDecoder(f).Decode(&cf); err == nil && cf.Calibrated() {
+            cf.Base = model
+            conformal = &cf
+        }
+        f.Close()
+    }
 
     r := gin.Default()
 
@@ -159,11 +324,17 @@ func main() {
     })
     r.GET("/dashboard/data", dashboardData)
     r.GET("/dashboard/metrics", dashboardMetrics)
+    r.GET("/dashboard/approvers", dashboardApprovers)
 
     api := r.Group("/")
     api.Use(apiKeyMiddleware)
     api.POST("/predict", handlePredict)
     api.POST("/batch", handleBatch)
+    api.POST("/ingest", handleIngest)
+    api.POST("/feedback", handleFeedback)
+    api.GET("/graph/:user_id", handleGraph)
+    api.GET("/trip/:request_id", handleTrip)
+    api.POST("/receipts/:expense_id", handleReceiptUpload)
 
     port := os.Getenv("PORT")
     if port == "" { port = "8080" }
@@ -193,6 +364,31 @@ type predictReq struct {
     JobTitle       string `json:"job_title"`
     Department     string `json:"department"`
     ApprovalStatus string `json:"approval_status"`
+    SubmittedAt    string `json:"submitted_at"`
+    ApprovedAt     string `json:"approved_at"`
+    ReceiptImage   string `json:"receipt_image"`
+    Merchant       string `json:"merchant"`
+    MerchantTaxID  string `json:"merchant_cnpj"`
+    Origin         string `json:"origin_city"`
+    Destination    string `json:"destination_city"`
+}
+
+func (r predictReq) raw() data.RawExpense {
+    return data.RawExpense{
+        ExpenseID: r.ExpenseID, RequestID: r.RequestID, RequesterID: r.RequesterID, TravellerID: r.TravellerID, ApproverID: r.ApproverID,
+        RequestDate: r.RequestDate, TravelDate: r.TravelDate, Category: r.Category, Description: r.Description,
+        Amount: strconv.FormatFloat(r.Amount, 'f', -1, 64), Currency: r.Currency, JobTitle: r.JobTitle, Department: r.Department,
+        ApprovalStatus: r.ApprovalStatus, SubmittedAt: r.SubmittedAt, ApprovedAt: r.ApprovedAt,
+        Merchant: r.Merchant, MerchantTaxID: r.MerchantTaxID, Origin: r.Origin, Destination: r.Destination,
+    }
+}
+
+// parseExpense valida a requisição (erros por campo em *data.ValidationError)
+// e converte o valor para a moeda base.
+func parseExpense(r predictReq) (data.Expense, error) {
+    e, err := validator.Parse(r.raw())
+    if err != nil { return e, err }
+    return features.ToBase(rates, e)
 }
 
 func handlePredict(c *gin.Context) {
@@ -200,44 +396,371 @@ func handlePredict(c *gin.Context) {
     if err := c.BindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"}); return
     }
-    rd, _ := time.Parse("2006-01-02", req.RequestDate)
-    td, _ := time.Parse("2006-01-02", req.TravelDate)
-    e := features.BuildExpense(req.ExpenseID, req.RequestID, req.RequesterID, req.TravellerID, req.ApproverID,
-        rd, td, req.Category, req.Description, req.Amount, req.Currency, req.JobTitle, req.Department, req.ApprovalStatus)
-    v, _ := features.Vectorize(e)
+    e, err := parseExpense(req)
+    if err != nil { c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "dados inválidos", "errors": data.FieldErrors(err)}); return }
+    receipt, hasReceipt, err := decodeReceipt(req.ReceiptImage)
+    if err != nil { c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "dados inválidos", "errors": []data.FieldError{{Field: "receipt_image", Message: err.Error()}}}); return }
+    rd, td := e.RequestDate, e.TravelDate
+    v, _ := vectorizer.Vectorize(e)
+    dups := vectorizer.Duplicates(e)
+    split := splitFlags(e)
+    var reuse []receipts.Match
+    if hasReceipt { reuse = receiptIndex.Matches(e.ExpenseID, e.RequesterID, receipt) }
     p := model.PredictProba([][]float64{v})[0]
-    flags := detectAnomalies(req.Category, req.Amount, rd, td)
-    risk := riskWithAnomalies(p, req.Category, req.Amount, rd, td, flags)
-    c.JSON(http.StatusOK, gin.H{"score": p, "risk": risk, "model": model.Name(), "flags": flags})
+    flags := append(detectAnomalies(e.Category, e.Amount, rd, td), duplicateFlags(dups)...)
+    flags = append(flags, split...)
+    flags = append(flags, vectorizer.OrgChart().Check(e).Flags()...)
+    flags = append(flags, receiptFlags(reuse)...)
+    merchant, mflags := merchantCheck(e)
+    flags = append(flags, mflags...)
+    violations, unknownRoute := travelPolicy.Check(e)
+    flags = append(flags, policy.Flags(violations, unknownRoute)...)
+    risk := policyRisk(riskWithAnomalies(p, e.Category, e.Amount, rd, td, flags), violations)
+    resp := gin.H{"score": p, "risk": risk, "model": model.Name(), "flags": flags, "amount_base": e.Amount}
+    if len(dups) > 0 { resp["duplicates"] = dups }
+    if len(reuse) > 0 { resp["receipt_matches"] = reuse }
+    if merchant != nil { resp["merchant_match"] = merchant }
+    if len(violations) > 0 { resp["policy"] = violations }
+    if t := typologies([][]float64{v}); t != nil { resp["typology"] = t[0] }
+    if u := uncertainty([][]float64{v}); u != nil {
+        for k, val := range u[0] { resp[k] = val }
+        if u[0]["uncertain"] == true { resp["flags"] = append(flags, "predição incerta: encaminhar para revisão manual") }
+    }
+    c.JSON(http.StatusOK, resp)
 }
 
 func handleBatch(c *gin.Context) {
     var items []predictReq
     if err := c.BindJSON(&items); err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"}); return }
+    exps := make([]data.Expense, len(items))
+    hashes := make([]*receipts.Hash, len(items))
+    var invalid []gin.H
+    for i, it := range items {
+        e, err := parseExpense(it)
+        errs := []data.FieldError{}
+        if err != nil { errs = data.FieldErrors(err) }
+        h, ok, rerr := decodeReceipt(it.ReceiptImage)
+        if rerr != nil { errs = append(errs, data.FieldError{Field: "receipt_image", Message: rerr.Error()}) }
+        if len(errs) > 0 { invalid = append(invalid, gin.H{"index": i, "expense_id": it.ExpenseID, "errors": errs}); continue }
+        if ok { hashes[i] = &h }
+        exps[i] = e
+    }
+    if len(invalid) > 0 { c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "dados inválidos", "items": invalid}); return }
     X := make([][]float64, 0, len(items))
-    for _, it := range items {
-        rd, _ := time.Parse("2006-01-02", it.RequestDate)
-        td, _ := time.Parse("2006-01-02", it.TravelDate)
-        e := features.BuildExpense(it.ExpenseID, it.RequestID, it.RequesterID, it.TravellerID, it.ApproverID,
-            rd, td, it.Category, it.Description, it.Amount, it.Currency, it.JobTitle, it.Department, it.ApprovalStatus)
-        v, _ := features.Vectorize(e)
+    dups := make([][]dedup.Match, len(items))
+    splits := make([][]string, len(items))
+    reuse := make([][]receipts.Match, len(items))
+    for i, e := range exps {
+        v, _ := vectorizer.Vectorize(e)
+        dups[i] = vectorizer.Duplicates(e)
+        splits[i] = splitFlags(e)
+        if hashes[i] != nil { reuse[i] = receiptIndex.Matches(e.ExpenseID, e.RequesterID, *hashes[i]) }
         X = append(X, v)
     }
     ps := model.PredictProba(X)
+    types := typologies(X)
+    unc := uncertainty(X)
     out := make([]gin.H, len(items))
     for i := range items {
-        rd, _ := time.Parse("2006-01-02", items[i].RequestDate)
-        td, _ := time.Parse("2006-01-02", items[i].TravelDate)
-        flags := detectAnomalies(items[i].Category, items[i].Amount, rd, td)
+        rd, td := exps[i].RequestDate, exps[i].TravelDate
+        flags := append(detectAnomalies(exps[i].Category, exps[i].Amount, rd, td), duplicateFlags(dups[i])...)
+        flags = append(flags, splits[i]...)
+        flags = append(flags, vectorizer.OrgChart().Check(exps[i]).Flags()...)
+        flags = append(flags, receiptFlags(reuse[i])...)
+        merchant, mflags := merchantCheck(exps[i])
+        flags = append(flags, mflags...)
+        violations, unknownRoute := travelPolicy.Check(exps[i])
+        flags = append(flags, policy.Flags(violations, unknownRoute)...)
         out[i] = gin.H{
             "score": ps[i],
-            "risk": riskWithAnomalies(ps[i], items[i].Category, items[i].Amount, rd, td, flags),
+            "risk": policyRisk(riskWithAnomalies(ps[i], exps[i].Category, exps[i].Amount, rd, td, flags), violations),
             "flags": flags,
+            "amount_base": exps[i].Amount,
+        }
+        if len(dups[i]) > 0 { out[i]["duplicates"] = dups[i] }
+        if len(reuse[i]) > 0 { out[i]["receipt_matches"] = reuse[i] }
+        if merchant != nil { out[i]["merchant_match"] = merchant }
+        if len(violations) > 0 { out[i]["policy"] = violations }
+        if types != nil { out[i]["typology"] = types[i] }
+        if unc != nil {
+            for k, val := range unc[i] { out[i][k] = val }
+            if unc[i]["uncertain"] == true { out[i]["flags"] = append(flags, "predição incerta: encaminhar para revisão manual") }
         }
     }
     c.JSON(http.StatusOK, out)
 }
 
+func duplicateFlags(ms []dedup.Match) []string {
+    flags := make([]string, 0, len(ms))
+    for _, m := range ms { flags = append(flags, "possível duplicidade: "+m.ExpenseID) }
+    return flags
+}
+
+func splitFlags(e data.Expense) []string {
+    r := approvalLimits.Evaluate(e, vectorizer.SplitGroup(e))
+    if !r.Structured { return nil }
+    return []string{fmt.Sprintf("possível fracionamento: soma %.2f acima do limite %.2f (%s)", r.Sum, r.Limit, strings.Join(r.Items, ", "))}
+}
+
+// tripFlags descreve os sinais da viagem; tripScore os soma com pesos no
+// mesmo espírito do ruleModel.
+func tripFlags(t features.Trip) []string {
+    flags := []string{}
+    if t.SpendPerDay > tripDailyLimit { flags = append(flags, fmt.Sprintf("gasto por dia %.2f acima de %.2f", t.SpendPerDay, tripDailyLimit)) }
+    if t.LodgingNoTransport { flags = append(flags, "hospedagem sem transporte") }
+    if t.MealsOutside > 0 { flags = append(flags, fmt.Sprintf("%d refeição(ões) fora da janela da viagem (%s a %s)", t.MealsOutside, t.Start, t.End)) }
+    if t.OverlappingNights > 0 { flags = append(flags, fmt.Sprintf("%d diária(s) de hospedagem sobreposta(s)", t.OverlappingNights)) }
+    return flags
+}
+
+func tripScore(t features.Trip) float64 {
+    s := 0.05
+    if t.SpendPerDay > tripDailyLimit { s += 0.25 }
+    if t.LodgingNoTransport { s += 0.15 }
+    if t.MealsOutside > 0 { s += 0.2 + 0.05*float64(t.MealsOutside-1) }
+    if t.OverlappingNights > 0 { s += 0.35 }
+    if s > 0.95 { s = 0.95 }
+    return s
+}
+
+func handleTrip(c *gin.Context) {
+    ti := vectorizer.Trips()
+    if ti == nil { c.JSON(http.StatusNotFound, gin.H{"error": "viagens indisponíveis para o modelo atual"}); return }
+    trips := ti.ByRequest(c.Param("request_id"))
+    if len(trips) == 0 { c.JSON(http.StatusNotFound, gin.H{"error": "pedido não encontrado"}); return }
+    out := make([]gin.H, len(trips))
+    for i, t := range trips {
+        p := tripScore(t)
+        out[i] = gin.H{"trip": t, "score": p, "risk": riskBand(p), "flags": tripFlags(t)}
+    }
+    c.JSON(http.StatusOK, gin.H{"request_id": c.Param("request_id"), "trips": out})
+}
+
+// decodeReceipt aceita a imagem em base64, com ou sem prefixo data URL;
+// vazio significa despesa sem recibo.
+func decodeReceipt(b64 string) (receipts.Hash, bool, error) {
+    if b64 == "" { return receipts.Hash{}, false, nil }
+    if i := strings.Index(b64, ";base64,"); strings.HasPrefix(b64, "data:") && i >= 0 { b64 = b64[i+len(";base64,"):] }
+    raw, err := base64.StdEncoding.DecodeString(b64)
+    if err != nil { return receipts.Hash{}, false, fmt.Errorf("receipt_image: base64 inválido") }
+    if len(raw) > receipts.MaxBytes { return receipts.Hash{}, false, fmt.Errorf("receipt_image: imagem acima de %d bytes", receipts.MaxBytes) }
+    h, _, err := receipts.Decode(bytes.NewReader(raw))
+    return h, err == nil, err
+}
+
+func receiptFlags(ms []receipts.Match) []string {
+    flags := make([]string, 0, len(ms))
+    for _, m := range ms {
+        who := "outro funcionário"
+        if m.SameEmployee { who = "mesmo funcionário" }
+        flags = append(flags, fmt.Sprintf("recibo reutilizado: %s (%s, distância %d)", m.ExpenseID, who, m.Distance))
+    }
+    return flags
+}
+
+// policyRisk eleva a faixa de risco conforme o grau da violação de política:
+// grave vira alto e moderado é no mínimo médio.
+func policyRisk(risk string, vs []policy.Violation) string {
+    switch policy.MaxLevel(vs) {
+    case policy.Grave:
+        return "alto"
+    case policy.Moderado:
+        if risk == "baixo" || risk == "muito_baixo" { return "medio" }
+    }
+    return risk
+}
+
+// merchantCheck confere o CNPJ e procura o estabelecimento na lista de
+// bloqueio/observação salva com o modelo (ou MERCHANT_LIST).
+func merchantCheck(e data.Expense) (*merchants.ListMatch, []string) {
+    var flags []string
+    if e.MerchantTaxID != "" && !merchants.ValidCNPJ(e.MerchantTaxID) { flags = append(flags, "CNPJ do estabelecimento inválido: "+e.MerchantTaxID) }
+    mp := vectorizer.Merchants()
+    if mp == nil { return nil, flags }
+    m, ok := mp.List.Match(e.Merchant, e.MerchantTaxID)
+    if !ok { return nil, flags }
+    what := "bloqueado"
+    if m.List == merchants.Watchlist { what = "em observação" }
+    flags = append(flags, fmt.Sprintf("estabelecimento %s: %s (similaridade %.2f)", what, m.Name, m.Similarity))
+    return &m, flags
+}
+
+// handleReceiptUpload recebe o recibo de uma despesa já enviada (multipart,
+// campo file) e devolve as colisões com recibos anteriores.
+func handleReceiptUpload(c *gin.Context) {
+    expenseID := c.Param("expense_id")
+    invalid := func(field, value, msg string) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "dados inválidos", "errors": []data.FieldError{{Field: field, Value: value, Message: msg}}})
+    }
+    if validator.IDPattern != nil && !validator.IDPattern.MatchString(expenseID) { invalid("expense_id", expenseID, "formato de ID inválido (letras, dígitos, _ . -; até 64 caracteres)"); return }
+    fh, err := c.FormFile("file")
+    if err != nil { invalid("file", "", "obrigatório"); return }
+    if fh.Size > receipts.MaxBytes { invalid("file", fh.Filename, fmt.Sprintf("imagem acima de %d bytes", receipts.MaxBytes)); return }
+    f, err := fh.Open()
+    if err != nil { invalid("file", fh.Filename, err.Error()); return }
+    defer f.Close()
+    h, format, err := receipts.Decode(f)
+    if err != nil { invalid("file", fh.Filename, err.Error()); return }
+    matches := receiptIndex.Check(expenseID, c.PostForm("employee_id"), h)
+    if matches == nil { matches = []receipts.Match{} }
+    c.JSON(http.StatusOK, gin.H{"expense_id": expenseID, "format": format, "hash": h.String(), "matches": matches, "flags": receiptFlags(matches)})
+}
+
+// classNames devolve o nome de cada classe do modelo multiclasse: os do
+// schema ou, em modelos anteriores a ele, o prefixo de data.FraudTypes (novas
+// tipologias só entram no fim da lista).
+func classNames(mc models.MultiClassModel) []string {
+    if len(typologyClasses) > 0 {
+        if len(typologyClasses) != mc.Classes() { return nil }
+        return typologyClasses
+    }
+    if mc.Classes() <= 2 || mc.Classes() > len(data.FraudTypes) { return nil }
+    return data.FraudTypes[:mc.Classes()]
+}
+
+func typologies(X [][]float64) []gin.H {
+    mc, ok := model.(models.MultiClassModel)
+    if !ok { return nil }
+    names := classNames(mc)
+    if names == nil { return nil }
+    cp := mc.PredictClassProba(X)
+    out := make([]gin.H, len(cp))
+    for i, ps := range cp {
+        best := -1
+        probs := gin.H{}
+        for k, name := range names {
+            if name == data.FraudNone { continue }
+            probs[name] = ps[k]
+            if best < 0 || ps[k] > ps[best] { best = k }
+        }
+        if best < 0 { return nil }
+        out[i] = gin.H{"fraud_type": names[best], "probability": ps[best], "probabilities": probs}
+    }
+    return out
+}
+
+func uncertainty(X [][]float64) []gin.H {
+    if conformal == nil { return nil }
+    pv := conformal.PValues(X)
+    out := make([]gin.H, len(pv))
+    for i := range pv {
+        out[i] = gin.H{
+            "uncertain": conformal.Uncertain(pv[i]),
+            "prediction_set": conformal.PredictionSet(pv[i]),
+            "p_values": gin.H{"legitima": pv[i][0], "fraude": pv[i][1]},
+        }
+    }
+    return out
+}
+
+// record grava a despesa no feature store, no histórico do vetorizador
+// (duplicidade, fracionamento, viagens, diárias do dia) e o recibo no índice.
+// Só /ingest e /feedback chamam: /predict e /predict/batch apenas consultam,
+// então reenviar a mesma despesa não infla o histórico. Os índices ignoram
+// expense_id já visto.
+func record(e data.Expense, receipt *receipts.Hash) {
+    if store != nil { store.Add(e) }
+    if receipt != nil { receiptIndex.Add(e.ExpenseID, e.RequesterID, *receipt) }
+    vectorizer.Observe(e)
+    if travelPolicy != vectorizer.Policy() { travelPolicy.Observe(e) }
+}
+
+// parseRecord valida a despesa e decodifica o recibo (se houver) de um item a
+// registrar.
+func parseRecord(r predictReq) (data.Expense, *receipts.Hash, []data.FieldError) {
+    e, err := parseExpense(r)
+    errs := []data.FieldError{}
+    if err != nil { errs = data.FieldErrors(err) }
+    h, ok, rerr := decodeReceipt(r.ReceiptImage)
+    if rerr != nil { errs = append(errs, data.FieldError{Field: "receipt_image", Message: rerr.Error()}) }
+    if !ok || rerr != nil { return e, nil, errs }
+    return e, &h, errs
+}
+
+// handleIngest registra despesas já submetidas (uma ou uma lista), com o
+// recibo em receipt_image se houver, para que os próximos /predict as vejam
+// no histórico.
+func handleIngest(c *gin.Context) {
+    body, err := c.GetRawData()
+    if err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"}); return }
+    var items []predictReq
+    if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+        err = json.Unmarshal(body, &items)
+    } else {
+        var one predictReq
+        err = json.Unmarshal(body, &one)
+        items = []predictReq{one}
+    }
+    if err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"}); return }
+    exps := make([]data.Expense, 0, len(items))
+    hashes := make([]*receipts.Hash, 0, len(items))
+    var invalid []gin.H
+    for i, it := range items {
+        e, h, errs := parseRecord(it)
+        if len(errs) > 0 { invalid = append(invalid, gin.H{"index": i, "expense_id": it.ExpenseID, "errors": errs}); continue }
+        exps, hashes = append(exps, e), append(hashes, h)
+    }
+    if len(invalid) > 0 { c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "dados inválidos", "items": invalid}); return }
+    for i, e := range exps { record(e, hashes[i]) }
+    c.JSON(http.StatusOK, gin.H{"ingested": len(exps)})
+}
+
+type feedbackReq struct {
+    predictReq
+    Fraud *int `json:"fraud"`
+}
+
+func handleFeedback(c *gin.Context) {
+    im, ok := model.(models.IncrementalModel)
+    if !ok { c.JSON(http.StatusConflict, gin.H{"error": "modelo atual não suporta aprendizado incremental", "model": model.Name()}); return }
+    body, err := c.GetRawData()
+    if err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"}); return }
+    var items []feedbackReq
+    if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+        err = json.Unmarshal(body, &items)
+    } else {
+        var one feedbackReq
+        err = json.Unmarshal(body, &one)
+        items = []feedbackReq{one}
+    }
+    if err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"}); return }
+    X := make([][]float64, 0, len(items))
+    y := make([]int, 0, len(items))
+    exps := make([]data.Expense, 0, len(items))
+    hashes := make([]*receipts.Hash, 0, len(items))
+    var invalid []gin.H
+    for i, it := range items {
+        e, h, errs := parseRecord(it.predictReq)
+        if it.Fraud == nil || (*it.Fraud != 0 && *it.Fraud != 1) { errs = append(errs, data.FieldError{Field: "fraud", Message: "deve ser 0 ou 1"}) }
+        if len(errs) > 0 { invalid = append(invalid, gin.H{"index": i, "expense_id": it.ExpenseID, "errors": errs}); continue }
+        v, _ := vectorizer.Vectorize(e)
+        X = append(X, v)
+        y = append(y, *it.Fraud)
+        exps, hashes = append(exps, e), append(hashes, h)
+    }
+    if len(invalid) > 0 { c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "dados inválidos", "items": invalid}); return }
+    feedbackMu.Lock()
+    defer feedbackMu.Unlock()
+    if err := im.PartialFit(X, y); err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
+    for i, e := range exps { record(e, hashes[i]) }
+    if err := saveIncrementalModel(); err != nil {
+        utils.Logger().Warn("Falha ao salvar modelo incremental", zap.Error(err))
+    }
+    c.JSON(http.StatusOK, gin.H{"updated": len(X), "model": model.Name()})
+}
+
+func saveIncrementalModel() error {
+    ht, ok := model.(*models.HoeffdingTree)
+    if !ok || modelPath == "" { return nil }
+    if err := os.MkdirAll(filepath.Dir(modelPath), 0o755); err != nil { return err }
+    tmp := modelPath + ".tmp"
+    f, err := os.Create(tmp)
+    if err != nil { return err }
+    if err := ht.Encode(f); err != nil { f.Close(); return err }
+    if err := f.Close(); err != nil { return err }
+    return os.Rename(tmp, modelPath)
+}
+
 func riskBand(p float64) string {
     switch {
     case p >= 0.95:
@@ -265,40 +788,43 @@ func riskBandWithCategory(p float64, category string, amount float64) string {
     return base
 }
 
+// dashboardData lê o CSV em streaming e para ao juntar max despesas (já
+// filtradas pela categoria), pontuando todas numa só chamada ao modelo.
 func dashboardData(c *gin.Context) {
-    path := "data/synthetic.csv"
-    f, err := os.Open(path)
+    const max = 200
+    rd, err := data.OpenReader("data/synthetic.csv", validator)
     if err != nil { c.JSON(http.StatusOK, gin.H{"items": []gin.H{}}); return }
-    defer f.Close()
-    r := csv.NewReader(f)
-    rows, err := r.ReadAll()
-    if err != nil || len(rows) < 2 { c.JSON(http.StatusOK, gin.H{"items": []gin.H{}}); return }
-    max := 200
-    items := make([]gin.H, 0, max)
-    for i := 1; i < len(rows) && len(items) < max; i++ {
-        row := rows[i]
-        rd, _ := time.Parse("2006-01-02", row[5])
-        td, _ := time.Parse("2006-01-02", row[6])
-        amt, _ := strconv.ParseFloat(row[9], 64)
-        e := features.BuildExpense(row[0], row[1], row[2], row[3], row[4], rd, td, row[7], row[8], amt, row[10], row[11], row[12], row[13])
-        v, _ := features.Vectorize(e)
-        p := model.PredictProba([][]float64{v})[0]
-        items = append(items, gin.H{
-            "expense_id": row[0],
-            "category": row[7],
-            "amount": amt,
-            "department": row[12],
-            "date": row[5],
-            "score": p,
-            "risk": riskBand(p),
-            "model": model.Name(),
-        })
-    }
+    defer rd.Close()
     q := strings.ToLower(c.Query("category"))
-    if q != "" {
-        filt := make([]gin.H, 0, len(items))
-        for _, it := range items { if strings.ToLower(it["category"].(string)) == q { filt = append(filt, it) } }
-        items = filt
+    var exps []data.Expense
+    var amounts []float64
+    errStop := errors.New("limite")
+    err = rd.Each(func(rec data.Record) error {
+        e := rec.Expense
+        if q != "" && strings.ToLower(e.Category) != q { return nil }
+        amounts = append(amounts, e.Amount)
+        if n, err := features.ToBase(rates, e); err == nil { e = n }
+        exps = append(exps, e)
+        if len(exps) >= max { return errStop }
+        return nil
+    })
+    if err != nil && err != errStop { c.JSON(http.StatusOK, gin.H{"items": []gin.H{}}); return }
+    names := vectorizer.Names()
+    X := data.VectorizeParallel(exps, names, 0, func(e data.Expense) []float64 { v, _ := vectorizer.Vectorize(e); return v }).Dense(nil)
+    var ps []float64
+    if len(X) > 0 { ps = model.PredictProba(X) }
+    items := make([]gin.H, len(exps))
+    for i, e := range exps {
+        items[i] = gin.H{
+            "expense_id": e.ExpenseID,
+            "category": e.Category,
+            "amount": amounts[i],
+            "department": e.Department,
+            "date": e.RequestDate.Format(data.DateLayout),
+            "score": ps[i],
+            "risk": riskBand(ps[i]),
+            "model": model.Name(),
+        }
     }
     c.JSON(http.StatusOK, gin.H{"items": items})
 }
@@ -323,3 +849,53 @@ func dashboardMetrics(c *gin.Context) {
     }
     c.JSON(http.StatusOK, gin.H{"metrics": out})
 }
+
+// dashboardApprovers lista os aprovadores com perfil de "carimbo" segundo o
+// perfil ajustado no treino.
+func dashboardApprovers(c *gin.Context) {
+    a := vectorizer.Approvers()
+    if a == nil { c.JSON(http.StatusOK, gin.H{"items": []approvers.Row{}}); return }
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if err != nil || limit <= 0 { limit = 20 }
+    items := a.AtRisk(limit)
+    if items == nil { items = []approvers.Row{} }
+    c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func handleGraph(c *gin.Context) {
+    g := vectorizer.Graph()
+    if g == nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "grafo indisponível para o modelo atual"}); return
+    }
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+    if err != nil || limit <= 0 { limit = 50 }
+    nb, ok := g.Neighbourhood(c.Param("user_id"), limit)
+    if !ok { c.JSON(http.StatusNotFound, gin.H{"error": "usuário não encontrado no grafo"}); return }
+    if c.Query("format") != "svg" { c.JSON(http.StatusOK, nb); return }
+
+    // layout circular: usuário no centro, vizinhos ao redor
+    const w, h, radius = 640, 640, 240
+    pos := map[string][2]int{}
+    for i, n := range nb.Nodes {
+        if i == 0 { pos[n.ID] = [2]int{w / 2, h / 2}; continue }
+        a := 2 * math.Pi * float64(i-1) / float64(len(nb.Nodes)-1)
+        pos[n.ID] = [2]int{w/2 + int(radius*math.Cos(a)), h/2 + int(radius*math.Sin(a))}
+    }
+    c.Header("Content-Type", "image/svg+xml")
+    canvas := svg.New(c.Writer)
+    canvas.Start(w, h)
+    canvas.Rect(0, 0, w, h, "fill:white")
+    for _, e := range nb.Edges {
+        s, t := pos[e.Source], pos[e.Target]
+        style := "stroke:#888;stroke-width:" + strconv.Itoa(1+int(math.Log1p(float64(e.Count))))
+        if e.Type == "viajante" { style += ";stroke-dasharray:4,4" }
+        canvas.Line(s[0], s[1], t[0], t[1], style)
+    }
+    for _, n := range nb.Nodes {
+        p := pos[n.ID]
+        red := int(255 * math.Min(1, n.FraudRate*4))
+        canvas.Circle(p[0], p[1], 14, "fill:rgb("+strconv.Itoa(red)+",80,80);stroke:black")
+        canvas.Text(p[0], p[1]+28, n.ID, "text-anchor:middle;font-size:11px;font-family:sans-serif")
+    }
+    canvas.End()
+}
@@ -21,8 +21,34 @@ async function loadData() {
   });
 }
 
+async function loadApprovers() {
+  try {
+    const res = await fetch('/dashboard/approvers?limit=15');
+    const data = await res.json();
+    const rows = document.getElementById('approver-rows');
+    rows.innerHTML = '';
+    (data.items || []).forEach((it) => {
+      const band = it.risk >= 0.5 ? 'alto' : it.risk >= 0.3 ? 'medio' : 'baixo';
+      const tr = document.createElement('tr');
+      tr.innerHTML = `
+        <td>${it.approver_id}</td>
+        <td>${it.n}</td>
+        <td>${(it.approval_rate * 100).toFixed(1)}%</td>
+        <td>${it.latency_median_hours.toFixed(2)}</td>
+        <td>${(it.fast_rate * 100).toFixed(1)}%</td>
+        <td>${it.max_daily} (${it.spike.toFixed(1)}x)</td>
+        <td>${(it.approved_fraud_rate * 100).toFixed(1)}%</td>
+        <td class="risk-${band}">${it.risk.toFixed(3)}</td>
+      `;
+      rows.appendChild(tr);
+    });
+  } catch (e) {
+  }
+}
+
 document.getElementById('refresh').addEventListener('click', loadData);
 window.addEventListener('load', loadData);
+window.addEventListener('load', loadApprovers);
 window.addEventListener('load', loadMetrics);
 function pad2(n) { return n.toString().padStart(2, '0'); }
 function todayStr() {
@@ -37,6 +63,15 @@ window.addEventListener('load', () => {
   if (travelInput && !travelInput.value) travelInput.value = todayStr();
 });
 
+function readDataURL(file) {
+  return new Promise((resolve, reject) => {
+    const r = new FileReader();
+    r.onload = () => resolve(r.result);
+    r.onerror = () => reject(r.error);
+    r.readAsDataURL(file);
+  });
+}
+
 async function calculateScore() {
   const expenseId = `E${Math.floor(Math.random()*1e7)}`;
   const requestId = `R${Math.floor(Math.random()*1e7)}`;
@@ -55,7 +90,15 @@ async function calculateScore() {
     job_title: document.getElementById('in_jobtitle').value || 'Analista',
     department: document.getElementById('in_department').value || 'Financeiro',
     approval_status: document.getElementById('in_status').value || 'Aprovado',
+    merchant: document.getElementById('in_merchant').value || '',
+    merchant_cnpj: document.getElementById('in_merchant_cnpj').value || '',
+    origin_city: document.getElementById('in_origin').value || '',
+    destination_city: document.getElementById('in_destination').value || '',
   };
+  const approvedAt = document.getElementById('in_approvedat').value;
+  if (approvedAt) payload.approved_at = `${approvedAt.replace('T', ' ')}:00`;
+  const receipt = document.getElementById('in_receipt').files[0];
+  if (receipt) payload.receipt_image = await readDataURL(receipt);
   const resultBox = document.getElementById('calc-result');
   const flagsBox = document.getElementById('calc-flags');
   resultBox.textContent = 'Calculando...';
@@ -72,6 +115,12 @@ async function calculateScore() {
     }
     const data = await res.json();
     resultBox.textContent = `Score: ${data.score.toFixed(3)} — Risco: ${data.risk}`;
+    if (data.typology) {
+      resultBox.textContent += ` — Tipologia: ${data.typology.fraud_type} (${data.typology.probability.toFixed(2)})`;
+    }
+    if (data.uncertain === true) {
+      resultBox.textContent += ' — Incerto: revisão manual';
+    }
     if (data.flags && Array.isArray(data.flags) && data.flags.length > 0) {
       flagsBox.textContent = `Flags: ${data.flags.join(', ')}`;
     } else {
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "encoding/csv"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "time"
+
+    "gonum.org/v1/plot"
+    "gonum.org/v1/plot/plotter"
+    "gonum.org/v1/plot/plotutil"
+    "gonum.org/v1/plot/vg"
+
+    "antifraude/internal/benford"
+    "antifraude/internal/data"
+)
+
+func main() {
+    dataPath := flag.String("data", "data/synthetic.csv", "CSV de entrada")
+    group := flag.String("group", "requester", "Agrupamento: requester|approver|department")
+    from := flag.String("from", "", "Data inicial (YYYY-MM-DD, opcional)")
+    to := flag.String("to", "", "Data final (YYYY-MM-DD, opcional)")
+    minN := flag.Int("min_n", 30, "Mínimo de valores por entidade")
+    top := flag.Int("top", 20, "Entidades no gráfico de MAD")
+    outCsv := flag.String("out_csv", "data/benford_report.csv", "CSV do relatório")
+    outDir := flag.String("out_dir", "cmd/api/static", "Diretório dos gráficos")
+    rejectsPath := flag.String("rejects", "data/benford_rejected_rows.csv", "Relatório das linhas recusadas na validação")
+    flag.Parse()
+
+    valid := false
+    for _, g := range benford.Groups { if g == *group { valid = true } }
+    if !valid { fmt.Println("Agrupamento inválido:", *group); os.Exit(1) }
+
+    p := benford.NewProfile()
+    p.MinN = *minN
+    var err error
+    if *from != "" {
+        if p.From, err = time.Parse("2006-01-02", *from); err != nil { fmt.Println("Data inicial inválida:", err); os.Exit(1) }
+    }
+    if *to != "" {
+        if p.To, err = time.Parse("2006-01-02", *to); err != nil { fmt.Println("Data final inválida:", err); os.Exit(1) }
+    }
+
+    exps := loadExpenses(*dataPath, *rejectsPath)
+    if len(exps) == 0 { fmt.Println("Dataset vazio"); return }
+    p.Fit(exps, nil)
+
+    c1, m1 := p.Global.FirstDigit()
+    c2, m2 := p.Global.SecondDigit()
+    fmt.Printf("Global | n=%d | 1º dígito chi2=%.2f MAD=%.4f (%s) | 2º dígito chi2=%.2f MAD=%.4f | redondos=%.3f\n",
+        p.Global.N, c1, m1, p.Global.Conformity(), c2, m2, p.Global.RoundRate())
+
+    rows := p.Report(*group)
+    for i, r := range rows {
+        if i >= 10 { break }
+        fmt.Printf("%s=%s | n=%d | MAD1=%.4f | MAD2=%.4f | redondos=%.3f | %s\n", *group, r.Key, r.N, r.MADFirst, r.MADSecond, r.RoundRate, r.Conformity)
+    }
+
+    if err := writeReport(*outCsv, rows); err != nil {
+        fmt.Println("Erro ao salvar CSV:", err)
+    } else {
+        fmt.Println("Relatório salvo em:", *outCsv)
+    }
+    digitsImg := filepath.Join(*outDir, "benford_digits.png")
+    if err := plotDigits(digitsImg, &p.Global); err != nil {
+        fmt.Println("Erro ao salvar PNG:", err)
+    } else {
+        fmt.Println("Gráfico salvo em:", digitsImg)
+    }
+    madImg := filepath.Join(*outDir, "benford_"+*group+"_mad.png")
+    if err := plotMAD(madImg, *group, rows, *top); err != nil {
+        fmt.Println("Erro ao salvar PNG:", err)
+    } else {
+        fmt.Println("Gráfico salvo em:", madImg)
+    }
+}
+
+func loadExpenses(path, rejectsPath string) []data.Expense {
+    rd, err := data.OpenReader(path, nil)
+    if err != nil { fmt.Println("Falha ao abrir CSV:", err); return nil }
+    defer rd.Close()
+    var exps []data.Expense
+    if err := rd.Each(func(rec data.Record) error { exps = append(exps, rec.Expense); return nil }); err != nil { fmt.Println("CSV inválido:", err); return nil }
+    if rd.Rejects.Len() > 0 {
+        fmt.Printf("Linhas recusadas na validação: %d %v\n", rd.Rejects.Len(), rd.Rejects.ByField())
+        if err := rd.Rejects.Write(rejectsPath); err != nil {
+            fmt.Println("Erro ao salvar relatório de recusadas:", err)
+        } else {
+            fmt.Println("Relatório de recusadas salvo em:", rejectsPath)
+        }
+    }
+    return exps
+}
+
+func writeReport(path string, rows []benford.Row) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+    f, err := os.Create(path)
+    if err != nil { return err }
+    defer f.Close()
+    w := csv.NewWriter(f)
+    defer w.Flush()
+    if err := w.Write([]string{"key", "n", "chi2_first", "mad_first", "chi2_second", "mad_second", "round_rate", "round10_rate", "conformity"}); err != nil { return err }
+    for _, r := range rows {
+        rec := []string{
+            r.Key, strconv.Itoa(r.N),
+            fmt.Sprintf("%.4f", r.Chi2First), fmt.Sprintf("%.6f", r.MADFirst),
+            fmt.Sprintf("%.4f", r.Chi2Second), fmt.Sprintf("%.6f", r.MADSecond),
+            fmt.Sprintf("%.6f", r.RoundRate), fmt.Sprintf("%.6f", r.Round10),
+            r.Conformity,
+        }
+        if err := w.Write(rec); err != nil { return err }
+    }
+    return nil
+}
+
+func plotDigits(path string, st *benford.Stats) error {
+    p := plot.New()
+    p.Title.Text = "Lei de Benford - primeiro dígito"
+    p.X.Label.Text = "Dígito"
+    p.Y.Label.Text = "Proporção"
+
+    observed := make(plotter.Values, 9)
+    expected := make(plotter.Values, 9)
+    for d := 1; d <= 9; d++ {
+        if st.N > 0 { observed[d-1] = float64(st.First[d]) / float64(st.N) }
+        expected[d-1] = benford.FirstExpected[d]
+    }
+    w := vg.Points(12)
+    obs, err := plotter.NewBarChart(observed, w)
+    if err != nil { return err }
+    obs.Color = plotutil.Color(0)
+    obs.Offset = -w / 2
+    exp, err := plotter.NewBarChart(expected, w)
+    if err != nil { return err }
+    exp.Color = plotutil.Color(1)
+    exp.Offset = w / 2
+    p.Add(obs, exp)
+    p.Legend.Add("Observado", obs)
+    p.Legend.Add("Benford", exp)
+    p.Legend.Top = true
+    p.NominalX("1", "2", "3", "4", "5", "6", "7", "8", "9")
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+    return p.Save(8*vg.Inch, 4*vg.Inch, path)
+}
+
+func plotMAD(path, group string, rows []benford.Row, top int) error {
+    if top > len(rows) { top = len(rows) }
+    p := plot.New()
+    p.Title.Text = "MAD do primeiro dígito por " + group
+    p.Y.Label.Text = "MAD"
+    vals := make(plotter.Values, top)
+    labels := make([]string, top)
+    for i := 0; i < top; i++ { vals[i] = rows[i].MADFirst; labels[i] = rows[i].Key }
+    bars, err := plotter.NewBarChart(vals, vg.Points(14))
+    if err != nil { return err }
+    bars.Color = plotutil.Color(2)
+    p.Add(bars)
+    // limite de Nigrini para não conformidade
+    limit := plotter.NewFunction(func(float64) float64 { return 0.015 })
+    limit.Color = plotutil.Color(0)
+    limit.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+    p.Add(limit)
+    p.NominalX(labels...)
+    p.X.Tick.Label.Rotation = 0.8
+    p.X.Tick.Label.XAlign = -0.9
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+    return p.Save(10*vg.Inch, 4*vg.Inch, path)
+}
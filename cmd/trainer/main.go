@@ -1,28 +1,33 @@
 package main
 
 import (
-	"encoding/csv"
-	"encoding/gob"
-	"flag"
-	"fmt"
-	"math"
-	"math/rand"
-	"os"
-	"sort"
-	"strconv"
-	"time"
-
-	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
-	"gonum.org/v1/plot/vg"
-
-	"go.uber.org/zap"
-
-	"antifraude/internal/data"
-	"antifraude/internal/features"
-	"antifraude/internal/models"
-	"antifraude/pkg/utils"
+    "encoding/csv"
+    "encoding/gob"
+    "errors"
+    "flag"
+    "fmt"
+    "math"
+    "math/rand"
+    "os"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "gonum.org/v1/plot"
+    "gonum.org/v1/plot/plotter"
+    "gonum.org/v1/plot/plotutil"
+    "gonum.org/v1/plot/vg"
+
+    "go.uber.org/zap"
+
+    "antifraude/internal/data"
+    "antifraude/internal/features"
+    "antifraude/internal/featurestore"
+    "antifraude/internal/fx"
+    "antifraude/internal/models"
+    "antifraude/pkg/utils"
 )
 
 func main() {
@@ -32,7 +37,7 @@ func main() {
     regen := flag.Bool("regen", true, "Regenerar dataset sintético")
     n := flag.Int("n", 260000, "Número de registros sintéticos")
     out := flag.String("out", "data/synthetic.csv", "Caminho do CSV de saída")
-    algo := flag.String("algo", "dt", "Algoritmo: dt|rf|bagging|gb|lgbm")
+    algo := flag.String("algo", "dt", "Algoritmo: dt|rf|bagging|gb|lgbm|ht|hat")
     estimators := flag.Int("estimators", 30, "Número de estimadores no ensemble (rf/bagging)")
     maxDepth := flag.Int("max_depth", 6, "Profundidade máxima da árvore")
     minSamples := flag.Int("min_samples", 100, "Mínimo de amostras para split")
@@ -48,6 +53,39 @@ func main() {
     thresholdMetric := flag.String("threshold_metric", "f1", "Métrica para escolher threshold: f1|acc")
     thrMin := flag.Float64("threshold_min", 0.05, "Limite inferior para threshold automático")
     thrMax := flag.Float64("threshold_max", 0.95, "Limite superior para threshold automático")
+    batchSize := flag.Int("batch_size", 1000, "Tamanho do mini-batch para PartialFit (ht/hat)")
+    typology := flag.Bool("typology", true, "Treinar alvo multiclasse com a coluna fraud_type quando presente (dt|rf|bagging|gb)")
+    conformalAlpha := flag.Float64("conformal_alpha", 0.1, "Nível de erro do conformal split (0 desativa)")
+    calibFrac := flag.Float64("calib_frac", 0.1, "Fração do treino reservada para calibrar o conformal")
+    puMode := flag.Bool("pu", false, "Modo PU learning: fraud vazio/-1 = não rotulado (Elkan-Noto)")
+    puLabelFrac := flag.Float64("pu_label_frac", 0, "Simular investigação: fração de registros que mantém o rótulo (0 desativa)")
+    catEncoding := flag.Bool("cat_encoding", true, "Codificar categoria, departamento, cargo e status (one-hot com raros + target encoding out-of-fold)")
+    textFeatures := flag.Bool("text_features", true, "Incluir features de texto da descrição (vocabulário salvo com o modelo)")
+    peerFeatures := flag.Bool("peer_features", true, "Incluir desvio em relação ao grupo de pares (cargo, departamento, categoria)")
+    graphFeatures := flag.Bool("graph_features", true, "Incluir features da rede solicitante/aprovador (concentração, reciprocidade, comunidades)")
+    dedupFeatures := flag.Bool("dedup_features", true, "Incluir similaridade com despesas anteriores (duplicidade por MinHash)")
+    splitFeatures := flag.Bool("split_features", true, "Incluir detecção de fracionamento contra limites de aprovação")
+    tripFeatures := flag.Bool("trip_features", true, "Incluir features da viagem (despesas do mesmo pedido e viajante: gasto por dia, hospedagem sem transporte, refeições fora da janela)")
+    benfordFeatures := flag.Bool("benford_features", true, "Incluir conformidade de Benford e taxa de valores redondos por solicitante/aprovador/departamento")
+    benfordDays := flag.Int("benford_days", 0, "Período (dias até a última solicitação do treino) usado no perfil de Benford (0 = tudo)")
+    fxPath := flag.String("fx_rates", "data/fx_rates.csv", "CSV de câmbio (date,currency,rate em BRL por unidade)")
+    calendarFeatures := flag.Bool("calendar_features", true, "Incluir features de calendário (fim de semana, feriados, ponte, fim de mês)")
+    holidays := flag.String("holidays", "", "CSV de feriados estaduais/municipais (date,name,scope; date MM-DD ou YYYY-MM-DD)")
+    pipelinePath := flag.String("pipeline", "", "YAML com os passos do pipeline de features (vazio = todos os registrados); as flags *_features desligam passos por cima")
+    approverFeatures := flag.Bool("approver_features", true, "Incluir perfil do aprovador (latência, taxa de aprovação, picos de volume, fraude entre aprovados)")
+    orgFeatures := flag.Bool("orgchart_features", true, "Incluir validação da cadeia de aprovação contra o cadastro de RH (cargo, departamento, admissão/desligamento)")
+    merchantFeatures := flag.Bool("merchant_features", true, "Incluir features de estabelecimento (CNPJ, lista de bloqueio/observação com nome aproximado, primeira aparição, funcionários, taxa de fraude)")
+    merchantList := flag.String("merchant_list", "data/merchant_list.csv", "CSV da lista de estabelecimentos (name,cnpj,list,reason; list = block|watch)")
+    policyFeatures := flag.Bool("policy_features", true, "Incluir checagem de política (quilometragem × distância, diárias de refeição e hospedagem por faixa de cidade e cargo)")
+    distancesPath := flag.String("distances", "data/city_distances.csv", "CSV de distâncias entre cidades (origin,destination,km)")
+    limitsPath := flag.String("approval_limits", "data/approval_limits.yaml", "YAML dos limites de aprovação por categoria e cargo (fracionamento); ausente usa o padrão")
+    hrPath := flag.String("hr", "data/hr_employees.csv", "CSV de RH (employee_id,job_title,department,manager_id,start_date,end_date)")
+    history := flag.Bool("history", true, "Incluir features de velocidade/histórico do feature store")
+    storePath := flag.String("feature_store", "data/feature_store.gob", "Arquivo do feature store (reconstruído a partir do CSV)")
+    sample := flag.Int("sample", 0, "Treinar com uma amostra de reservatório de N linhas do CSV (0 = todas)")
+    workers := flag.Int("workers", 0, "Goroutines na vetorização (0 = número de CPUs)")
+    rejectsPath := flag.String("rejects", "data/rejected_rows.csv", "Relatório das linhas recusadas na validação (line,expense_id,field,value,message)")
+    onnxOut := flag.String("onnx_out", "", "Exportar o modelo para ONNX-ML neste caminho (dt|rf|bagging|gb)")
     flag.Parse()
 
     if *regen {
@@ -57,41 +95,53 @@ func main() {
         }
     }
 
-    f, err := os.Open(*out)
+    rates, err := fx.Load(*fxPath)
+    if err != nil {
+        logger.Warn("Tabela de câmbio indisponível; apenas BRL será aceito", zap.Error(err))
+        rates = fx.New("BRL")
+    }
+    rd, err := data.OpenReader(*out, data.NewValidator(rates))
     if err != nil { logger.Fatal("Falha ao abrir CSV", zap.Error(err)) }
-    defer f.Close()
-
-    r := csv.NewReader(f)
-    rows, err := r.ReadAll()
-    if err != nil { logger.Fatal("Falha ao ler CSV", zap.Error(err)) }
-    if len(rows) < 2 { logger.Fatal("CSV vazio") }
-
-    X := make([][]float64, 0, len(rows)-1)
-    y := make([]int, 0, len(rows)-1)
-    for i := 1; i < len(rows); i++ {
-        row := rows[i]
-        reqDate, _ := time.Parse("2006-01-02", row[5])
-        travelDate, _ := time.Parse("2006-01-02", row[6])
-        amount, _ := strconv.ParseFloat(row[9], 64)
-        fraud, _ := strconv.Atoi(row[14])
-        e := features.BuildExpense(
-            row[0], row[1], row[2], row[3], row[4],
-            reqDate, travelDate,
-            row[7], row[8],
-            amount,
-            row[10], row[11], row[12], row[13],
-        )
-        v, _ := features.Vectorize(e)
-        X = append(X, v)
+    // cada linha vira despesa assim que é lida; só a amostra (-sample) fica
+    // em buffer
+    var exps []data.Expense
+    var y, yType []int
+    hasType := rd.HasType
+    unlabeled := 0
+    total, err := rd.Sample(*sample, rand.New(rand.NewSource(time.Now().UnixNano())), func(rec data.Record) error {
+        e, err := features.ToBase(rates, rec.Expense)
+        if err != nil { rd.Rejects.Add(rec.Line, rec.Expense.ExpenseID, err); return nil }
+        fraud := rec.Label
+        if !rd.HasLabel { fraud = data.LabelUnlabeled }
+        if *puLabelFrac > 0 && rand.Float64() >= *puLabelFrac { fraud = data.LabelUnlabeled }
+        if fraud == data.LabelUnlabeled && !*puMode { fraud = data.LabelClean; unlabeled++ }
+        exps = append(exps, e)
         y = append(y, fraud)
+        t := fraud
+        if hasType && fraud != data.LabelUnlabeled { t = data.FraudTypeIndex(rec.FraudType) }
+        yType = append(yType, t)
+        return nil
+    })
+    rd.Close()
+    if err != nil { logger.Fatal("Falha ao ler CSV", zap.Error(err)) }
+    if len(exps) == 0 { logger.Fatal("CSV vazio") }
+    if *sample > 0 { logger.Info("Amostra de reservatório", zap.Int("amostra", len(exps)), zap.Int("linhas_validas", total)) }
+    rejects := rd.Rejects
+    if rejects.Len() > 0 {
+        logger.Warn("Linhas recusadas na validação", zap.Int("recusadas", rejects.Len()), zap.Any("por_campo", rejects.ByField()), zap.String("relatorio", *rejectsPath))
+        if err := rejects.Write(*rejectsPath); err != nil { logger.Warn("Falha ao gravar relatório de linhas recusadas", zap.Error(err)) }
     }
+    if unlabeled > 0 {
+        logger.Warn("Registros não rotulados tratados como limpos (use -pu)", zap.Int("nao_rotulados", unlabeled))
+    }
+    multi := *typology && hasType && !*puMode
 
     rand.Seed(time.Now().UnixNano())
-    idx := rand.Perm(len(X))
-    shX := make([][]float64, len(X))
-    shY := make([]int, len(y))
-    for i, j := range idx { shX[i] = X[j]; shY[i] = y[j] }
-    X, y = shX, shY
+    rand.Shuffle(len(exps), func(i, j int) {
+        exps[i], exps[j] = exps[j], exps[i]
+        y[i], y[j] = y[j], y[i]
+        yType[i], yType[j] = yType[j], yType[i]
+    })
 
     var pos, neg int
     for i := range y { if y[i] == 1 { pos++ } else { neg++ } }
@@ -107,26 +157,138 @@ func main() {
     testIdx := make([]int, 0, len(posIdx)-pTrain+len(negIdx)-nTrain)
     for i := 0; i < len(posIdx); i++ { if i < pTrain { trainIdx = append(trainIdx, posIdx[rp[i]]) } else { testIdx = append(testIdx, posIdx[rp[i]]) } }
     for i := 0; i < len(negIdx); i++ { if i < nTrain { trainIdx = append(trainIdx, negIdx[rn[i]]) } else { testIdx = append(testIdx, negIdx[rn[i]]) } }
+
+    cfg := features.DefaultPipelineConfig()
+    if *pipelinePath != "" {
+        if cfg, err = features.LoadPipelineConfig(*pipelinePath); err != nil { logger.Fatal("Falha ao ler pipeline", zap.Error(err)) }
+    }
+    for step, on := range map[string]bool{"text": *textFeatures, "peers": *peerFeatures, "graph": *graphFeatures, "categorical": *catEncoding, "benford": *benfordFeatures, "calendar": *calendarFeatures, "dedup": *dedupFeatures, "splits": *splitFeatures, "trips": *tripFeatures, "orgchart": *orgFeatures, "approvers": *approverFeatures, "merchants": *merchantFeatures, "policy": *policyFeatures, "history": *history} {
+        if !on { cfg.Disable(step) }
+    }
+    vz, err := features.NewVectorizerFromConfig(cfg)
+    if err != nil { logger.Fatal("Pipeline de features inválido", zap.Error(err)) }
+    vz.SetFX(rates)
+    steps := make([]string, len(vz.Pipeline.Steps))
+    for i, s := range vz.Pipeline.Steps { steps[i] = s.Name }
+    logger.Info("Pipeline de features", zap.Strings("passos", steps))
+    if oc := vz.OrgChart(); oc != nil {
+        if err := oc.Load(*hrPath); err != nil { logger.Fatal("Falha ao ler cadastro de RH (use -orgchart_features=false para desligar)", zap.Error(err)) }
+        logger.Info("Cadastro de RH", zap.Int("funcionarios", len(oc.Employees)))
+    }
+    if mp := vz.Merchants(); mp != nil {
+        if err := mp.List.Load(*merchantList); err != nil {
+            logger.Warn("Lista de estabelecimentos indisponível; seguindo sem bloqueio/observação", zap.Error(err))
+        }
+        logger.Info("Lista de estabelecimentos", zap.Int("entradas", len(mp.List.Entries)))
+    }
+    if si := vz.Splits(); si != nil {
+        lim, err := features.LoadApprovalLimits(*limitsPath)
+        if err != nil && !errors.Is(err, os.ErrNotExist) { logger.Fatal("Falha ao ler limites de aprovação", zap.String("path", *limitsPath), zap.Error(err)) }
+        if err != nil { logger.Warn("Limites de aprovação indisponíveis; usando o padrão", zap.Error(err)) }
+        si.Limits = lim
+    }
+    if pol := vz.Policy(); pol != nil {
+        if err := pol.LoadDistances(*distancesPath); err != nil { logger.Fatal("Falha ao ler tabela de distâncias (use -policy_features=false para desligar)", zap.Error(err)) }
+        logger.Info("Tabela de distâncias", zap.Int("trechos", len(pol.Distances)))
+    }
+    if cal := vz.Calendar(); cal != nil {
+        if *holidays != "" {
+            if err := cal.LoadExtra(*holidays); err != nil { logger.Fatal("Falha ao ler feriados", zap.Error(err)) }
+        }
+        logger.Info("Calendário de feriados", zap.String("versao", cal.Version), zap.Int("extras", len(cal.Extra)))
+    }
+    trainExps := make([]data.Expense, len(trainIdx))
+    trainLabels := make([]int, len(trainIdx))
+    for i, j := range trainIdx { trainExps[i] = exps[j]; trainLabels[i] = y[j] }
+    if bp := vz.Benford(); bp != nil && *benfordDays > 0 {
+        for _, e := range trainExps { if e.RequestDate.After(bp.To) { bp.To = e.RequestDate } }
+        bp.From = bp.To.AddDate(0, 0, -*benfordDays)
+    }
+    vz.Fit(trainExps, trainLabels)
+    // o histórico vê todas as linhas válidas do CSV, não só a amostra, em
+    // ordem de data e sem carregar o arquivo
+    var store *featurestore.Store
+    if vz.HasStep("history") {
+        store = featurestore.New(*storePath)
+        store.Retention = 0
+    }
+    err = observeByDate(*out, rates, observeWindow, func(e data.Expense) {
+        vz.Observe(e)
+        if store != nil { store.Add(e) }
+    })
+    if err != nil { logger.Fatal("Falha ao reler CSV para o histórico", zap.Error(err)) }
+    if store != nil { vz.SetStore(store) }
+    featNames := vz.Names()
+    M := data.VectorizeParallel(exps, featNames, *workers, func(e data.Expense) []float64 { v, _ := vz.Vectorize(e); return v })
+    // no treino as colunas que dependem do rótulo vêm das outras folds, evitando vazamento
+    seed := time.Now().UnixNano()
+    type outOfFold interface {
+        TargetNames() []string
+        OutOfFold([]data.Expense, []int, int64) [][]float64
+    }
+    var oofSteps []outOfFold
+    if ce := vz.Cats(); ce != nil { oofSteps = append(oofSteps, ce) }
+    if g := vz.Graph(); g != nil { oofSteps = append(oofSteps, g) }
+    if ap := vz.Approvers(); ap != nil { oofSteps = append(oofSteps, ap) }
+    if mp := vz.Merchants(); mp != nil { oofSteps = append(oofSteps, mp) }
+    for _, st := range oofSteps {
+        if err := setOutOfFold(M, featNames, st.TargetNames()[0], trainIdx, st.OutOfFold(trainExps, trainLabels, seed)); err != nil { logger.Fatal("Falha no encoding fora da fold", zap.Error(err)) }
+    }
+    logger.Info("Features vetorizadas", zap.Int("features", len(featNames)), zap.Int("linhas", M.Rows()), zap.Int("bytes", M.Bytes()))
+
     rTrain := rand.Perm(len(trainIdx))
     rTest := rand.Perm(len(testIdx))
-    var Xtrain [][]float64
-    var ytrain []int
-    var Xtest [][]float64
-    var ytest []int
-    Xtrain, ytrain = make([][]float64, len(trainIdx)), make([]int, len(trainIdx))
-    Xtest, ytest = make([][]float64, len(testIdx)), make([]int, len(testIdx))
-    for i := range rTrain { idx := trainIdx[rTrain[i]]; Xtrain[i] = X[idx]; ytrain[i] = y[idx] }
-    for i := range rTest { idx := testIdx[rTest[i]]; Xtest[i] = X[idx]; ytest[i] = y[idx] }
+    var ytrain, ytest []int
+    ytrain, ytest = make([]int, len(trainIdx)), make([]int, len(testIdx))
+    ttrain, ttest := make([]int, len(trainIdx)), make([]int, len(testIdx))
+    trainRows, testRows := make([]int, len(trainIdx)), make([]int, len(testIdx))
+    for i := range rTrain { idx := trainIdx[rTrain[i]]; trainRows[i] = idx; ytrain[i] = y[idx]; ttrain[i] = yType[idx] }
+    for i := range rTest { idx := testIdx[rTest[i]]; testRows[i] = idx; ytest[i] = y[idx]; ttest[i] = yType[idx] }
+    // treino e teste são visões das linhas de M: os modelos leem a matriz em
+    // float32 sem a cópia densa em float64
+    var Xtrain, Xtest models.Dataset = models.Subset(M, trainRows), models.Subset(M, testRows)
+    if !multi { ttrain = nil }
+
+    var Xcal [][]float64
+    var ycal []int
+    if *puMode && *curve {
+        logger.Warn("Curva de aprendizagem desativada no modo PU")
+        *curve = false
+    }
+    if *puMode && *conformalAlpha > 0 {
+        logger.Warn("Conformal desativado no modo PU (calibração exige rótulos completos)")
+        *conformalAlpha = 0
+    }
+    if *conformalAlpha > 0 {
+        nCal := int(*calibFrac * float64(Xtrain.Rows()))
+        if nCal < 100 { nCal = 100 }
+        if nCal >= Xtrain.Rows() { nCal = Xtrain.Rows() / 2 }
+        cut := Xtrain.Rows() - nCal
+        Xcal, ycal = models.ToDense(Xtrain, cut, Xtrain.Rows()), ytrain[cut:]
+        Xtrain, ytrain = models.Range(Xtrain, 0, cut), ytrain[:cut]
+        if ttrain != nil { ttrain = ttrain[:cut] }
+    }
 
     var mdl models.Model
     var path string
-    switch *algo {
+    var pu *models.PULearner
+    algoCase := *algo
+    if *puMode { algoCase = "pu" }
+    switch algoCase {
+    case "pu":
+        pu = models.NewPULearner(func() models.Model { return constructModel(*algo, *estimators, *maxDepth, *minSamples, *lr) })
+        if err := pu.FitDataset(Xtrain, ytrain); err != nil {
+            logger.Fatal("Falha ao treinar PU learning", zap.Error(err))
+        }
+        logger.Info("PU learning (Elkan-Noto)", zap.Float64("c", pu.C), zap.Float64("prior_fraude", pu.Prior))
+        mdl = pu.Final
+        path = modelFile(*algo)
     case "rf":
         rf := models.NewRandomForest()
         rf.NEstimators = *estimators
         rf.MaxDepth = *maxDepth
         rf.MinSamples = *minSamples
-        if err := rf.Fit(Xtrain, ytrain); err != nil {
+        if err := fitModel(rf, Xtrain, ytrain, ttrain); err != nil {
             logger.Fatal("Falha ao treinar RF", zap.Error(err))
         }
         mdl = rf
@@ -136,7 +298,7 @@ func main() {
         bg.NEstimators = *estimators
         bg.MaxDepth = *maxDepth
         bg.MinSamples = *minSamples
-        if err := bg.Fit(Xtrain, ytrain); err != nil {
+        if err := fitModel(bg, Xtrain, ytrain, ttrain); err != nil {
             logger.Fatal("Falha ao treinar Bagging", zap.Error(err))
         }
         mdl = bg
@@ -146,7 +308,7 @@ func main() {
         gb.NEstimators = *estimators
         gb.LearningRate = *lr
         gb.MinSamples = *minSamples
-        if err := gb.Fit(Xtrain, ytrain); err != nil {
+        if err := fitModel(gb, Xtrain, ytrain, ttrain); err != nil {
             logger.Fatal("Falha ao treinar GradientBoosting", zap.Error(err))
         }
         mdl = gb
@@ -158,40 +320,57 @@ func main() {
         lgbm.NumIterations = *estimators
         lgbm.LearningRate = *lr
         lgbm.Device = "gpu"
-        if err := lgbm.Fit(Xtrain, ytrain); err != nil {
+        if err := fitModel(lgbm, Xtrain, ytrain, nil); err != nil {
             logger.Fatal("Falha ao treinar LightGBM", zap.Error(err))
         }
         mdl = lgbm
         path = "models/lgbm_model.gob"
+    case "ht", "hat":
+        ht := models.NewHoeffdingTree()
+        ht.Adaptive = *algo == "hat"
+        ht.MaxDepth = *maxDepth
+        if *batchSize <= 0 { *batchSize = models.PredictBlock }
+        for start := 0; start < Xtrain.Rows(); start += *batchSize {
+            end := start + *batchSize
+            if end > Xtrain.Rows() { end = Xtrain.Rows() }
+            if err := ht.PartialFit(models.ToDense(Xtrain, start, end), ytrain[start:end]); err != nil {
+                logger.Fatal("Falha ao treinar HoeffdingTree", zap.Error(err))
+            }
+        }
+        mdl = ht
+        path = "models/" + *algo + "_model.gob"
     default:
         dt := models.NewDecisionTree()
         dt.MaxDepth = *maxDepth
         dt.MinSamplesSplit = *minSamples
-        if err := dt.Fit(Xtrain, ytrain); err != nil {
+        if err := fitModel(dt, Xtrain, ytrain, ttrain); err != nil {
             logger.Fatal("Falha ao treinar DT", zap.Error(err))
         }
         mdl = dt
         path = "models/dt_model.gob"
     }
 
-    probaTest := mdl.PredictProba(Xtest)
-    valSize := int(0.1 * float64(len(Xtrain)))
+    probaTest := models.PredictProbaDataset(mdl, Xtest)
+    valSize := int(0.1 * float64(Xtrain.Rows()))
     if valSize < 100 { valSize = 100 }
-    if valSize > len(Xtrain) { valSize = len(Xtrain) }
-    valX := Xtrain[len(Xtrain)-valSize:]
+    if valSize > Xtrain.Rows() { valSize = Xtrain.Rows() }
+    valX := models.Range(Xtrain, Xtrain.Rows()-valSize, Xtrain.Rows())
     valY := ytrain[len(ytrain)-valSize:]
-    probaVal := mdl.PredictProba(valX)
+    probaVal := models.PredictProbaDataset(mdl, valX)
+    if *puMode { valY, probaVal = labeledOnly(valY, probaVal) }
     thrUsed := *threshold
     if *thresholdAuto {
         if *thresholdMetric == "acc" { thrUsed, _ = bestThresholdAcc(valY, probaVal) } else { thrUsed, _ = bestThresholdF1(valY, probaVal) }
     }
     if thrUsed < *thrMin { thrUsed = *thrMin }
     if thrUsed > *thrMax { thrUsed = *thrMax }
-    preds := probaToPred(probaTest, thrUsed)
-    acc := accuracy(ytest, preds)
-    prec, rec, f1 := prf1(ytest, probaTest, thrUsed)
-    roc := rocAUC(ytest, probaTest)
-    pr := prAUC(ytest, probaTest)
+    mY, mP := ytest, probaTest
+    if *puMode { mY, mP = labeledOnly(ytest, probaTest) }
+    preds := probaToPred(mP, thrUsed)
+    acc := accuracy(mY, preds)
+    prec, rec, f1 := prf1(mY, mP, thrUsed)
+    roc := rocAUC(mY, mP)
+    pr := prAUC(mY, mP)
     logger.Info("Métricas holdout",
         zap.String("model", mdl.Name()),
         zap.Float64("accuracy", acc),
@@ -202,6 +381,41 @@ func main() {
         zap.Float64("pr_auc", pr),
         zap.Float64("threshold", thrUsed),
     )
+    if pu != nil {
+        recL, ppr, leeLiu, precEst := puMetrics(ytest, probaTest, thrUsed, pu.Prior)
+        logger.Info("Métricas PU (holdout)",
+            zap.Float64("recall_rotulados", recL),
+            zap.Float64("taxa_predita_positiva", ppr),
+            zap.Float64("lee_liu", leeLiu),
+            zap.Float64("precision_estimada", precEst),
+        )
+    }
+
+    if mc, ok := mdl.(models.MultiClassModel); ok && mc.Classes() > 2 {
+        typeAcc, frauds := typologyAccuracy(mc, Xtest, ttest)
+        logger.Info("Tipologia de fraude (holdout)",
+            zap.Int("classes", mc.Classes()),
+            zap.Int("fraudes", frauds),
+            zap.Float64("acuracia_tipologia", typeAcc),
+        )
+    }
+
+    var cf *models.Conformal
+    if *conformalAlpha > 0 {
+        cf = models.NewConformal(mdl, *conformalAlpha)
+        if err := cf.Calibrate(Xcal, ycal); err != nil {
+            logger.Warn("Falha ao calibrar conformal", zap.Error(err))
+            cf = nil
+        } else {
+            coverage, uncertain := conformalCoverage(cf, Xtest, ytest)
+            logger.Info("Conformal (holdout)",
+                zap.Float64("alpha", *conformalAlpha),
+                zap.Int("calibracao", len(Xcal)),
+                zap.Float64("cobertura", coverage),
+                zap.Float64("taxa_incertos", uncertain),
+            )
+        }
+    }
 
     if err := os.MkdirAll("models", 0o755); err != nil { logger.Fatal("mkdir models", zap.Error(err)) }
     mf, err := os.Create(path)
@@ -210,10 +424,48 @@ func main() {
     enc := gob.NewEncoder(mf)
     if err := enc.Encode(mdl); err != nil { logger.Fatal("serializar modelo", zap.Error(err)) }
     logger.Info("Modelo salvo", zap.String("path", path))
+    vzPath := strings.TrimSuffix(path, "_model.gob") + "_features.gob"
+    if d := vz.Dedup(); d != nil { d.Compact(90) }
+    if si := vz.Splits(); si != nil { si.Compact(30) }
+    if tr := vz.Trips(); tr != nil { tr.Compact(60) }
+    if pl := vz.Policy(); pl != nil { pl.Compact(30) }
+    if err := features.SaveVectorizer(vzPath, vz); err != nil { logger.Fatal("serializar vetorizador", zap.Error(err)) }
+    logger.Info("Vetorizador salvo", zap.String("path", vzPath))
+    schemaPath := strings.TrimSuffix(path, "_model.gob") + "_schema.gob"
+    schema := features.NewSchema(featNames, Xtrain)
+    if mc, ok := mdl.(models.MultiClassModel); ok && mc.Classes() > 2 { schema.Classes = append([]string(nil), data.FraudTypes[:mc.Classes()]...) }
+    if err := features.SaveSchema(schemaPath, schema); err != nil { logger.Fatal("salvar schema de features", zap.Error(err)) }
+    logger.Info("Schema de features salvo", zap.String("path", schemaPath), zap.String("hash", schema.Hash))
+    if store != nil {
+        store.Compact(30)
+        store.Retention = 30
+        if err := store.Save(); err != nil { logger.Fatal("salvar feature store", zap.Error(err)) }
+        logger.Info("Feature store salvo", zap.String("path", *storePath))
+    }
+    if cf != nil {
+        cfPath := strings.TrimSuffix(path, "_model.gob") + "_conformal.gob"
+        if err := saveGob(cfPath, &models.Conformal{Alpha: cf.Alpha, Scores: cf.Scores}); err != nil {
+            logger.Fatal("serializar conformal", zap.Error(err))
+        }
+        logger.Info("Calibração conformal salva", zap.String("path", cfPath))
+    }
     fmt.Println("Modelo:", mdl.Name())
 
+    if *onnxOut != "" {
+        if err := models.ExportONNX(mdl, featNames, *onnxOut); err != nil {
+            logger.Fatal("Falha ao exportar ONNX", zap.Error(err))
+        }
+        diff := 0.0
+        for from := 0; from < Xtest.Rows(); from += models.PredictBlock {
+            d, err := models.VerifyONNX(mdl, *onnxOut, models.ToDense(Xtest, from, min(from+models.PredictBlock, Xtest.Rows())), 1e-4)
+            if err != nil { logger.Fatal("Verificação do ONNX falhou", zap.Error(err)) }
+            diff = max(diff, d)
+        }
+        logger.Info("Modelo exportado para ONNX", zap.String("path", *onnxOut), zap.Float64("max_diff", diff))
+    }
+
     if *curve {
-        sizes := computeCurveSizes(len(Xtrain), *curvePoints, *curveMin, *curveLog)
+        sizes := computeCurveSizes(Xtrain.Rows(), *curvePoints, *curveMin, *curveLog)
         trainAcc := make([]float64, len(sizes))
         testAcc := make([]float64, len(sizes))
         trainF1 := make([]float64, len(sizes))
@@ -223,18 +475,18 @@ func main() {
         trainPR := make([]float64, len(sizes))
         testPR := make([]float64, len(sizes))
         for k, s := range sizes {
-            subX := Xtrain[:s]
+            subX := models.Range(Xtrain, 0, s)
             subY := ytrain[:s]
             cm := constructModel(*algo, *estimators, *maxDepth, *minSamples, *lr)
-            if err := cm.Fit(subX, subY); err != nil { logger.Fatal("Falha ao treinar no ponto da curva", zap.Error(err)) }
-            probaTrain := cm.PredictProba(subX)
-            probaTest := cm.PredictProba(Xtest)
-            vs := int(0.1 * float64(len(subX)))
+            if err := fitModel(cm, subX, subY, nil); err != nil { logger.Fatal("Falha ao treinar no ponto da curva", zap.Error(err)) }
+            probaTrain := models.PredictProbaDataset(cm, subX)
+            probaTest := models.PredictProbaDataset(cm, Xtest)
+            vs := int(0.1 * float64(s))
             if vs < 50 { vs = 50 }
-            if vs > len(subX) { vs = len(subX) }
-            vX := subX[len(subX)-vs:]
+            if vs > s { vs = s }
+            vX := models.Range(subX, s-vs, s)
             vY := subY[len(subY)-vs:]
-            probaV := cm.PredictProba(vX)
+            probaV := models.PredictProbaDataset(cm, vX)
             thrCurve := *threshold
             if *thresholdAuto {
                 if *thresholdMetric == "acc" { thrCurve, _ = bestThresholdAcc(vY, probaV) } else { thrCurve, _ = bestThresholdF1(vY, probaV) }
@@ -265,6 +517,153 @@ func main() {
     }
 }
 
+// observeWindow é o máximo de despesas em memória ao alimentar o histórico.
+const observeWindow = 50000
+
+// observeByDate passa a fn cada linha válida do CSV em ordem de data. O
+// arquivo não vem ordenado, então uma primeira leitura conta as despesas por
+// dia e as seguintes juntam janelas de dias consecutivos com até window
+// despesas (um dia maior que isso vira janela sozinho), ordenando só a janela.
+func observeByDate(path string, rates *fx.Table, window int, fn func(data.Expense)) error {
+    each := func(fn func(data.Expense)) error {
+        rd, err := data.OpenReader(path, data.NewValidator(rates))
+        if err != nil { return err }
+        defer rd.Close()
+        return rd.Each(func(rec data.Record) error {
+            if e, err := features.ToBase(rates, rec.Expense); err == nil { fn(e) }
+            return nil
+        })
+    }
+    dayOf := func(e data.Expense) int64 { return e.RequestDate.Unix() / 86400 }
+    perDay := map[int64]int{}
+    if err := each(func(e data.Expense) { perDay[dayOf(e)]++ }); err != nil { return err }
+    days := make([]int64, 0, len(perDay))
+    for d := range perDay { days = append(days, d) }
+    slices.Sort(days)
+    for from := 0; from < len(days); {
+        to, n := from, 0
+        for to < len(days) && (to == from || n+perDay[days[to]] <= window) { n += perDay[days[to]]; to++ }
+        first, last := days[from], days[to-1]
+        buf := make([]data.Expense, 0, n)
+        err := each(func(e data.Expense) {
+            if d := dayOf(e); d >= first && d <= last { buf = append(buf, e) }
+        })
+        if err != nil { return err }
+        sort.SliceStable(buf, func(a, b int) bool { return buf[a].RequestDate.Before(buf[b].RequestDate) })
+        for _, e := range buf { fn(e) }
+        from = to
+    }
+    return nil
+}
+
+func conformalCoverage(cf *models.Conformal, X models.Dataset, y []int) (coverage, uncertain float64) {
+    if X.Rows() == 0 { return 0, 0 }
+    covered, unc := 0, 0
+    for from := 0; from < X.Rows(); from += models.PredictBlock {
+        pv := cf.PValues(models.ToDense(X, from, min(from+models.PredictBlock, X.Rows())))
+        for i := range pv {
+            for _, c := range cf.PredictionSet(pv[i]) { if c == y[from+i] { covered++; break } }
+            if cf.Uncertain(pv[i]) { unc++ }
+        }
+    }
+    return float64(covered) / float64(X.Rows()), float64(unc) / float64(X.Rows())
+}
+
+// setOutOfFold grava, a partir da coluna name, os valores fora da fold de
+// cada linha de treino.
+func setOutOfFold(M *data.Matrix, featNames []string, name string, rows []int, oof [][]float64) error {
+    off := slices.Index(featNames, name)
+    if off < 0 { return fmt.Errorf("coluna %q ausente das features", name) }
+    for i, j := range rows {
+        if off+len(oof[i]) > len(featNames) { return fmt.Errorf("coluna %q: %d valores a partir da posição %d excedem %d features", name, len(oof[i]), off, len(featNames)) }
+        M.SetRow(j, off, oof[i])
+    }
+    return nil
+}
+
+func saveGob(path string, v any) error {
+    f, err := os.Create(path)
+    if err != nil { return err }
+    defer f.Close()
+    return gob.NewEncoder(f).Encode(v)
+}
+
+func modelFile(algo string) string {
+    switch algo {
+    case "rf", "gb", "lgbm", "ht", "hat":
+        return "models/" + algo + "_model.gob"
+    case "bagging":
+        return "models/bag_model.gob"
+    default:
+        return "models/dt_model.gob"
+    }
+}
+
+func labeledOnly(y []int, ps []float64) ([]int, []float64) {
+    ly := make([]int, 0, len(y))
+    lp := make([]float64, 0, len(ps))
+    for i := range y {
+        if y[i] == data.LabelUnlabeled { continue }
+        ly = append(ly, y[i])
+        lp = append(lp, ps[i])
+    }
+    return ly, lp
+}
+
+// puMetrics: recall nas fraudes rotuladas é não viesado sob SCAR; r²/P(ŷ=1)
+// (Lee & Liu, 2003) é proporcional ao F1 e a precisão sai de prior·recall/P(ŷ=1).
+func puMetrics(y []int, ps []float64, thr, prior float64) (recall, ppr, leeLiu, precision float64) {
+    if len(y) == 0 { return }
+    pos, tp, predPos := 0, 0, 0
+    for i := range y {
+        pred := ps[i] >= thr
+        if pred { predPos++ }
+        if y[i] == data.LabelFraud {
+            pos++
+            if pred { tp++ }
+        }
+    }
+    ppr = float64(predPos) / float64(len(y))
+    if pos > 0 { recall = float64(tp) / float64(pos) }
+    if ppr > 0 {
+        leeLiu = recall * recall / ppr
+        precision = math.Min(1, prior*recall/ppr)
+    }
+    return
+}
+
+// fitModel treina direto do Dataset quando o modelo sabe lê-lo; os demais
+// (lightgbm) recebem a cópia densa.
+func fitModel(m models.Model, X models.Dataset, y, yType []int) error {
+    mc, multi := m.(models.MultiClassModel)
+    multi = multi && yType != nil
+    if dm, ok := m.(models.DatasetModel); ok {
+        if multi { return dm.FitDataset(X, yType, len(data.FraudTypes), nil) }
+        return dm.FitDataset(X, y, 2, nil)
+    }
+    Xd := models.ToDense(X, 0, X.Rows())
+    if multi { return mc.FitMulti(Xd, yType, len(data.FraudTypes)) }
+    return m.Fit(Xd, y)
+}
+
+func typologyAccuracy(mc models.MultiClassModel, X models.Dataset, yType []int) (float64, int) {
+    cp := models.PredictClassProbaDataset(mc, X)
+    hits, total := 0, 0
+    for i := range cp {
+        if yType[i] == 0 { continue }
+        total++
+        if argmaxFrom(cp[i], 1) == yType[i] { hits++ }
+    }
+    if total == 0 { return 0, 0 }
+    return float64(hits) / float64(total), total
+}
+
+func argmaxFrom(ps []float64, from int) int {
+    best := from
+    for k := from; k < len(ps); k++ { if ps[k] > ps[best] { best = k } }
+    return best
+}
+
 func accuracy(y, p []int) float64 {
     if len(y) == 0 { return 0 }
     c := 0
@@ -299,6 +698,11 @@ func constructModel(algo string, estimators, maxDepth, minSamples int, lr float6
         lgbm.LearningRate = lr
         lgbm.Device = "gpu"
         return lgbm
+    case "ht", "hat":
+        ht := models.NewHoeffdingTree()
+        ht.Adaptive = algo == "hat"
+        ht.MaxDepth = maxDepth
+        return ht
     default:
         dt := models.NewDecisionTree()
         dt.MaxDepth = maxDepth
@@ -0,0 +1,237 @@
+package approvers
+
+import (
+    "math"
+    "math/rand"
+    "sort"
+    "strings"
+    "time"
+
+    "antifraude/internal/data"
+)
+
+// Stats resume o comportamento de um aprovador no treino. Latências em horas,
+// do envio até a decisão.
+type Stats struct {
+    N             int
+    Approved      int
+    Rejected      int
+    Decided       int
+    Fast          int
+    LatencyMedian float64
+    MeanDaily     float64
+    MaxDaily      int
+    ApprovedFraud int
+    latencies     []float64
+    days          map[int32]int
+}
+
+func (s *Stats) add(e data.Expense, fraud int, fast time.Duration) {
+    s.N++
+    switch strings.ToLower(e.ApprovalStatus) {
+    case "aprovado":
+        s.Approved++
+        if fraud == 1 { s.ApprovedFraud++ }
+    case "reprovado":
+        s.Rejected++
+    }
+    if e.ApprovedAt.IsZero() { return }
+    s.Decided++
+    lat := Latency(e)
+    if lat <= fast { s.Fast++ }
+    s.latencies = append(s.latencies, lat.Hours())
+    if s.days == nil { s.days = map[int32]int{} }
+    s.days[int32(e.ApprovedAt.Unix()/86400)]++
+}
+
+func (s *Stats) finish() {
+    if len(s.latencies) > 0 {
+        sort.Float64s(s.latencies)
+        s.LatencyMedian = s.latencies[len(s.latencies)/2]
+    }
+    total := 0
+    for _, c := range s.days {
+        total += c
+        if c > s.MaxDaily { s.MaxDaily = c }
+    }
+    if len(s.days) > 0 { s.MeanDaily = float64(total) / float64(len(s.days)) }
+    s.latencies, s.days = nil, nil
+}
+
+func (s Stats) ApprovalRate() float64 {
+    if s.Approved+s.Rejected == 0 { return 0 }
+    return float64(s.Approved) / float64(s.Approved+s.Rejected)
+}
+
+func (s Stats) FastRate() float64 {
+    if s.Decided == 0 { return 0 }
+    return float64(s.Fast) / float64(s.Decided)
+}
+
+// Spike é o maior volume diário sobre a média dos dias com decisões.
+func (s Stats) Spike() float64 {
+    if s.MeanDaily == 0 { return 0 }
+    return float64(s.MaxDaily) / s.MeanDaily
+}
+
+// Latency é o tempo entre o envio e a decisão; sem submitted_at conta a
+// partir do início do dia da solicitação.
+func Latency(e data.Expense) time.Duration {
+    from := e.SubmittedAt
+    if from.IsZero() { from = e.RequestDate.Truncate(24 * time.Hour) }
+    if e.ApprovedAt.IsZero() || from.IsZero() { return 0 }
+    d := e.ApprovedAt.Sub(from)
+    if d < 0 { return 0 }
+    return d
+}
+
+// Analytics guarda o perfil de cada aprovador. A taxa de fraude entre os
+// itens aprovados é suavizada para a global com Smoothing pseudo-contagens.
+type Analytics struct {
+    Approvers map[string]*Stats
+    Global    Stats
+    Fast      time.Duration
+    Smoothing float64
+    MinN      int
+    Folds     int
+}
+
+func New() *Analytics {
+    return &Analytics{Approvers: map[string]*Stats{}, Fast: 10 * time.Minute, Smoothing: 20, MinN: 20, Folds: 5}
+}
+
+func (a *Analytics) Fit(es []data.Expense, labels []int) {
+    a.Approvers = map[string]*Stats{}
+    a.Global = Stats{}
+    for i, e := range es {
+        if !counted(e) { continue }
+        fraud := 0
+        if labels != nil && labels[i] == 1 { fraud = 1 }
+        st := a.Approvers[e.ApproverID]
+        if st == nil { st = &Stats{}; a.Approvers[e.ApproverID] = st }
+        st.add(e, fraud, a.Fast)
+        a.Global.add(e, fraud, a.Fast)
+    }
+    for _, st := range a.Approvers { st.finish() }
+    a.Global.finish()
+}
+
+// counted diz se a despesa entra no perfil: autoaprovação não conta.
+func counted(e data.Expense) bool { return e.ApproverID != "" && e.ApproverID != e.RequesterID }
+
+func ratio(frauds, approved int) float64 {
+    if approved == 0 { return 0 }
+    return float64(frauds) / float64(approved)
+}
+
+func (a *Analytics) prior() float64 { return ratio(a.Global.ApprovedFraud, a.Global.Approved) }
+
+func (a *Analytics) FraudRate(s Stats) float64 { return a.rate(s.ApprovedFraud, s.Approved, a.prior()) }
+
+func (a *Analytics) rate(frauds, approved int, prior float64) float64 {
+    return (float64(frauds) + a.Smoothing*prior) / (float64(approved) + a.Smoothing)
+}
+
+// Risk combina os sinais de "carimbo" em [0,1]: decisões rápidas, quase tudo
+// aprovado, picos de volume e fraude acima da média entre os aprovados.
+func (a *Analytics) Risk(s Stats) float64 { return a.risk(s, a.FraudRate(s), a.prior()) }
+
+func (a *Analytics) risk(s Stats, fraudRate, prior float64) float64 {
+    clamp := func(v float64) float64 { return math.Max(0, math.Min(1, v)) }
+    r := 0.35 * s.FastRate()
+    r += 0.25 * clamp((s.ApprovalRate()-0.8)/0.2)
+    r += 0.15 * clamp((s.Spike()-1)/4)
+    if prior > 0 { r += 0.25 * clamp(fraudRate/prior-1) }
+    return r
+}
+
+func (a *Analytics) Lookup(id string) (Stats, bool) {
+    if st, ok := a.Approvers[id]; ok && st.N >= a.MinN { return *st, true }
+    return a.Global, false
+}
+
+func (a *Analytics) Names() []string {
+    return []string{"ApvLatenciaHoras", "ApvLatenciaRelativa", "ApvLatenciaMediana", "ApvTaxaAprovacao", "ApvTaxaRapida", "ApvPicoVolume", "ApvTaxaFraudeAprovados", "ApvRisco", "ApvConhecido"}
+}
+
+// TargetNames são as colunas que dependem do rótulo, consecutivas em Names.
+func (a *Analytics) TargetNames() []string { return a.Names()[6:8] }
+
+// tally conta aprovações e fraudes entre elas.
+type tally struct{ approved, frauds int }
+
+func (t tally) add(fraud bool) tally {
+    t.approved++
+    if fraud { t.frauds++ }
+    return t
+}
+
+// OutOfFold devolve a taxa de fraude entre os aprovados e o risco do aprovador
+// de cada linha de treino contando os rótulos sem a própria fold; os demais
+// sinais do perfil não dependem do rótulo e vêm do Fit.
+func (a *Analytics) OutOfFold(es []data.Expense, labels []int, seed int64) [][]float64 {
+    k := a.Folds
+    if k < 2 { k = 2 }
+    fold := make([]int, len(es))
+    for i, j := range rand.New(rand.NewSource(seed)).Perm(len(es)) { fold[j] = i % k }
+    all, global := map[string]tally{}, tally{}
+    byFold, globalFold := make([]map[string]tally, k), make([]tally, k)
+    for f := range byFold { byFold[f] = map[string]tally{} }
+    for i, e := range es {
+        if !counted(e) || strings.ToLower(e.ApprovalStatus) != "aprovado" { continue }
+        fraud := labels != nil && labels[i] == 1
+        f := fold[i]
+        all[e.ApproverID] = all[e.ApproverID].add(fraud)
+        byFold[f][e.ApproverID] = byFold[f][e.ApproverID].add(fraud)
+        global, globalFold[f] = global.add(fraud), globalFold[f].add(fraud)
+    }
+    out := make([][]float64, len(es))
+    for i, e := range es {
+        f := fold[i]
+        prior := ratio(global.frauds-globalFold[f].frauds, global.approved-globalFold[f].approved)
+        st, known := a.Lookup(e.ApproverID)
+        c, cf := global, globalFold[f]
+        if known { c, cf = all[e.ApproverID], byFold[f][e.ApproverID] }
+        fr := a.rate(c.frauds-cf.frauds, c.approved-cf.approved, prior)
+        out[i] = []float64{fr, a.risk(st, fr, prior)}
+    }
+    return out
+}
+
+func (a *Analytics) Transform(e data.Expense) []float64 {
+    st, known := a.Lookup(e.ApproverID)
+    lat := Latency(e).Hours()
+    rel := 0.0
+    if st.LatencyMedian > 0 && !e.ApprovedAt.IsZero() { rel = lat / st.LatencyMedian }
+    k := 0.0
+    if known { k = 1 }
+    return []float64{lat, rel, st.LatencyMedian, st.ApprovalRate(), st.FastRate(), st.Spike(), a.FraudRate(st), a.Risk(st), k}
+}
+
+type Row struct {
+    ApproverID    string  `json:"approver_id"`
+    N             int     `json:"n"`
+    ApprovalRate  float64 `json:"approval_rate"`
+    LatencyMedian float64 `json:"latency_median_hours"`
+    FastRate      float64 `json:"fast_rate"`
+    MaxDaily      int     `json:"max_daily"`
+    Spike         float64 `json:"spike"`
+    FraudRate     float64 `json:"approved_fraud_rate"`
+    Risk          float64 `json:"risk"`
+}
+
+// AtRisk lista os aprovadores com pelo menos MinN despesas, do maior risco
+// para o menor.
+func (a *Analytics) AtRisk(limit int) []Row {
+    var rows []Row
+    for id, st := range a.Approvers {
+        if st.N < a.MinN { continue }
+        rows = append(rows, Row{ApproverID: id, N: st.N, ApprovalRate: st.ApprovalRate(), LatencyMedian: st.LatencyMedian, FastRate: st.FastRate(), MaxDaily: st.MaxDaily, Spike: st.Spike(), FraudRate: a.FraudRate(*st), Risk: a.Risk(*st)})
+    }
+    sort.Slice(rows, func(i, j int) bool {
+        if rows[i].Risk != rows[j].Risk { return rows[i].Risk > rows[j].Risk }
+        return rows[i].ApproverID < rows[j].ApproverID
+    })
+    if limit > 0 && len(rows) > limit { rows = rows[:limit] }
+    return rows
+}
@@ -0,0 +1,62 @@
+package approvers
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "testing"
+
+    "antifraude/internal/data"
+)
+
+// A taxa fora da fold de cada linha tem de bater com a recontagem só das
+// linhas de outras folds (mesma permutação de OutOfFold).
+func TestOutOfFoldMatchesOtherFolds(t *testing.T) {
+    profiles := []struct {
+        id        string
+        n         int
+        fraudRate float64
+        status    string
+    }{
+        {"carimbo", 60, 0.6, "Aprovado"},
+        {"rigoroso", 60, 0.02, "Aprovado"},
+        {"novato", 8, 0.5, "Aprovado"},
+        {"reprova", 30, 0.3, "Reprovado"},
+    }
+    rng := rand.New(rand.NewSource(5))
+    var es []data.Expense
+    var labels []int
+    for _, p := range profiles {
+        for i := 0; i < p.n; i++ {
+            es = append(es, data.Expense{RequesterID: fmt.Sprint("u", i%7), ApproverID: p.id, ApprovalStatus: p.status})
+            l := 0
+            if rng.Float64() < p.fraudRate { l = 1 }
+            labels = append(labels, l)
+        }
+    }
+    // autoaprovação não entra em nenhuma conta
+    es = append(es, data.Expense{RequesterID: "carimbo", ApproverID: "carimbo", ApprovalStatus: "Aprovado"})
+    labels = append(labels, 1)
+
+    a := New()
+    a.Fit(es, labels)
+    const seed = 9
+    oof := a.OutOfFold(es, labels, seed)
+    fold := make([]int, len(es))
+    for i, j := range rand.New(rand.NewSource(seed)).Perm(len(es)) { fold[j] = i % a.Folds }
+    for i, e := range es {
+        _, known := a.Lookup(e.ApproverID)
+        var approved, frauds, gApproved, gFrauds int
+        for j, o := range es {
+            if fold[j] == fold[i] || !counted(o) || o.ApprovalStatus != "Aprovado" { continue }
+            gApproved++
+            gFrauds += labels[j]
+            if o.ApproverID == e.ApproverID { approved++; frauds += labels[j] }
+        }
+        prior := ratio(gFrauds, gApproved)
+        if !known { approved, frauds = gApproved, gFrauds }
+        want := a.rate(frauds, approved, prior)
+        if math.Abs(oof[i][0]-want) > 1e-12 { t.Errorf("linha %d (%s): taxa %.4f, recontagem %.4f", i, e.ApproverID, oof[i][0], want) }
+        if oof[i][1] < 0 || oof[i][1] > 1 { t.Errorf("linha %d: risco %.3f fora de [0,1]", i, oof[i][1]) }
+    }
+}
@@ -0,0 +1,193 @@
+package benford
+
+import (
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "antifraude/internal/data"
+)
+
+// FirstExpected e SecondExpected são as proporções da lei de Benford para o
+// primeiro dígito (1-9) e o segundo dígito (0-9).
+var FirstExpected, SecondExpected [10]float64
+
+func init() {
+    for d := 1; d <= 9; d++ { FirstExpected[d] = math.Log10(1 + 1/float64(d)) }
+    for d := 0; d <= 9; d++ {
+        for f := 1; f <= 9; f++ { SecondExpected[d] += math.Log10(1 + 1/float64(10*f+d)) }
+    }
+}
+
+// digits devolve os dois primeiros dígitos significativos; ok=false para
+// valores não positivos ou menores que 10 (sem segundo dígito confiável).
+func digits(amount float64) (first, second int, ok bool) {
+    if amount < 10 { return 0, 0, false }
+    s := strconv.FormatFloat(math.Trunc(amount), 'f', 0, 64)
+    return int(s[0] - '0'), int(s[1] - '0'), true
+}
+
+type Stats struct {
+    N       int
+    First   [10]int
+    Second  [10]int
+    Round   int
+    Round10 int
+    Total   int
+}
+
+func (s *Stats) Add(amount float64) {
+    s.Total++
+    if amount > 0 && amount == math.Trunc(amount) {
+        s.Round++
+        if int64(amount)%10 == 0 { s.Round10++ }
+    }
+    f, d, ok := digits(amount)
+    if !ok { return }
+    s.N++
+    s.First[f]++
+    s.Second[d]++
+}
+
+func fit(counts [10]int, n int, expected [10]float64, from int) (chi2, mad float64) {
+    if n == 0 { return 0, 0 }
+    for d := from; d <= 9; d++ {
+        exp := expected[d] * float64(n)
+        diff := float64(counts[d]) - exp
+        chi2 += diff * diff / exp
+        mad += math.Abs(float64(counts[d])/float64(n) - expected[d])
+    }
+    return chi2, mad / float64(10-from)
+}
+
+func (s *Stats) FirstDigit() (chi2, mad float64)  { return fit(s.First, s.N, FirstExpected, 1) }
+func (s *Stats) SecondDigit() (chi2, mad float64) { return fit(s.Second, s.N, SecondExpected, 0) }
+
+func (s *Stats) RoundRate() float64 {
+    if s.Total == 0 { return 0 }
+    return float64(s.Round) / float64(s.Total)
+}
+
+func (s *Stats) Round10Rate() float64 {
+    if s.Total == 0 { return 0 }
+    return float64(s.Round10) / float64(s.Total)
+}
+
+// Conformity classifica o MAD do primeiro dígito pelas faixas de Nigrini.
+func (s *Stats) Conformity() string {
+    _, mad := s.FirstDigit()
+    switch {
+    case mad < 0.006:
+        return "conformidade próxima"
+    case mad < 0.012:
+        return "conformidade aceitável"
+    case mad < 0.015:
+        return "conformidade marginal"
+    default:
+        return "não conformidade"
+    }
+}
+
+var Groups = []string{"requester", "approver", "department"}
+
+func groupKey(group string, e data.Expense) string {
+    switch group {
+    case "requester":
+        return e.RequesterID
+    case "approver":
+        return e.ApproverID
+    default:
+        return strings.ToLower(e.Department)
+    }
+}
+
+// Profile acumula as estatísticas por solicitante, aprovador e departamento
+// para despesas solicitadas dentro do período [From, To].
+type Profile struct {
+    From   time.Time
+    To     time.Time
+    MinN   int
+    Global Stats
+    ByKey  map[string]map[string]*Stats
+}
+
+func NewProfile() *Profile {
+    return &Profile{MinN: 30}
+}
+
+func (p *Profile) Fit(es []data.Expense, labels []int) {
+    p.Global = Stats{}
+    p.ByKey = map[string]map[string]*Stats{}
+    for _, g := range Groups { p.ByKey[g] = map[string]*Stats{} }
+    for _, e := range es {
+        if !p.From.IsZero() && e.RequestDate.Before(p.From) { continue }
+        if !p.To.IsZero() && e.RequestDate.After(p.To) { continue }
+        p.Global.Add(e.Amount)
+        for _, g := range Groups {
+            k := groupKey(g, e)
+            st := p.ByKey[g][k]
+            if st == nil { st = &Stats{}; p.ByKey[g][k] = st }
+            st.Add(e.Amount)
+        }
+    }
+}
+
+// Lookup devolve as estatísticas do grupo, ou as globais quando há poucas
+// despesas para um teste de Benford significativo.
+func (p *Profile) Lookup(group, key string) *Stats {
+    if st := p.ByKey[group][key]; st != nil && st.N >= p.MinN { return st }
+    return &p.Global
+}
+
+func (p *Profile) Names() []string {
+    names := []string{}
+    for _, g := range Groups {
+        names = append(names, "Benford_"+g+"_mad1", "Benford_"+g+"_mad2", "Benford_"+g+"_chi2_1", "Benford_"+g+"_redondos")
+    }
+    return names
+}
+
+func (p *Profile) Transform(e data.Expense) []float64 {
+    out := make([]float64, 0, 4*len(Groups))
+    for _, g := range Groups {
+        st := p.Lookup(g, groupKey(g, e))
+        chi1, mad1 := st.FirstDigit()
+        _, mad2 := st.SecondDigit()
+        // chi² cresce com N; normalizado para ficar comparável entre grupos
+        norm := 0.0
+        if st.N > 0 { norm = chi1 / float64(st.N) }
+        out = append(out, mad1, mad2, norm, st.RoundRate())
+    }
+    return out
+}
+
+type Row struct {
+    Key        string
+    N          int
+    Chi2First  float64
+    MADFirst   float64
+    Chi2Second float64
+    MADSecond  float64
+    RoundRate  float64
+    Round10    float64
+    Conformity string
+}
+
+// Report lista as entidades do grupo com ao menos MinN valores, da menor
+// para a maior conformidade (MAD do primeiro dígito decrescente).
+func (p *Profile) Report(group string) []Row {
+    rows := []Row{}
+    for k, st := range p.ByKey[group] {
+        if st.N < p.MinN { continue }
+        c1, m1 := st.FirstDigit()
+        c2, m2 := st.SecondDigit()
+        rows = append(rows, Row{Key: k, N: st.N, Chi2First: c1, MADFirst: m1, Chi2Second: c2, MADSecond: m2, RoundRate: st.RoundRate(), Round10: st.Round10Rate(), Conformity: st.Conformity()})
+    }
+    sort.Slice(rows, func(i, j int) bool {
+        if rows[i].MADFirst != rows[j].MADFirst { return rows[i].MADFirst > rows[j].MADFirst }
+        return rows[i].Key < rows[j].Key
+    })
+    return rows
+}
@@ -0,0 +1,62 @@
+package benford
+
+import (
+    "math"
+    "testing"
+)
+
+// shifted monta contagens do primeiro dígito seguindo Benford, com delta da
+// proporção movida do dígito 1 para o 9; o MAD resultante é 2*delta/9.
+func shifted(delta float64) *Stats {
+    const n = 1000000
+    s := &Stats{N: n, Total: n}
+    for d := 1; d <= 9; d++ {
+        p := FirstExpected[d]
+        switch d {
+        case 1:
+            p -= delta
+        case 9:
+            p += delta
+        }
+        s.First[d] = int(math.Round(p * n))
+    }
+    return s
+}
+
+func TestConformityBands(t *testing.T) {
+    for _, c := range []struct {
+        mad  float64
+        band string
+    }{
+        {0, "conformidade próxima"},
+        {0.005, "conformidade próxima"},
+        {0.007, "conformidade aceitável"},
+        {0.011, "conformidade aceitável"},
+        {0.013, "conformidade marginal"},
+        {0.016, "não conformidade"},
+        {0.04, "não conformidade"},
+    } {
+        s := shifted(c.mad * 9 / 2)
+        _, mad := s.FirstDigit()
+        if math.Abs(mad-c.mad) > 1e-4 { t.Fatalf("MAD montado = %.5f, esperado %.5f", mad, c.mad) }
+        if got := s.Conformity(); got != c.band { t.Errorf("MAD %.3f: %q, esperado %q", c.mad, got, c.band) }
+    }
+}
+
+func TestDigits(t *testing.T) {
+    for _, c := range []struct {
+        amount        float64
+        first, second int
+        ok            bool
+    }{
+        {9.99, 0, 0, false},
+        {-150, 0, 0, false},
+        {10, 1, 0, true},
+        {19.99, 1, 9, true},
+        {4730.5, 4, 7, true},
+        {987654321, 9, 8, true},
+    } {
+        f, s, ok := digits(c.amount)
+        if f != c.first || s != c.second || ok != c.ok { t.Errorf("digits(%v) = %d, %d, %v", c.amount, f, s, ok) }
+    }
+}
@@ -0,0 +1,220 @@
+package calendar
+
+import (
+    "crypto/sha256"
+    "encoding/csv"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "antifraude/internal/data"
+    "antifraude/internal/policy"
+)
+
+// Holiday é um feriado fixo (Year == 0, repete todo ano) ou de data única.
+// Scope vazio vale para todo o país; "SP" para as cidades do estado e
+// "São Paulo/SP" só para a cidade.
+type Holiday struct {
+    Year  int
+    Month time.Month
+    Day   int
+    Name  string
+    Scope string
+}
+
+var national = []Holiday{
+    {Month: time.January, Day: 1, Name: "Confraternização Universal"},
+    {Month: time.April, Day: 21, Name: "Tiradentes"},
+    {Month: time.May, Day: 1, Name: "Dia do Trabalho"},
+    {Month: time.September, Day: 7, Name: "Independência"},
+    {Month: time.October, Day: 12, Name: "Nossa Senhora Aparecida"},
+    {Month: time.November, Day: 2, Name: "Finados"},
+    {Month: time.November, Day: 15, Name: "Proclamação da República"},
+    {Month: time.November, Day: 20, Name: "Consciência Negra"},
+    {Month: time.December, Day: 25, Name: "Natal"},
+}
+
+// cityStates dá a UF das cidades de data/city_distances.csv, para casar os
+// feriados estaduais quando a cidade da despesa vem sem UF.
+var cityStates = map[string]string{
+    "aracaju": "SE", "belo horizonte": "MG", "brasilia": "DF", "campinas": "SP", "curitiba": "PR",
+    "florianopolis": "SC", "fortaleza": "CE", "goiania": "GO", "joao pessoa": "PB", "natal": "RN",
+    "porto alegre": "RS", "recife": "PE", "ribeirao preto": "SP", "rio de janeiro": "RJ", "salvador": "BA",
+    "santos": "SP", "sao paulo": "SP", "vitoria": "ES",
+}
+
+// stateOf devolve a UF escrita na cidade ("Santos/SP", "Santos - SP") ou a
+// de cityStates; vazio se desconhecida.
+func stateOf(city string) string {
+    s := strings.TrimSpace(city)
+    if i := strings.LastIndexAny(s, "/,-"); i >= 0 {
+        if uf := strings.ToUpper(strings.TrimSpace(s[i+1:])); len(uf) == 2 { return uf }
+    }
+    return cityStates[policy.CityKey(s)]
+}
+
+// inScope diz se o feriado de escopo scope vale em city.
+func inScope(scope, city string) bool {
+    uf := stateOf(city)
+    if s := strings.TrimSpace(scope); len(s) == 2 { return uf != "" && strings.EqualFold(s, uf) }
+    if policy.CityKey(scope) != policy.CityKey(city) { return false }
+    su := stateOf(scope)
+    return su == "" || uf == "" || su == uf
+}
+
+// Calendar reúne os feriados nacionais (fixos e móveis) e os estaduais ou
+// municipais configurados. Vai serializado junto com o vetorizador, então o
+// modelo sempre usa o calendário com que foi treinado.
+type Calendar struct {
+    Extra   []Holiday
+    Version string
+    mu      sync.Mutex
+    years   map[int]map[string]string
+}
+
+func New() *Calendar {
+    c := &Calendar{}
+    c.Version = c.version()
+    return c
+}
+
+// LoadExtra lê feriados adicionais de um CSV date,name,scope; date aceita
+// MM-DD (todo ano) ou YYYY-MM-DD (data única).
+func (c *Calendar) LoadExtra(path string) error {
+    f, err := os.Open(path)
+    if err != nil { return err }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil { return err }
+    for i, row := range rows {
+        if i == 0 && strings.EqualFold(row[0], "date") { continue }
+        if len(row) < 2 { return fmt.Errorf("linha %d: esperado date,name[,scope]", i+1) }
+        h := Holiday{Name: row[1]}
+        if len(row) > 2 { h.Scope = row[2] }
+        if t, err := time.Parse("2006-01-02", row[0]); err == nil {
+            h.Year, h.Month, h.Day = t.Year(), t.Month(), t.Day()
+        } else if t, err := time.Parse("01-02", row[0]); err == nil {
+            h.Month, h.Day = t.Month(), t.Day()
+        } else {
+            return fmt.Errorf("linha %d: data inválida %q", i+1, row[0])
+        }
+        c.Extra = append(c.Extra, h)
+    }
+    c.mu.Lock()
+    c.years = nil
+    c.mu.Unlock()
+    c.Version = c.version()
+    return nil
+}
+
+func (c *Calendar) version() string {
+    lines := []string{}
+    for _, h := range c.Extra { lines = append(lines, fmt.Sprintf("%04d-%02d-%02d|%s|%s", h.Year, h.Month, h.Day, h.Name, h.Scope)) }
+    sort.Strings(lines)
+    sum := sha256.Sum256([]byte("nacional-v2\n" + strings.Join(lines, "\n")))
+    return hex.EncodeToString(sum[:6])
+}
+
+// Easter calcula o domingo de Páscoa (algoritmo de Meeus/Jones/Butcher).
+func Easter(year int) time.Time {
+    a := year % 19
+    b, cc := year/100, year%100
+    d, e := b/4, b%4
+    f := (b + 8) / 25
+    g := (b - f + 1) / 3
+    h := (19*a + b - d - g + 15) % 30
+    i, k := cc/4, cc%4
+    l := (32 + 2*e + 2*i - h - k) % 7
+    m := (a + 11*h + 22*l) / 451
+    month := (h + l - 7*m + 114) / 31
+    day := (h+l-7*m+114)%31 + 1
+    return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+func key(t time.Time) string { return t.Format("2006-01-02") }
+
+func (c *Calendar) holidays(year int) map[string]string {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if hs, ok := c.years[year]; ok { return hs }
+    hs := map[string]string{}
+    for _, h := range national { hs[key(time.Date(year, h.Month, h.Day, 0, 0, 0, 0, time.UTC))] = h.Name }
+    easter := Easter(year)
+    hs[key(easter.AddDate(0, 0, -48))] = "Carnaval"
+    hs[key(easter.AddDate(0, 0, -47))] = "Carnaval"
+    hs[key(easter.AddDate(0, 0, -2))] = "Sexta-feira Santa"
+    hs[key(easter.AddDate(0, 0, 60))] = "Corpus Christi"
+    for _, h := range c.Extra {
+        if h.Scope != "" || (h.Year != 0 && h.Year != year) { continue }
+        hs[key(time.Date(year, h.Month, h.Day, 0, 0, 0, 0, time.UTC))] = h.Name
+    }
+    if c.years == nil { c.years = map[int]map[string]string{} }
+    c.years[year] = hs
+    return hs
+}
+
+// Holiday devolve o feriado nacional (ou extra sem escopo) em t.
+func (c *Calendar) Holiday(t time.Time) (string, bool) { return c.HolidayIn(t, "") }
+
+// HolidayIn soma aos nacionais os feriados estaduais e municipais de city;
+// cidade vazia ou de UF desconhecida fica só com os nacionais.
+func (c *Calendar) HolidayIn(t time.Time, city string) (string, bool) {
+    if name, ok := c.holidays(t.Year())[key(t)]; ok { return name, true }
+    if city == "" { return "", false }
+    for _, h := range c.Extra {
+        if h.Scope == "" || h.Month != t.Month() || h.Day != t.Day() || (h.Year != 0 && h.Year != t.Year()) { continue }
+        if inScope(h.Scope, city) { return h.Name, true }
+    }
+    return "", false
+}
+
+func IsWeekend(t time.Time) bool { return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday }
+
+func (c *Calendar) dayOff(t time.Time, city string) bool {
+    _, h := c.HolidayIn(t, city)
+    return h || IsWeekend(t)
+}
+
+// IsBridge indica um dia útil espremido entre um feriado e o fim de semana
+// (a "ponte"), como a segunda antes de um feriado na terça, considerando os
+// feriados locais de city.
+func (c *Calendar) IsBridge(t time.Time, city string) bool {
+    if c.dayOff(t, city) { return false }
+    prev, next := t.AddDate(0, 0, -1), t.AddDate(0, 0, 1)
+    _, hp := c.HolidayIn(prev, city)
+    _, hn := c.HolidayIn(next, city)
+    return (hp && IsWeekend(next)) || (hn && IsWeekend(prev))
+}
+
+// IsMonthEnd considera os três últimos dias do mês, quando se concentram os
+// fechamentos de reembolso.
+func IsMonthEnd(t time.Time) bool {
+    return t.AddDate(0, 0, 3).Month() != t.Month()
+}
+
+func (c *Calendar) Names() []string {
+    return []string{"CalViagemFimDeSemana", "CalViagemFeriado", "CalViagemPonte", "CalDiaSemanaViagem", "CalSolicitacaoFimDeSemana", "CalSolicitacaoFeriado", "CalSolicitacaoFimDeMes", "CalDiaSemanaSolicitacao"}
+}
+
+// Transform olha os feriados locais do destino na data da viagem e os da
+// origem (a base do solicitante) na data da solicitação.
+func (c *Calendar) Transform(e data.Expense) []float64 {
+    travel, request := e.TravelDate, e.RequestDate
+    b := func(v bool) float64 { if v { return 1 }; return 0 }
+    _, travelHoliday := c.HolidayIn(travel, e.Destination)
+    _, requestHoliday := c.HolidayIn(request, e.Origin)
+    return []float64{
+        b(IsWeekend(travel)),
+        b(travelHoliday),
+        b(c.IsBridge(travel, e.Destination)),
+        float64(travel.Weekday()),
+        b(IsWeekend(request)),
+        b(requestHoliday),
+        b(IsMonthEnd(request)),
+        float64(request.Weekday()),
+    }
+}
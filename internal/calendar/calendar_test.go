@@ -0,0 +1,74 @@
+package calendar
+
+import (
+    "testing"
+    "time"
+)
+
+func date(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+func TestEaster(t *testing.T) {
+    want := map[int]time.Time{
+        2000: date(2000, time.April, 23),
+        2019: date(2019, time.April, 21),
+        2024: date(2024, time.March, 31),
+        2025: date(2025, time.April, 20),
+        2026: date(2026, time.April, 5),
+        2038: date(2038, time.April, 25),
+    }
+    for year, d := range want {
+        if got := Easter(year); !got.Equal(d) { t.Errorf("Easter(%d) = %s, esperado %s", year, got.Format("2006-01-02"), d.Format("2006-01-02")) }
+    }
+}
+
+func TestMoveableHolidays(t *testing.T) {
+    c := New()
+    for _, tc := range []struct {
+        day  time.Time
+        name string
+    }{
+        {date(2024, time.February, 12), "Carnaval"},
+        {date(2024, time.February, 13), "Carnaval"},
+        {date(2024, time.March, 29), "Sexta-feira Santa"},
+        {date(2024, time.May, 30), "Corpus Christi"},
+        {date(2025, time.March, 3), "Carnaval"},
+        {date(2025, time.March, 4), "Carnaval"},
+        {date(2025, time.June, 19), "Corpus Christi"},
+        {date(2026, time.June, 4), "Corpus Christi"},
+        {date(2024, time.February, 14), ""},
+        {date(2025, time.June, 20), ""},
+    } {
+        name, ok := c.Holiday(tc.day)
+        if name != tc.name || ok != (tc.name != "") { t.Errorf("Holiday(%s) = %q, %v; esperado %q", tc.day.Format("2006-01-02"), name, ok, tc.name) }
+    }
+}
+
+// Feriado estadual ou municipal só vale para cidades daquele escopo, também
+// no cálculo da ponte.
+func TestScopedHolidays(t *testing.T) {
+    c := New()
+    c.Extra = []Holiday{
+        {Month: time.January, Day: 25, Name: "Aniversário de São Paulo", Scope: "São Paulo/SP"},
+        {Month: time.July, Day: 9, Name: "Revolução Constitucionalista", Scope: "SP"},
+    }
+    cases := []struct {
+        day     time.Time
+        city    string
+        holiday bool
+    }{
+        {date(2024, time.January, 25), "São Paulo", true},
+        {date(2024, time.January, 25), "Sao Paulo - SP", true},
+        {date(2024, time.January, 25), "Campinas", false},
+        {date(2024, time.July, 9), "Santos", true},
+        {date(2024, time.July, 9), "Ribeirão Preto/SP", true},
+        {date(2024, time.July, 9), "Rio de Janeiro", false},
+        {date(2024, time.July, 9), "", false},
+    }
+    for _, tc := range cases {
+        if _, ok := c.HolidayIn(tc.day, tc.city); ok != tc.holiday { t.Errorf("HolidayIn(%s, %q) = %v", tc.day.Format("01-02"), tc.city, ok) }
+    }
+    // 2024-07-09 é terça: a segunda só é ponte onde o feriado vale
+    if monday := date(2024, time.July, 8); !c.IsBridge(monday, "Santos") || c.IsBridge(monday, "Curitiba") {
+        t.Errorf("IsBridge(07-08): Santos %v, Curitiba %v", c.IsBridge(monday, "Santos"), c.IsBridge(monday, "Curitiba"))
+    }
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"encoding/csv"
+	"math/rand"
+	"os"
+	"strconv"
+)
+
+// DistancesPath é a tabela de distâncias usada para sortear os trechos das
+// viagens; sem ela as despesas saem sem origem e destino.
+var DistancesPath = "data/city_distances.csv"
+
+// mileageRate acompanha a taxa padrão de quilometragem da política (R$/km).
+const mileageRate = 1.10
+
+type route struct {
+    from, to string
+    km       float64
+}
+
+// syntheticRoutes guarda os trechos da tabela; cada solicitante tem uma cidade
+// base e viaja por trechos que partem dela.
+type syntheticRoutes struct {
+    routes []route
+    from   map[string][]route
+    cities []string
+    home   map[string]string
+}
+
+func loadSyntheticRoutes(path string) *syntheticRoutes {
+    r := &syntheticRoutes{from: map[string][]route{}, home: map[string]string{}}
+    f, err := os.Open(path)
+    if err != nil {
+        return r
+    }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil {
+        return r
+    }
+    for i, row := range rows {
+        if i == 0 || len(row) < 3 {
+            continue
+        }
+        km, err := strconv.ParseFloat(row[2], 64)
+        if err != nil {
+            continue
+        }
+        for _, rt := range []route{{row[0], row[1], km}, {row[1], row[0], km}} {
+            if len(r.from[rt.from]) == 0 { r.cities = append(r.cities, rt.from) }
+            r.from[rt.from] = append(r.from[rt.from], rt)
+        }
+    }
+    return r
+}
+
+// pick sorteia o trecho da viagem do solicitante; parte das despesas sai sem
+// cidades, como nos CSVs antigos.
+func (r *syntheticRoutes) pick(requesterID string) (route, bool) {
+    if len(r.cities) == 0 || rand.Float64() < 0.3 {
+        return route{}, false
+    }
+    home, ok := r.home[requesterID]
+    if !ok {
+        home = r.cities[rand.Intn(len(r.cities))]
+        r.home[requesterID] = home
+    }
+    rts := r.from[home]
+    return rts[rand.Intn(len(rts))], true
+}
+
+// mileage monta um reembolso de quilometragem do trecho; inflado multiplica o
+// valor devido por 1,6 a 3.
+func mileage(rt route, inflated bool) (string, float64) {
+    desc, km := "transporte quilometragem", rt.km
+    if rand.Float64() < 0.5 {
+        desc += " ida e volta"
+        km *= 2
+    }
+    amount := km * mileageRate * (0.9 + 0.15*rand.Float64())
+    if inflated {
+        amount = km * mileageRate * (1.6 + 1.4*rand.Float64())
+    }
+    return desc, amount
+}
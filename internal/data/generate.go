@@ -2,17 +2,28 @@ package data
 
 import (
 	"encoding/csv"
+	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"antifraude/internal/fx"
 )
 
 var categories = []string{"Alimentação", "Transporte", "Taxi", "Pedágio", "Hospedagem"}
 var departments = []string{"Financeiro", "Comercial", "Operações", "Tecnologia", "RH"}
 var jobTitles = []string{"Analista", "Coordenador", "Gerente", "Especialista", "Diretor"}
 
+// FXRatesPath é a tabela de câmbio usada para gerar viagens internacionais;
+// se o arquivo não existir, todas as despesas saem em BRL.
+var FXRatesPath = "data/fx_rates.csv"
+
+// OrgChartPath recebe o cadastro de RH sintético gerado junto com as despesas.
+var OrgChartPath = "data/hr_employees.csv"
+
 func GenerateSyntheticExpenses(n int, fraudRate float64, outPath string) error {
     if err := os.MkdirAll("data", 0o755); err != nil {
         return err
@@ -26,23 +37,62 @@ func GenerateSyntheticExpenses(n int, fraudRate float64, outPath string) error {
     w := csv.NewWriter(f)
     defer w.Flush()
 
-    header := []string{"expense_id", "request_id", "requester_id", "traveller_id", "approver_id", "request_date", "travel_date", "category", "description", "amount", "currency", "job_title", "department", "approval_status", "fraud"}
+    header := []string{"expense_id", "request_id", "requester_id", "traveller_id", "approver_id", "request_date", "travel_date", "category", "description", "amount", "currency", "job_title", "department", "approval_status", "fraud", "fraud_type", "submitted_at", "approved_at", "merchant", "merchant_cnpj", "origin_city", "destination_city"}
     if err := w.Write(header); err != nil {
         return err
     }
 
     rand.Seed(time.Now().UnixNano())
     baseDate := time.Now().AddDate(-1, 0, 0)
+    var foreign []string
+    fxTable, err := fx.Load(FXRatesPath)
+    if err == nil { foreign = fxTable.Currencies()[1:] }
 
+    org := newSyntheticOrg(baseDate)
+    if err := org.write(OrgChartPath); err != nil {
+        return err
+    }
+    routes := loadSyntheticRoutes(DistancesPath)
+    merchants := newSyntheticMerchants()
+    if err := merchants.write(MerchantListPath); err != nil {
+        return err
+    }
+
+    var prev []string
     for i := 0; i < n; i++ {
         expenseID := "E" + strconv.Itoa(1000000+i)
+        if prev != nil && rand.Float64() < 0.015 {
+            if err := w.Write(duplicateClaim(prev, expenseID)); err != nil {
+                return err
+            }
+            continue
+        }
+        if i+1 < n && rand.Float64() < 0.015 {
+            parts := splitPurchase(expenseID, "R"+strconv.Itoa(500000+i), baseDate, org, merchants, routes)
+            if len(parts) > n-i { parts = parts[:n-i] }
+            for k, rec := range parts {
+                rec[0] = "E" + strconv.Itoa(1000000+i+k)
+                if err := w.Write(rec); err != nil {
+                    return err
+                }
+            }
+            i += len(parts) - 1
+            continue
+        }
+
         requestID := "R" + strconv.Itoa(500000+i)
         requesterID := "U" + strconv.Itoa(rand.Intn(5000))
         travellerID := requesterID
         if rand.Float64() < 0.2 {
             travellerID = "U" + strconv.Itoa(rand.Intn(5000))
         }
-        approverID := "A" + strconv.Itoa(rand.Intn(800))
+        if rand.Float64() < 0.01 {
+            travellerID = "V" + strconv.Itoa(rand.Intn(500))
+        }
+        approverID := org.manager[requesterID]
+        if rand.Float64() < 0.1 {
+            approverID = "A" + strconv.Itoa(rand.Intn(800))
+        }
         if rand.Float64() < 0.03 {
             approverID = requesterID
         }
@@ -69,9 +119,16 @@ func GenerateSyntheticExpenses(n int, fraudRate float64, outPath string) error {
         if multiple5 {
             amount = float64(5 * int(amount/5))
         }
+        rt, hasRoute := routes.pick(requesterID)
+        isMileage, inflatedMileage := false, false
+        if hasRoute && cat == "Transporte" && rand.Float64() < 0.4 {
+            isMileage, inflatedMileage = true, rand.Float64() < 0.2
+            desc, amount = mileage(rt, inflatedMileage)
+            round, multiple5 = false, false
+        }
 
-        job := jobTitles[rand.Intn(len(jobTitles))]
-        dept := departments[rand.Intn(len(departments))]
+        job := org.title[requesterID]
+        dept := org.dept[requesterID]
 
         status := "Aprovado"
         if rand.Float64() < 0.1 {
@@ -79,8 +136,12 @@ func GenerateSyntheticExpenses(n int, fraudRate float64, outPath string) error {
         } else if rand.Float64() < 0.1 {
             status = "Pendente"
         }
+        if org.rubber[approverID] && status == "Reprovado" {
+            status = "Aprovado"
+        }
 
         fraud := 0
+        fraudType := FraudNone
         score := 0.0
         flags := 0
         if requesterID == approverID {
@@ -107,12 +168,57 @@ func GenerateSyntheticExpenses(n int, fraudRate float64, outPath string) error {
             score += 0.2
             flags++
         }
+        if approverID != requesterID && !org.activeAt(approverID, reqDate) || !org.activeAt(requesterID, reqDate) {
+            score += 0.2
+            flags++
+        }
+        if _, ok := org.title[travellerID]; !ok || !org.activeAt(travellerID, travelDate) {
+            score += 0.2
+            flags++
+        }
+        if org.rubber[approverID] {
+            score += 0.1
+        }
+        if inflatedMileage {
+            score += 0.3
+            flags++
+        }
+        if approverID != requesterID && approverID != org.manager[requesterID] {
+            if jobRank[org.title[approverID]] < jobRank[job] {
+                score += 0.2
+                flags++
+            } else if org.dept[approverID] != dept {
+                score += 0.1
+            }
+        }
         base := fraudRate
         if flags >= 2 || travelDate.Before(reqDate) {
             fraud = 1
         } else if rand.Float64() < base+score {
             fraud = 1
         }
+        if fraud == 1 {
+            switch {
+            case requesterID == approverID:
+                fraudType = FraudSelfApproval
+            case travelDate.Before(reqDate):
+                fraudType = FraudDateTampering
+            case cat == "Taxi" && amount > 200:
+                fraudType = FraudInflatedTaxi
+            case inflatedMileage:
+                fraudType = FraudMileage
+            default:
+                fraudType = FraudOther
+            }
+        }
+
+        if len(foreign) > 0 && !isMileage && rand.Float64() < 0.05 {
+            hasRoute = false
+            currency = foreign[rand.Intn(len(foreign))]
+            r, _ := fxTable.Rate(currency, travelDate)
+            amount /= r
+            desc += " internacional"
+        }
 
         rec := []string{
             expenseID,
@@ -130,10 +236,200 @@ func GenerateSyntheticExpenses(n int, fraudRate float64, outPath string) error {
             dept,
             status,
             strconv.Itoa(fraud),
+            fraudType,
+        }
+        rec = append(rec, org.approvalTimes(approverID, reqDate, status)...)
+        rec = append(rec, merchants.pick(cat, fraud)...)
+        if hasRoute {
+            rec = append(rec, rt.from, rt.to)
+        } else {
+            rec = append(rec, "", "")
         }
         if err := w.Write(rec); err != nil {
             return err
         }
+        prev = rec
+    }
+    return nil
+}
+
+var splitLimits = map[string]float64{"Alimentação": 300, "Transporte": 800, "Taxi": 300, "Pedágio": 200, "Hospedagem": 600}
+
+func duplicateClaim(orig []string, expenseID string) []string {
+    rec := append([]string(nil), orig...)
+    rec[0] = expenseID
+    amount, _ := strconv.ParseFloat(orig[9], 64)
+    if rand.Float64() < 0.6 {
+        amount += float64(rand.Intn(21)-10) / 2
+        if amount < 1 { amount = 1 }
+    }
+    rec[9] = strconv.FormatFloat(amount, 'f', 2, 64)
+    if rand.Float64() < 0.5 {
+        rec[8] = orig[8] + " " + []string{"ref", "nf", "complemento", "reembolso"}[rand.Intn(4)]
+    }
+    rec[14] = "1"
+    rec[15] = FraudDuplicate
+    return rec
+}
+
+func splitPurchase(expenseID, requestID string, baseDate time.Time, org *syntheticOrg, merchants *syntheticMerchants, routes *syntheticRoutes) [][]string {
+    cat := categories[rand.Intn(len(categories))]
+    limit := splitLimits[cat]
+    requesterID := "U" + strconv.Itoa(rand.Intn(5000))
+    approverID := org.manager[requesterID]
+    reqOffset := rand.Intn(300)
+    travelDate := baseDate.AddDate(0, 0, reqOffset+rand.Intn(30))
+    job := org.title[requesterID]
+    dept := org.dept[requesterID]
+    merchant := merchants.pick(cat, 1)
+    cities := []string{"", ""}
+    if rt, ok := routes.pick(requesterID); ok {
+        cities = []string{rt.from, rt.to}
+    }
+    k := 2 + rand.Intn(3)
+    out := make([][]string, 0, k)
+    for j := 0; j < k; j++ {
+        amount := limit * (0.85 + 0.14*rand.Float64())
+        reqDate := baseDate.AddDate(0, 0, reqOffset+rand.Intn(2))
+        out = append(out, []string{
+            expenseID,
+            requestID,
+            requesterID,
+            requesterID,
+            approverID,
+            reqDate.Format("2006-01-02"),
+            travelDate.Format("2006-01-02"),
+            cat,
+            strings.ToLower(cat + " parcela " + strconv.Itoa(j+1)),
+            strconv.FormatFloat(amount, 'f', 2, 64),
+            "BRL",
+            job,
+            dept,
+            "Aprovado",
+            "1",
+            FraudSplitPurchase,
+        })
+        out[j] = append(out[j], org.approvalTimes(approverID, reqDate, "Aprovado")...)
+        out[j] = append(out[j], merchant...)
+        out[j] = append(out[j], cities...)
+    }
+    return out
+}
+
+var jobRank = map[string]int{"Analista": 1, "Especialista": 2, "Coordenador": 3, "Gerente": 4, "Diretor": 5}
+
+// syntheticOrg é o organograma usado pelo gerador: funcionários U*, aprovadores
+// A* (coordenadores, gerentes e diretores por departamento) e algumas
+// admissões e desligamentos ao longo do período.
+type syntheticOrg struct {
+    ids     []string
+    title   map[string]string
+    dept    map[string]string
+    manager map[string]string
+    start   map[string]time.Time
+    end     map[string]time.Time
+    rubber  map[string]bool
+}
+
+func newSyntheticOrg(baseDate time.Time) *syntheticOrg {
+    o := &syntheticOrg{title: map[string]string{}, dept: map[string]string{}, manager: map[string]string{}, start: map[string]time.Time{}, end: map[string]time.Time{}, rubber: map[string]bool{}}
+    byDept := map[string]map[string][]string{}
+    add := func(id, title, dept string) {
+        o.ids = append(o.ids, id)
+        o.title[id], o.dept[id] = title, dept
+        o.start[id] = baseDate.AddDate(0, 0, -30-rand.Intn(3000))
+        if rand.Float64() < 0.03 {
+            o.start[id] = baseDate.AddDate(0, 0, rand.Intn(300))
+        } else if rand.Float64() < 0.04 {
+            o.end[id] = baseDate.AddDate(0, 0, rand.Intn(300))
+        }
+        if rand.Float64() < 0.06 { o.rubber[id] = true }
+        if byDept[dept] == nil { byDept[dept] = map[string][]string{} }
+        byDept[dept][title] = append(byDept[dept][title], id)
+    }
+    for i := 0; i < 800; i++ {
+        title := "Coordenador"
+        switch {
+        case i < 25:
+            title = "Diretor"
+        case i < 250:
+            title = "Gerente"
+        }
+        add("A"+strconv.Itoa(i), title, departments[i%len(departments)])
+    }
+    for i := 0; i < 5000; i++ {
+        r := rand.Float64()
+        title := "Analista"
+        switch {
+        case r < 0.04:
+            title = "Diretor"
+        case r < 0.13:
+            title = "Gerente"
+        case r < 0.25:
+            title = "Coordenador"
+        case r < 0.5:
+            title = "Especialista"
+        }
+        add("U"+strconv.Itoa(i), title, departments[rand.Intn(len(departments))])
+    }
+    pick := func(ids []string) string { return ids[rand.Intn(len(ids))] }
+    for _, id := range o.ids {
+        d := byDept[o.dept[id]]
+        switch {
+        case strings.HasPrefix(id, "A") && o.title[id] == "Diretor":
+        case strings.HasPrefix(id, "A") && o.title[id] == "Coordenador":
+            o.manager[id] = pick(d["Gerente"])
+        case jobRank[o.title[id]] >= jobRank["Gerente"]:
+            o.manager[id] = pick(d["Diretor"])
+        default:
+            o.manager[id] = pick(append(append([]string(nil), d["Coordenador"]...), d["Gerente"]...))
+        }
+        for o.manager[id] == id { o.manager[id] = pick(d["Diretor"]) }
+    }
+    return o
+}
+
+func (o *syntheticOrg) activeAt(id string, t time.Time) bool {
+    if s, ok := o.start[id]; ok && t.Before(s) { return false }
+    if e, ok := o.end[id]; ok && t.After(e) { return false }
+    return true
+}
+
+// approvalTimes sorteia o envio em horário comercial do dia da solicitação e
+// a decisão: minutos depois para os aprovadores "carimbo", horas a dias para
+// os demais. Pendentes ficam sem decisão.
+func (o *syntheticOrg) approvalTimes(approverID string, reqDate time.Time, status string) []string {
+    submitted := reqDate.Truncate(24 * time.Hour).Add(8*time.Hour + time.Duration(rand.Intn(10*3600))*time.Second)
+    if status == "Pendente" {
+        return []string{submitted.Format(TimestampLayout), ""}
+    }
+    lat := time.Duration(math.Exp(rand.NormFloat64()*0.9+math.Log(20)) * float64(time.Hour))
+    if o.rubber[approverID] {
+        lat = time.Duration(30+rand.Intn(570)) * time.Second
+    }
+    return []string{submitted.Format(TimestampLayout), submitted.Add(lat).Format(TimestampLayout)}
+}
+
+func (o *syntheticOrg) write(path string) error {
+    if dir := filepath.Dir(path); dir != "" {
+        if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+    }
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    w := csv.NewWriter(f)
+    defer w.Flush()
+    if err := w.Write([]string{"employee_id", "job_title", "department", "manager_id", "start_date", "end_date"}); err != nil {
+        return err
+    }
+    for _, id := range o.ids {
+        end := ""
+        if e, ok := o.end[id]; ok { end = e.Format("2006-01-02") }
+        if err := w.Write([]string{id, o.title[id], o.dept[id], o.manager[id], o.start[id].Format("2006-01-02"), end}); err != nil {
+            return err
+        }
     }
     return nil
 }
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Matrix guarda as features em float32, uma fatia por coluna: metade da
+// memória de [][]float64 e sem um slice por linha. Os modelos continuam
+// recebendo [][]float64 via Dense.
+type Matrix struct {
+    Names []string
+    Cols  [][]float32
+    n     int
+}
+
+func NewMatrix(names []string, rows int) *Matrix {
+    m := &Matrix{Names: names, Cols: make([][]float32, len(names)), n: rows}
+    for j := range m.Cols { m.Cols[j] = make([]float32, rows) }
+    return m
+}
+
+func (m *Matrix) Rows() int { return m.n }
+func (m *Matrix) NumCols() int { return len(m.Cols) }
+
+// Append acrescenta uma linha; colunas a mais em row são ignoradas.
+func (m *Matrix) Append(row []float64) {
+    for j := range m.Cols {
+        v := float32(0)
+        if j < len(row) { v = float32(row[j]) }
+        m.Cols[j] = append(m.Cols[j], v)
+    }
+    m.n++
+}
+
+// SetRow grava row na linha i a partir da coluna off.
+func (m *Matrix) SetRow(i, off int, row []float64) {
+    for j, v := range row {
+        if off+j < len(m.Cols) { m.Cols[off+j][i] = float32(v) }
+    }
+}
+
+func (m *Matrix) At(i, j int) float64 { return float64(m.Cols[j][i]) }
+
+// Row copia a linha i para dst (alocado se for curto).
+func (m *Matrix) Row(i int, dst []float64) []float64 {
+    if cap(dst) < len(m.Cols) { dst = make([]float64, len(m.Cols)) }
+    dst = dst[:len(m.Cols)]
+    for j, c := range m.Cols { dst[j] = float64(c[i]) }
+    return dst
+}
+
+// Dense materializa as linhas idx (todas se nil) em [][]float64 com um só
+// bloco de memória.
+func (m *Matrix) Dense(idx []int) [][]float64 {
+    if idx == nil {
+        idx = make([]int, m.n)
+        for i := range idx { idx[i] = i }
+    }
+    k := len(m.Cols)
+    buf := make([]float64, len(idx)*k)
+    out := make([][]float64, len(idx))
+    for r, i := range idx { out[r] = m.Row(i, buf[r*k:(r+1)*k:(r+1)*k]) }
+    return out
+}
+
+// Bytes é o tamanho aproximado dos dados.
+func (m *Matrix) Bytes() int { return 4 * m.n * len(m.Cols) }
+
+// Round32 arredonda v para float32 no lugar e devolve v. Quem serve um
+// modelo treinado a partir da Matrix passa o vetor por aqui, para que os
+// limiares aprendidos em float32 vejam os mesmos valores do treino.
+func Round32(v []float64) []float64 {
+    for i, x := range v { v[i] = float64(float32(x)) }
+    return v
+}
+
+// VectorizeParallel aplica fn às despesas com workers goroutines (0 = número
+// de CPUs) e grava cada vetor na linha de mesma posição. fn precisa ser
+// segura para uso concorrente e devolver len(names) valores.
+func VectorizeParallel(es []Expense, names []string, workers int, fn func(Expense) []float64) *Matrix {
+    m := NewMatrix(names, 0)
+    m.AppendParallel(es, workers, fn)
+    return m
+}
+
+// AppendParallel vetoriza es como VectorizeParallel e acrescenta as linhas
+// ao fim de m; permite montar a matriz bloco a bloco (Reader.Chunks).
+func (m *Matrix) AppendParallel(es []Expense, workers int, fn func(Expense) []float64) {
+    base := m.n
+    for j := range m.Cols { m.Cols[j] = append(m.Cols[j], make([]float32, len(es))...) }
+    m.n += len(es)
+    if workers <= 0 { workers = runtime.NumCPU() }
+    const block = 256
+    next := make(chan int, workers)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for start := range next {
+                for i := start; i < min(start+block, len(es)); i++ { m.SetRow(base+i, 0, fn(es[i])) }
+            }
+        }()
+    }
+    for start := 0; start < len(es); start += block { next <- start }
+    close(next)
+    wg.Wait()
+}
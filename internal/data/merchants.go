@@ -0,0 +1,155 @@
+package data
+
+import (
+	"encoding/csv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MerchantListPath recebe a lista de bloqueio/observação sintética gerada
+// junto com as despesas.
+var MerchantListPath = "data/merchant_list.csv"
+
+type syntheticMerchant struct {
+    name string
+    cnpj string
+    list string
+}
+
+// syntheticMerchants mantém os estabelecimentos por categoria e as empresas de
+// fachada (bloqueadas ou em observação) usadas em parte das fraudes.
+type syntheticMerchants struct {
+    byCat map[string][]syntheticMerchant
+    shell []syntheticMerchant
+}
+
+var merchantNames = map[string][]string{
+    "Alimentação": {"Restaurante Sabor da Terra", "Padaria Pão Quente", "Churrascaria Boi Nobre", "Cantina Bella Napoli", "Lanchonete Ponto Certo", "Café Central", "Restaurante Maré Alta", "Bistrô São Jorge"},
+    "Transporte":  {"Viação Cometa Azul", "Locadora Rota Sul", "Companhia Aérea Horizonte", "Auto Posto Estrela", "Posto Rodovia Norte", "Rodoviária Expressa"},
+    "Taxi":        {"Rádio Táxi Cidade", "Cooperativa Táxi Ouro", "Táxi Aeroporto Executivo", "Coopertáxi Metropolitana"},
+    "Pedágio":     {"Concessionária Via Litoral", "Rodovias Integradas do Oeste", "Autopista Serra Verde"},
+    "Hospedagem":  {"Hotel Central Plaza", "Pousada Recanto Verde", "Hotel Executivo Paulista", "Flat Residence Jardins", "Hotel Atlântico Mar", "Hostel Rota Livre"},
+}
+
+var shellNames = []string{"Comercial Alfa Serviços", "JR Eventos e Turismo", "Prime Consultoria Empresarial", "Global Trade Representações", "Nova Era Locações", "Master Service Soluções", "Ômega Distribuidora", "Delta Assessoria", "Sol Nascente Turismo", "Vértice Soluções Corporativas"}
+
+var legalForms = []string{" Ltda", " ME", " EIRELI", " S/A", ""}
+
+// syntheticCNPJ sorteia a raiz e calcula os dígitos verificadores.
+func syntheticCNPJ() string {
+    d := make([]byte, 12)
+    for i := range d { d[i] = byte('0' + rand.Intn(10)) }
+    d[8], d[9], d[10], d[11] = '0', '0', '0', '1'
+    for _, weights := range [][]int{{5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}, {6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}} {
+        sum := 0
+        for i, w := range weights { sum += int(d[i]-'0') * w }
+        dv := byte('0')
+        if r := sum % 11; r >= 2 { dv = byte('0' + 11 - r) }
+        d = append(d, dv)
+    }
+    s := string(d)
+    return s[:2] + "." + s[2:5] + "." + s[5:8] + "/" + s[8:12] + "-" + s[12:]
+}
+
+// invalidCNPJ troca o último dígito verificador.
+func invalidCNPJ(cnpj string) string {
+    last := cnpj[len(cnpj)-1]
+    return cnpj[:len(cnpj)-1] + string('0'+(last-'0'+1+byte(rand.Intn(8)))%10)
+}
+
+func newSyntheticMerchants() *syntheticMerchants {
+    m := &syntheticMerchants{byCat: map[string][]syntheticMerchant{}}
+    for cat, names := range merchantNames {
+        for _, n := range names {
+            for _, city := range []string{"", " Centro", " Aeroporto"} {
+                m.byCat[cat] = append(m.byCat[cat], syntheticMerchant{name: n + city + legalForms[rand.Intn(len(legalForms))], cnpj: syntheticCNPJ()})
+            }
+        }
+    }
+    for i, n := range shellNames {
+        list := "block"
+        if i%3 == 2 {
+            list = "watch"
+        }
+        m.shell = append(m.shell, syntheticMerchant{name: n + " Ltda", cnpj: syntheticCNPJ(), list: list})
+    }
+    return m
+}
+
+// typo simula a grafia variada com que a mesma empresa aparece nas notas.
+func typo(name string) string {
+    r := []rune(name)
+    switch rand.Intn(4) {
+    case 0:
+        return strings.ToUpper(name)
+    case 1:
+        i := 1 + rand.Intn(len(r)-2)
+        return string(append(r[:i:i], r[i+1:]...))
+    case 2:
+        i := 1 + rand.Intn(len(r)-2)
+        r[i], r[i+1] = r[i+1], r[i]
+        return string(r)
+    }
+    return strings.NewReplacer("ç", "c", "ã", "a", "ô", "o", "é", "e", "Ô", "O", "Ltda", "LTDA").Replace(name)
+}
+
+// pick devolve nome e CNPJ do estabelecimento de uma despesa. Parte das
+// fraudes usa empresas de fachada com grafia variada, às vezes sem CNPJ ou com
+// CNPJ adulterado; alguns itens saem sem estabelecimento informado.
+func (m *syntheticMerchants) pick(cat string, fraud int) []string {
+    if rand.Float64() < 0.05 {
+        return []string{"", ""}
+    }
+    if fraud == 1 && rand.Float64() < 0.2 || fraud == 0 && rand.Float64() < 0.003 {
+        s := m.shell[rand.Intn(len(m.shell))]
+        name, cnpj := s.name, s.cnpj
+        if rand.Float64() < 0.6 {
+            name = typo(name)
+        }
+        switch r := rand.Float64(); {
+        case r < 0.3:
+            cnpj = ""
+        case r < 0.45:
+            cnpj = invalidCNPJ(cnpj)
+        case r < 0.6:
+            cnpj = syntheticCNPJ()
+        }
+        return []string{name, cnpj}
+    }
+    pool := m.byCat[cat]
+    s := pool[rand.Intn(len(pool))]
+    cnpj := s.cnpj
+    if rand.Float64() < 0.01 {
+        cnpj = invalidCNPJ(cnpj)
+    }
+    return []string{s.name, cnpj}
+}
+
+func (m *syntheticMerchants) write(path string) error {
+    if dir := filepath.Dir(path); dir != "" {
+        if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+    }
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    w := csv.NewWriter(f)
+    defer w.Flush()
+    if err := w.Write([]string{"name", "cnpj", "list", "reason"}); err != nil {
+        return err
+    }
+    for i, s := range m.shell {
+        reason := "empresa de fachada (auditoria " + strconv.Itoa(2020+i%5) + ")"
+        if s.list == "watch" {
+            reason = "notas com indícios de superfaturamento"
+        }
+        if err := w.Write([]string{s.name, s.cnpj, s.list, reason}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
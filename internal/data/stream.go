@@ -0,0 +1,161 @@
+package data
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// Record é uma linha válida do CSV de despesas. Label é LabelUnlabeled
+// quando o arquivo não tem a coluna fraud.
+type Record struct {
+    Line      int
+    Expense   Expense
+    Label     int
+    FraudType string
+}
+
+// Reader lê o CSV de despesas linha a linha, sem carregar o arquivo inteiro.
+// Linhas inválidas (validação, rótulo ou colunas faltando) vão para Rejects e
+// são puladas.
+type Reader struct {
+    Validator *Validator
+    Rejects   Rejects
+    HasLabel  bool
+    HasType   bool
+    Header    []string
+    cols      OptionalCols
+    r         *csv.Reader
+    closer    io.Closer
+    line      int
+}
+
+// NewReader lê o cabeçalho de r. Validator nil usa NewValidator(nil).
+func NewReader(r io.Reader, v *Validator) (*Reader, error) {
+    if v == nil { v = NewValidator(nil) }
+    cr := csv.NewReader(r)
+    cr.FieldsPerRecord = -1
+    cr.ReuseRecord = true
+    header, err := cr.Read()
+    if err == io.EOF { return nil, errors.New("CSV vazio") }
+    if err != nil { return nil, err }
+    header = append([]string(nil), header...)
+    return &Reader{
+        Validator: v,
+        Header:    header,
+        HasLabel:  len(header) > 14 && header[14] == "fraud",
+        HasType:   len(header) > 15 && header[15] == "fraud_type",
+        cols:      FindOptionalCols(header),
+        r:         cr,
+        line:      1,
+    }, nil
+}
+
+func OpenReader(path string, v *Validator) (*Reader, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    r, err := NewReader(f, v)
+    if err != nil { f.Close(); return nil, err }
+    r.closer = f
+    return r, nil
+}
+
+func (r *Reader) Close() error {
+    if r.closer == nil { return nil }
+    return r.closer.Close()
+}
+
+// Next devolve a próxima linha válida ou io.EOF no fim do arquivo.
+func (r *Reader) Next() (Record, error) {
+    for {
+        row, err := r.r.Read()
+        if err == io.EOF { return Record{}, io.EOF }
+        r.line++
+        if err != nil {
+            var pe *csv.ParseError
+            if !errors.As(err, &pe) { return Record{}, err }
+            r.line = pe.Line
+            r.Rejects.Add(pe.Line, "", &ValidationError{Errors: []FieldError{{Message: pe.Err.Error()}}})
+            continue
+        }
+        if len(row) < 14 {
+            id := ""
+            if len(row) > 0 { id = row[0] }
+            r.Rejects.Add(r.line, id, &ValidationError{Errors: []FieldError{{Message: fmt.Sprintf("linha com %d colunas, esperado ao menos 14", len(row))}}})
+            continue
+        }
+        rec := Record{Line: r.line, Label: LabelUnlabeled}
+        e, err := r.Validator.Parse(r.cols.Raw(row))
+        if r.HasLabel {
+            l, lerr := ParseLabel(row[14])
+            if lerr != nil {
+                if err == nil { err = &ValidationError{} }
+                if ve, ok := err.(*ValidationError); ok { ve.add("fraud", row[14], "rótulo inválido (0, 1 ou vazio)") }
+            }
+            rec.Label = l
+        }
+        if err != nil { r.Rejects.Add(r.line, row[0], err); continue }
+        if r.HasType && len(row) > 15 { rec.FraudType = row[15] }
+        rec.Expense = e
+        return rec, nil
+    }
+}
+
+// Each chama fn para cada linha válida; erro de fn interrompe a leitura.
+func (r *Reader) Each(fn func(Record) error) error {
+    for {
+        rec, err := r.Next()
+        if err == io.EOF { return nil }
+        if err != nil { return err }
+        if err := fn(rec); err != nil { return err }
+    }
+}
+
+// Chunks entrega as linhas em blocos de até size registros; o slice é
+// reaproveitado entre chamadas.
+func (r *Reader) Chunks(size int, fn func([]Record) error) error {
+    if size <= 0 { size = 10000 }
+    buf := make([]Record, 0, size)
+    err := r.Each(func(rec Record) error {
+        buf = append(buf, rec)
+        if len(buf) < size { return nil }
+        err := fn(buf)
+        buf = buf[:0]
+        return err
+    })
+    if err != nil { return err }
+    if len(buf) > 0 { return fn(buf) }
+    return nil
+}
+
+// Sample faz amostragem de reservatório (algoritmo R): k linhas uniformes do
+// arquivo em uma passada, entregues a fn na ordem do arquivo. k <= 0 entrega
+// cada linha assim que é lida, sem guardar o arquivo. Devolve o total de
+// linhas válidas.
+func (r *Reader) Sample(k int, rng *rand.Rand, fn func(Record) error) (int, error) {
+    n := 0
+    if k <= 0 {
+        err := r.Each(func(rec Record) error { n++; return fn(rec) })
+        return n, err
+    }
+    var out []Record
+    err := r.Each(func(rec Record) error {
+        n++
+        if len(out) < k {
+            out = append(out, rec)
+        } else if j := rng.Intn(n); j < k {
+            out[j] = rec
+        }
+        return nil
+    })
+    if err != nil { return n, err }
+    sort.Slice(out, func(i, j int) bool { return out[i].Line < out[j].Line })
+    for _, rec := range out {
+        if err := fn(rec); err != nil { return n, err }
+    }
+    return n, nil
+}
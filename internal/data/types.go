@@ -1,6 +1,10 @@
 package data
 
-import "time"
+import (
+    "fmt"
+    "strings"
+    "time"
+)
 
 type Expense struct {
     ExpenseID      string    `json:"expense_id"`
@@ -17,5 +21,94 @@ type Expense struct {
     JobTitle       string    `json:"job_title"`
     Department     string    `json:"department"`
     ApprovalStatus string    `json:"approval_status"`
+    SubmittedAt    time.Time `json:"submitted_at"`
+    ApprovedAt     time.Time `json:"approved_at"`
+    Merchant       string    `json:"merchant"`
+    MerchantTaxID  string    `json:"merchant_cnpj"`
+    Origin         string    `json:"origin_city"`
+    Destination    string    `json:"destination_city"`
     Fraud          int       `json:"fraud"`
-}
\ No newline at end of file
+    FraudType      string    `json:"fraud_type"`
+}
+
+const (
+    FraudNone          = "nenhuma"
+    FraudSelfApproval  = "autoaprovacao"
+    FraudSplitPurchase = "fracionamento"
+    FraudInflatedTaxi  = "taxi_inflado"
+    FraudDateTampering = "data_manipulada"
+    FraudDuplicate     = "duplicidade"
+    FraudOther         = "outros"
+    FraudMileage       = "quilometragem_inflada"
+)
+
+// FraudTypes é a ordem das classes do modelo de tipologia. Tipos novos entram
+// sempre no fim: mudar a posição de um tipo renumera as classes dos modelos
+// já treinados.
+var FraudTypes = []string{FraudNone, FraudSelfApproval, FraudSplitPurchase, FraudInflatedTaxi, FraudDateTampering, FraudDuplicate, FraudOther, FraudMileage}
+
+func FraudTypeIndex(t string) int {
+    if t == "" { return 0 }
+    for i, ft := range FraudTypes {
+        if ft == t { return i }
+    }
+    return FraudTypeIndex(FraudOther)
+}
+
+const (
+    LabelUnlabeled = -1
+    LabelClean     = 0
+    LabelFraud     = 1
+)
+
+func ParseLabel(s string) (int, error) {
+    switch strings.ToLower(strings.TrimSpace(s)) {
+    case "1", "fraude", "fraud":
+        return LabelFraud, nil
+    case "0", "limpo", "clean":
+        return LabelClean, nil
+    case "", "-1", "?", "nao_rotulado", "unlabeled":
+        return LabelUnlabeled, nil
+    }
+    return LabelUnlabeled, fmt.Errorf("rótulo inválido: %q", s)
+}
+
+// TimestampLayout é o formato de submitted_at (envio para aprovação) e
+// approved_at (decisão do aprovador, aprovando ou reprovando; vazio enquanto
+// pendente) no CSV.
+const TimestampLayout = "2006-01-02 15:04:05"
+
+// ParseTimestamp aceita vazio, TimestampLayout ou RFC 3339.
+func ParseTimestamp(s string) (time.Time, error) {
+    s = strings.TrimSpace(s)
+    if s == "" { return time.Time{}, nil }
+    if t, err := time.Parse(TimestampLayout, s); err == nil { return t, nil }
+    t, err := time.Parse(time.RFC3339, s)
+    if err != nil { return time.Time{}, fmt.Errorf("timestamp inválido: %q", s) }
+    return t, nil
+}
+
+// OptionalCols guarda a posição das colunas opcionais (-1 se ausentes), para
+// CSVs gerados antes delas.
+type OptionalCols struct{ Submitted, Approved, Merchant, MerchantTaxID, Origin, Destination int }
+
+func FindOptionalCols(header []string) OptionalCols {
+    c := OptionalCols{-1, -1, -1, -1, -1, -1}
+    for j, h := range header {
+        switch h {
+        case "submitted_at":
+            c.Submitted = j
+        case "approved_at":
+            c.Approved = j
+        case "merchant":
+            c.Merchant = j
+        case "merchant_cnpj":
+            c.MerchantTaxID = j
+        case "origin_city":
+            c.Origin = j
+        case "destination_city":
+            c.Destination = j
+        }
+    }
+    return c
+}
@@ -0,0 +1,228 @@
+package data
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"antifraude/internal/fx"
+)
+
+// DateLayout é o formato de request_date e travel_date.
+const DateLayout = "2006-01-02"
+
+// FieldError é um problema num campo da despesa, com o nome do campo como no
+// CSV/JSON.
+type FieldError struct {
+    Field   string `json:"field"`
+    Value   string `json:"value,omitempty"`
+    Message string `json:"message"`
+}
+
+// ValidationError junta todos os problemas de uma despesa; a validação não
+// para no primeiro.
+type ValidationError struct {
+    Errors []FieldError `json:"errors"`
+}
+
+func (v *ValidationError) Error() string {
+    parts := make([]string, len(v.Errors))
+    for i, fe := range v.Errors { parts[i] = fe.Field + ": " + fe.Message }
+    return "despesa inválida: " + strings.Join(parts, "; ")
+}
+
+func (v *ValidationError) add(field, value, msg string) {
+    v.Errors = append(v.Errors, FieldError{Field: field, Value: value, Message: msg})
+}
+
+// RawExpense é a despesa ainda como texto, do jeito que chega do CSV ou da API.
+type RawExpense struct {
+    ExpenseID      string
+    RequestID      string
+    RequesterID    string
+    TravellerID    string
+    ApproverID     string
+    RequestDate    string
+    TravelDate     string
+    Category       string
+    Description    string
+    Amount         string
+    Currency       string
+    JobTitle       string
+    Department     string
+    ApprovalStatus string
+    SubmittedAt    string
+    ApprovedAt     string
+    Merchant       string
+    MerchantTaxID  string
+    Origin         string
+    Destination    string
+}
+
+var defaultIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-]{0,63}$`)
+
+var approvalStatuses = map[string]bool{"aprovado": true, "reprovado": true, "pendente": true}
+
+// Validator confere uma RawExpense e monta a Expense. FX nil aceita qualquer
+// código de moeda de três letras; MaxTravelWindow limita a distância (em
+// dias, nos dois sentidos) entre solicitação e viagem. Viagem antes da
+// solicitação dentro da janela não é erro: é sinal de fraude para o modelo.
+type Validator struct {
+    FX              *fx.Table
+    IDPattern       *regexp.Regexp
+    MaxTravelWindow int
+    MinDate         time.Time
+    MaxDate         time.Time
+}
+
+func NewValidator(t *fx.Table) *Validator {
+    return &Validator{FX: t, IDPattern: defaultIDPattern, MaxTravelWindow: 365, MinDate: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), MaxDate: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Parse devolve a despesa ou um *ValidationError com todos os campos
+// problemáticos.
+func (v *Validator) Parse(r RawExpense) (Expense, error) {
+    ve := &ValidationError{}
+    e := Expense{
+        ExpenseID: strings.TrimSpace(r.ExpenseID), RequestID: strings.TrimSpace(r.RequestID),
+        RequesterID: strings.TrimSpace(r.RequesterID), TravellerID: strings.TrimSpace(r.TravellerID), ApproverID: strings.TrimSpace(r.ApproverID),
+        Category: strings.TrimSpace(r.Category), Description: r.Description, Currency: strings.ToUpper(strings.TrimSpace(r.Currency)),
+        JobTitle: strings.TrimSpace(r.JobTitle), Department: strings.TrimSpace(r.Department), ApprovalStatus: strings.TrimSpace(r.ApprovalStatus),
+        Merchant: strings.TrimSpace(r.Merchant), MerchantTaxID: strings.TrimSpace(r.MerchantTaxID),
+        Origin: strings.TrimSpace(r.Origin), Destination: strings.TrimSpace(r.Destination),
+    }
+    ids := []struct {
+        field, value string
+        required     bool
+    }{{"expense_id", e.ExpenseID, true}, {"request_id", e.RequestID, false}, {"requester_id", e.RequesterID, true}, {"traveller_id", e.TravellerID, false}, {"approver_id", e.ApproverID, false}}
+    for _, id := range ids {
+        switch {
+        case id.value == "" && id.required:
+            ve.add(id.field, "", "obrigatório")
+        case id.value != "" && v.IDPattern != nil && !v.IDPattern.MatchString(id.value):
+            ve.add(id.field, id.value, "formato de ID inválido (letras, dígitos, _ . -; até 64 caracteres)")
+        }
+    }
+    date := func(field, s string) time.Time {
+        s = strings.TrimSpace(s)
+        if s == "" { ve.add(field, "", "obrigatório"); return time.Time{} }
+        t, err := time.Parse(DateLayout, s)
+        if err != nil { ve.add(field, s, "data inválida, use AAAA-MM-DD"); return time.Time{} }
+        if t.Before(v.MinDate) || !t.Before(v.MaxDate) { ve.add(field, s, fmt.Sprintf("data fora do intervalo aceito (%s a %s)", v.MinDate.Format(DateLayout), v.MaxDate.Format(DateLayout))); return time.Time{} }
+        return t
+    }
+    e.RequestDate = date("request_date", r.RequestDate)
+    e.TravelDate = date("travel_date", r.TravelDate)
+    if !e.RequestDate.IsZero() && !e.TravelDate.IsZero() && v.MaxTravelWindow > 0 {
+        if d := math.Abs(e.TravelDate.Sub(e.RequestDate).Hours() / 24); d > float64(v.MaxTravelWindow) {
+            ve.add("travel_date", r.TravelDate, fmt.Sprintf("viagem a %.0f dias da solicitação (máximo %d)", d, v.MaxTravelWindow))
+        }
+    }
+    var err error
+    if e.SubmittedAt, err = ParseTimestamp(r.SubmittedAt); err != nil { ve.add("submitted_at", r.SubmittedAt, "timestamp inválido, use AAAA-MM-DD HH:MM:SS ou RFC 3339") }
+    if e.ApprovedAt, err = ParseTimestamp(r.ApprovedAt); err != nil { ve.add("approved_at", r.ApprovedAt, "timestamp inválido, use AAAA-MM-DD HH:MM:SS ou RFC 3339") }
+    if !e.SubmittedAt.IsZero() && !e.ApprovedAt.IsZero() && e.ApprovedAt.Before(e.SubmittedAt) {
+        ve.add("approved_at", r.ApprovedAt, "decisão anterior ao envio (submitted_at)")
+    }
+    if e.Category == "" { ve.add("category", "", "obrigatório") }
+    if s := strings.TrimSpace(r.Amount); s == "" {
+        ve.add("amount", "", "obrigatório")
+    } else if a, err := strconv.ParseFloat(s, 64); err != nil || math.IsNaN(a) || math.IsInf(a, 0) {
+        ve.add("amount", s, "número inválido")
+    } else if a <= 0 {
+        ve.add("amount", s, "valor deve ser maior que zero")
+    } else {
+        e.Amount = a
+    }
+    switch {
+    case e.Currency == "":
+    case len(e.Currency) != 3 || strings.IndexFunc(e.Currency, func(c rune) bool { return c < 'A' || c > 'Z' }) >= 0:
+        ve.add("currency", r.Currency, "código de moeda inválido (ISO 4217, ex: BRL)")
+    case v.FX != nil && !v.FX.Known(e.Currency):
+        ve.add("currency", r.Currency, fmt.Sprintf("moeda sem cotação (disponíveis: %s)", strings.Join(v.FX.Currencies(), ", ")))
+    }
+    if e.ApprovalStatus != "" && !approvalStatuses[strings.ToLower(e.ApprovalStatus)] {
+        ve.add("approval_status", e.ApprovalStatus, "use Aprovado, Reprovado ou Pendente")
+    }
+    if len(ve.Errors) > 0 { return e, ve }
+    return e, nil
+}
+
+// FieldErrors extrai os erros por campo; outros erros viram um único item sem
+// campo.
+func FieldErrors(err error) []FieldError {
+    if ve, ok := err.(*ValidationError); ok { return ve.Errors }
+    return []FieldError{{Message: err.Error()}}
+}
+
+// Raw lê as colunas fixas (posições 0 a 13) e as opcionais de uma linha do CSV.
+func (c OptionalCols) Raw(row []string) RawExpense {
+    get := func(j int) string {
+        if j >= 0 && j < len(row) { return row[j] }
+        return ""
+    }
+    return RawExpense{
+        ExpenseID: get(0), RequestID: get(1), RequesterID: get(2), TravellerID: get(3), ApproverID: get(4),
+        RequestDate: get(5), TravelDate: get(6), Category: get(7), Description: get(8), Amount: get(9),
+        Currency: get(10), JobTitle: get(11), Department: get(12), ApprovalStatus: get(13),
+        SubmittedAt: get(c.Submitted), ApprovedAt: get(c.Approved), Merchant: get(c.Merchant), MerchantTaxID: get(c.MerchantTaxID),
+        Origin: get(c.Origin), Destination: get(c.Destination),
+    }
+}
+
+// Rejected é uma linha recusada por um carregador de CSV; Line conta o
+// cabeçalho como linha 1.
+type Rejected struct {
+    Line      int
+    ExpenseID string
+    Errors    []FieldError
+}
+
+// Rejects acumula as linhas recusadas de uma carga.
+type Rejects struct {
+    Rows []Rejected
+}
+
+func (r *Rejects) Add(line int, expenseID string, err error) {
+    r.Rows = append(r.Rows, Rejected{Line: line, ExpenseID: expenseID, Errors: FieldErrors(err)})
+}
+
+func (r *Rejects) Len() int { return len(r.Rows) }
+
+// ByField conta as recusas por campo, para log.
+func (r *Rejects) ByField() map[string]int {
+    out := map[string]int{}
+    for _, row := range r.Rows {
+        for _, fe := range row.Errors { out[fe.Field]++ }
+    }
+    return out
+}
+
+// Write grava o relatório line,expense_id,field,value,message (uma linha por
+// campo com problema).
+func (r *Rejects) Write(path string) error {
+    if dir := filepath.Dir(path); dir != "" {
+        if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+    }
+    f, err := os.Create(path)
+    if err != nil { return err }
+    defer f.Close()
+    w := csv.NewWriter(f)
+    if err := w.Write([]string{"line", "expense_id", "field", "value", "message"}); err != nil { return err }
+    rows := append([]Rejected(nil), r.Rows...)
+    sort.SliceStable(rows, func(i, j int) bool { return rows[i].Line < rows[j].Line })
+    for _, row := range rows {
+        for _, fe := range row.Errors {
+            if err := w.Write([]string{strconv.Itoa(row.Line), row.ExpenseID, fe.Field, fe.Value, fe.Message}); err != nil { return err }
+        }
+    }
+    w.Flush()
+    return w.Error()
+}
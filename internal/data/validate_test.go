@@ -0,0 +1,60 @@
+package data
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"antifraude/internal/fx"
+)
+
+func validRaw() RawExpense {
+    return RawExpense{
+        ExpenseID: "E-1", RequestID: "R1", RequesterID: "U1", TravellerID: "U1", ApproverID: "A1",
+        RequestDate: "2024-05-10", TravelDate: "2024-05-20", Category: "Hospedagem", Amount: "350.00", Currency: "usd",
+        ApprovalStatus: "Aprovado", SubmittedAt: "2024-05-10 09:00:00", ApprovedAt: "2024-05-11T10:00:00Z",
+    }
+}
+
+func TestParseFieldErrors(t *testing.T) {
+    rates := fx.New("BRL")
+    rates.Add("USD", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 5)
+    v := NewValidator(rates)
+
+    e, err := v.Parse(validRaw())
+    if err != nil { t.Fatalf("despesa válida recusada: %v", err) }
+    if e.Currency != "USD" || e.Amount != 350 || e.ApprovedAt.Before(e.SubmittedAt) { t.Fatalf("despesa montada errada: %+v", e) }
+
+    cases := map[string]struct {
+        edit   func(*RawExpense)
+        fields []string
+    }{
+        "sem expense_id":           {func(r *RawExpense) { r.ExpenseID = " " }, []string{"expense_id"}},
+        "id com espaço":            {func(r *RawExpense) { r.ApproverID = "A 1" }, []string{"approver_id"}},
+        "data em outro formato":    {func(r *RawExpense) { r.RequestDate = "10/05/2024" }, []string{"request_date"}},
+        "data fora do intervalo":   {func(r *RawExpense) { r.TravelDate = "1999-12-31" }, []string{"travel_date"}},
+        "viagem longe demais":      {func(r *RawExpense) { r.TravelDate = "2025-06-01" }, []string{"travel_date"}},
+        "viagem antes é aceita":    {func(r *RawExpense) { r.TravelDate = "2024-05-01" }, nil},
+        "aprovada antes do envio":  {func(r *RawExpense) { r.ApprovedAt = "2024-05-09 08:00:00" }, []string{"approved_at"}},
+        "timestamp inválido":       {func(r *RawExpense) { r.SubmittedAt = "ontem" }, []string{"submitted_at"}},
+        "valor zero":               {func(r *RawExpense) { r.Amount = "0" }, []string{"amount"}},
+        "valor NaN":                {func(r *RawExpense) { r.Amount = "NaN" }, []string{"amount"}},
+        "moeda sem cotação":        {func(r *RawExpense) { r.Currency = "EUR" }, []string{"currency"}},
+        "moeda malformada":         {func(r *RawExpense) { r.Currency = "US$" }, []string{"currency"}},
+        "status desconhecido":      {func(r *RawExpense) { r.ApprovalStatus = "ok" }, []string{"approval_status"}},
+        "vários campos de uma vez": {func(r *RawExpense) { r.RequesterID, r.Category, r.Amount = "", "", "abc" }, []string{"requester_id", "category", "amount"}},
+    }
+    for name, c := range cases {
+        r := validRaw()
+        c.edit(&r)
+        _, err := v.Parse(r)
+        var got []string
+        if err != nil {
+            var ve *ValidationError
+            if !errors.As(err, &ve) { t.Errorf("%s: erro %T, esperado *ValidationError", name, err); continue }
+            for _, fe := range FieldErrors(err) { got = append(got, fe.Field) }
+        }
+        if !slices.Equal(got, c.fields) { t.Errorf("%s: campos %v, esperado %v", name, got, c.fields) }
+    }
+}
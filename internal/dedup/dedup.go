@@ -0,0 +1,165 @@
+package dedup
+
+import (
+    "hash/fnv"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "antifraude/internal/data"
+)
+
+type Entry struct {
+    Seq       int64
+    ExpenseID string
+    Day       int32
+    Amount    float64
+    Signature []uint32
+}
+
+type Match struct {
+    ExpenseID   string  `json:"expense_id"`
+    Similarity  float64 `json:"similarity"`
+    TextSim     float64 `json:"text_similarity"`
+    AmountDelta float64 `json:"amount_delta"`
+}
+
+// Index agrupa despesas por viajante, data de viagem, categoria e faixa de
+// valor; dentro do bloco a descrição é comparada por MinHash.
+type Index struct {
+    Blocks    map[string][]Entry
+    NextSeq   int64
+    NumHashes int
+    AmountTol float64
+    Threshold float64
+    mu        sync.RWMutex
+}
+
+func New() *Index {
+    return &Index{Blocks: map[string][]Entry{}, NumHashes: 32, AmountTol: 0.1, Threshold: 0.8}
+}
+
+func dayOf(t time.Time) int32 { return int32(t.Unix() / 86400) }
+
+// amountBucket usa faixas logarítmicas da largura da tolerância; a busca
+// olha também as faixas vizinhas para pegar valores levemente alterados.
+func (ix *Index) amountBucket(amount float64) int {
+    if amount <= 0 { return 0 }
+    return int(math.Floor(math.Log(amount) / math.Log1p(ix.AmountTol)))
+}
+
+func blockKey(e data.Expense, bucket int) string {
+    return strings.ToLower(e.TravellerID) + "|" + e.TravelDate.Format("2006-01-02") + "|" + strings.ToLower(e.Category) + "|" + strconv.Itoa(bucket)
+}
+
+func shingles(desc string) []string {
+    toks := strings.Fields(strings.ToLower(desc))
+    s := strings.Join(toks, " ")
+    if len([]rune(s)) < 3 { return []string{s} }
+    r := []rune(s)
+    out := make([]string, 0, len(r)-2)
+    for i := 0; i+3 <= len(r); i++ { out = append(out, string(r[i:i+3])) }
+    return out
+}
+
+func (ix *Index) Signature(desc string) []uint32 {
+    sig := make([]uint32, ix.NumHashes)
+    for i := range sig { sig[i] = math.MaxUint32 }
+    for _, sh := range shingles(desc) {
+        h := fnv.New64a()
+        h.Write([]byte(sh))
+        v := h.Sum64()
+        a, b := uint32(v), uint32(v>>32)
+        for i := range sig {
+            hv := a + uint32(i)*b
+            if hv < sig[i] { sig[i] = hv }
+        }
+    }
+    return sig
+}
+
+func jaccard(a, b []uint32) float64 {
+    if len(a) == 0 || len(a) != len(b) { return 0 }
+    eq := 0
+    for i := range a { if a[i] == b[i] { eq++ } }
+    return float64(eq) / float64(len(a))
+}
+
+// Add indexa a despesa; reenvios do mesmo expense_id são ignorados.
+func (ix *Index) Add(e data.Expense) bool {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    key := blockKey(e, ix.amountBucket(e.Amount))
+    if e.ExpenseID != "" {
+        for _, en := range ix.Blocks[key] { if en.ExpenseID == e.ExpenseID { return false } }
+    }
+    ix.Blocks[key] = append(ix.Blocks[key], Entry{Seq: ix.NextSeq, ExpenseID: e.ExpenseID, Day: dayOf(e.RequestDate), Amount: e.Amount, Signature: ix.Signature(e.Description)})
+    ix.NextSeq++
+    return true
+}
+
+// Candidates devolve as despesas anteriores (por data de solicitação e ordem
+// de ingestão) semelhantes a e, da mais parecida para a menos.
+func (ix *Index) Candidates(e data.Expense, k int) []Match {
+    if ix == nil { return nil }
+    ix.mu.RLock()
+    defer ix.mu.RUnlock()
+    b := ix.amountBucket(e.Amount)
+    var blocks [][]Entry
+    for _, bb := range []int{b - 1, b, b + 1} { blocks = append(blocks, ix.Blocks[blockKey(e, bb)]) }
+    cutoff := int64(math.MaxInt64)
+    for _, evs := range blocks {
+        for _, en := range evs { if e.ExpenseID != "" && en.ExpenseID == e.ExpenseID { cutoff = en.Seq } }
+    }
+    day := dayOf(e.RequestDate)
+    sig := ix.Signature(e.Description)
+    var out []Match
+    for _, evs := range blocks {
+        for _, en := range evs {
+            if en.Seq >= cutoff || en.Day > day { continue }
+            delta := math.Abs(e.Amount-en.Amount) / math.Max(math.Max(e.Amount, en.Amount), 1)
+            if delta > ix.AmountTol { continue }
+            txt := jaccard(sig, en.Signature)
+            out = append(out, Match{ExpenseID: en.ExpenseID, Similarity: 0.7*txt + 0.3*(1-delta/ix.AmountTol), TextSim: txt, AmountDelta: en.Amount - e.Amount})
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Similarity > out[j].Similarity })
+    if k > 0 && len(out) > k { out = out[:k] }
+    return out
+}
+
+// Duplicates filtra os candidatos acima do limiar configurado.
+func (ix *Index) Duplicates(e data.Expense) []Match {
+    if ix == nil { return nil }
+    var out []Match
+    for _, m := range ix.Candidates(e, 5) { if m.Similarity >= ix.Threshold { out = append(out, m) } }
+    return out
+}
+
+func (ix *Index) Compact(days int) {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    var maxDay int32
+    for _, evs := range ix.Blocks { for _, en := range evs { if en.Day > maxDay { maxDay = en.Day } } }
+    cut := maxDay - int32(days)
+    for k, evs := range ix.Blocks {
+        kept := evs[:0]
+        for _, en := range evs { if en.Day > cut { kept = append(kept, en) } }
+        if len(kept) == 0 { delete(ix.Blocks, k); continue }
+        ix.Blocks[k] = kept
+    }
+}
+
+func (ix *Index) Names() []string { return []string{"DupSimilaridadeMax", "DupCandidatos"} }
+
+// Observe indexa a despesa para as próximas consultas.
+func (ix *Index) Observe(e data.Expense) { ix.Add(e) }
+
+func (ix *Index) Transform(e data.Expense) []float64 {
+    ms := ix.Candidates(e, 0)
+    if len(ms) == 0 { return []float64{0, 0} }
+    return []float64{ms[0].Similarity, math.Log1p(float64(len(ms)))}
+}
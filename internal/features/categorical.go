@@ -0,0 +1,157 @@
+package features
+
+import (
+    "math/rand"
+    "sort"
+    "strings"
+
+    "antifraude/internal/data"
+)
+
+const (
+    LevelRare    = "__raro"
+    LevelUnknown = "__desconhecido"
+)
+
+var CategoricalFields = []string{"category", "department", "job_title", "approval_status"}
+
+func fieldValue(e data.Expense, field string) string {
+    var v string
+    switch field {
+    case "category":
+        v = e.Category
+    case "department":
+        v = e.Department
+    case "job_title":
+        v = e.JobTitle
+    case "approval_status":
+        v = e.ApprovalStatus
+    }
+    return strings.ToLower(strings.TrimSpace(v))
+}
+
+type levelStats struct {
+    n      float64
+    frauds float64
+}
+
+// CategoricalEncoder aprende os níveis de cada campo no treino: one-hot com
+// níveis raros agrupados e target encoding suavizado. Níveis nunca vistos
+// caem em LevelUnknown e recebem a taxa a priori.
+type CategoricalEncoder struct {
+    Fields    []string
+    MinCount  int
+    Smoothing float64
+    Folds     int
+    Levels    map[string][]string
+    Seen      map[string]map[string]bool
+    Target    map[string]map[string]float64
+    Prior     float64
+}
+
+func NewCategoricalEncoder() *CategoricalEncoder {
+    return &CategoricalEncoder{Fields: CategoricalFields, MinCount: 20, Smoothing: 20, Folds: 5}
+}
+
+func (ce *CategoricalEncoder) stats(es []data.Expense, labels []int) (map[string]map[string]*levelStats, float64) {
+    st := map[string]map[string]*levelStats{}
+    for _, f := range ce.Fields { st[f] = map[string]*levelStats{} }
+    frauds := 0.0
+    for i, e := range es {
+        fraud := 0.0
+        if labels != nil && labels[i] > 0 { fraud = 1 }
+        frauds += fraud
+        for _, f := range ce.Fields {
+            v := fieldValue(e, f)
+            ls := st[f][v]
+            if ls == nil { ls = &levelStats{}; st[f][v] = ls }
+            ls.n++
+            ls.frauds += fraud
+        }
+    }
+    prior := 0.0
+    if len(es) > 0 { prior = frauds / float64(len(es)) }
+    return st, prior
+}
+
+func (ce *CategoricalEncoder) smooth(ls *levelStats, prior float64) float64 {
+    if ls == nil { return prior }
+    return (ls.frauds + prior*ce.Smoothing) / (ls.n + ce.Smoothing)
+}
+
+func (ce *CategoricalEncoder) Fit(es []data.Expense, labels []int) {
+    st, prior := ce.stats(es, labels)
+    ce.Prior = prior
+    ce.Levels = map[string][]string{}
+    ce.Seen = map[string]map[string]bool{}
+    ce.Target = map[string]map[string]float64{}
+    for _, f := range ce.Fields {
+        ce.Seen[f] = map[string]bool{}
+        ce.Target[f] = map[string]float64{}
+        for v, ls := range st[f] {
+            ce.Seen[f][v] = true
+            ce.Target[f][v] = ce.smooth(ls, prior)
+            if int(ls.n) >= ce.MinCount { ce.Levels[f] = append(ce.Levels[f], v) }
+        }
+        sort.Strings(ce.Levels[f])
+    }
+}
+
+func (ce *CategoricalEncoder) Names() []string {
+    names := []string{}
+    for _, f := range ce.Fields {
+        for _, v := range ce.Levels[f] { names = append(names, "Enc_"+f+"="+v) }
+        names = append(names, "Enc_"+f+"="+LevelRare, "Enc_"+f+"="+LevelUnknown)
+    }
+    return append(names, ce.TargetNames()...)
+}
+
+func (ce *CategoricalEncoder) TargetNames() []string {
+    names := make([]string, len(ce.Fields))
+    for i, f := range ce.Fields { names[i] = "TE_" + f }
+    return names
+}
+
+func (ce *CategoricalEncoder) Transform(e data.Expense) []float64 {
+    out := []float64{}
+    for _, f := range ce.Fields {
+        v := fieldValue(e, f)
+        i := sort.SearchStrings(ce.Levels[f], v)
+        known := i < len(ce.Levels[f]) && ce.Levels[f][i] == v
+        for j := range ce.Levels[f] { out = append(out, boolToFloat(known && j == i)) }
+        out = append(out, boolToFloat(!known && ce.Seen[f][v]), boolToFloat(!ce.Seen[f][v]))
+    }
+    for _, f := range ce.Fields {
+        te, ok := ce.Target[f][fieldValue(e, f)]
+        if !ok { te = ce.Prior }
+        out = append(out, te)
+    }
+    return out
+}
+
+// OutOfFold devolve o target encoding de cada linha de treino calculado sem a
+// própria fold, para que o modelo não aprenda com o rótulo da linha.
+func (ce *CategoricalEncoder) OutOfFold(es []data.Expense, labels []int, seed int64) [][]float64 {
+    k := ce.Folds
+    if k < 2 { k = 2 }
+    fold := make([]int, len(es))
+    for i, j := range rand.New(rand.NewSource(seed)).Perm(len(es)) { fold[j] = i % k }
+    out := make([][]float64, len(es))
+    for f := 0; f < k; f++ {
+        var inEs []data.Expense
+        var inY []int
+        for i := range es {
+            if fold[i] == f { continue }
+            inEs = append(inEs, es[i])
+            if labels != nil { inY = append(inY, labels[i]) }
+        }
+        st, prior := ce.stats(inEs, inY)
+        for i, e := range es {
+            if fold[i] != f { continue }
+            row := make([]float64, len(ce.Fields))
+            for j, field := range ce.Fields { row[j] = ce.smooth(st[field][fieldValue(e, field)], prior) }
+            out[i] = row
+        }
+    }
+    return out
+}
@@ -0,0 +1,18 @@
+package features
+
+import (
+    "antifraude/internal/data"
+    "antifraude/internal/fx"
+)
+
+// ToBase converte o valor para a moeda base da tabela pela cotação da data da
+// viagem (ou da solicitação, quando a viagem não tem data).
+func ToBase(t *fx.Table, e data.Expense) (data.Expense, error) {
+    date := e.TravelDate
+    if date.IsZero() { date = e.RequestDate }
+    amount, err := t.Convert(e.Amount, e.Currency, date)
+    if err != nil { return e, err }
+    e.Amount = amount
+    e.Currency = t.Base
+    return e, nil
+}
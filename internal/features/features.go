@@ -9,7 +9,9 @@ import (
 
 var cats = []string{"Alimentação", "Transporte", "Taxi", "Pedágio", "Hospedagem"}
 
-func Vectorize(e data.Expense) ([]float64, []string) {
+func Vectorize(e data.Expense) ([]float64, []string) { return vectorizeBase(e, cats) }
+
+func vectorizeBase(e data.Expense, cats []string) ([]float64, []string) {
     names := []string{}
     vec := []float64{}
 
@@ -0,0 +1,111 @@
+package features
+
+import (
+    "math"
+    "sort"
+    "strings"
+
+    "antifraude/internal/data"
+)
+
+type PeerGroup struct {
+    N         int
+    Mean      float64
+    Std       float64
+    Quantiles []float64
+}
+
+type PeerStats struct {
+    MinGroup       int
+    Groups         map[string]PeerGroup
+    RequesterCount map[string]int
+    FreqMedian     map[string]float64
+}
+
+func NewPeerStats() *PeerStats {
+    return &PeerStats{MinGroup: 30}
+}
+
+func peerKeys(e data.Expense) []string {
+    job := strings.ToLower(e.JobTitle)
+    dept := strings.ToLower(e.Department)
+    cat := strings.ToLower(e.Category)
+    return []string{job + "|" + dept + "|" + cat, job + "||" + cat, "||" + cat, "||"}
+}
+
+func freqKey(e data.Expense) string {
+    return strings.ToLower(e.JobTitle) + "|" + strings.ToLower(e.Department)
+}
+
+func (ps *PeerStats) Fit(es []data.Expense, labels []int) {
+    amounts := map[string][]float64{}
+    for _, e := range es {
+        for _, k := range peerKeys(e) { amounts[k] = append(amounts[k], e.Amount) }
+    }
+    ps.Groups = make(map[string]PeerGroup, len(amounts))
+    for k, vals := range amounts { ps.Groups[k] = summarizePeers(vals) }
+
+    ps.RequesterCount = map[string]int{}
+    reqGroup := map[string]string{}
+    for _, e := range es {
+        ps.RequesterCount[e.RequesterID]++
+        reqGroup[e.RequesterID] = freqKey(e)
+    }
+    perGroup := map[string][]float64{}
+    for r, c := range ps.RequesterCount { perGroup[reqGroup[r]] = append(perGroup[reqGroup[r]], float64(c)) }
+    ps.FreqMedian = map[string]float64{}
+    for g, cs := range perGroup {
+        sort.Float64s(cs)
+        ps.FreqMedian[g] = quantile(cs, 0.5)
+    }
+}
+
+func summarizePeers(vals []float64) PeerGroup {
+    sorted := append([]float64(nil), vals...)
+    sort.Float64s(sorted)
+    n := float64(len(sorted))
+    mean := 0.0
+    for _, v := range sorted { mean += v }
+    mean /= n
+    ss := 0.0
+    for _, v := range sorted { ss += (v - mean) * (v - mean) }
+    std := 0.0
+    if n > 1 { std = math.Sqrt(ss / (n - 1)) }
+    qs := make([]float64, 101)
+    for i := range qs { qs[i] = quantile(sorted, float64(i)/100) }
+    return PeerGroup{N: len(sorted), Mean: mean, Std: std, Quantiles: qs}
+}
+
+func quantile(sorted []float64, q float64) float64 {
+    if len(sorted) == 0 { return 0 }
+    pos := q * float64(len(sorted)-1)
+    lo := int(math.Floor(pos))
+    hi := int(math.Ceil(pos))
+    return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func (ps *PeerStats) Names() []string {
+    return []string{"PeerZValor", "PeerPercentilValor", "PeerTamanhoGrupo", "PeerFreqRazao"}
+}
+
+func (ps *PeerStats) Transform(e data.Expense) []float64 {
+    var g PeerGroup
+    for _, k := range peerKeys(e) {
+        if pg, ok := ps.Groups[k]; ok && pg.N >= ps.MinGroup {
+            g = pg
+            break
+        }
+    }
+    z, pct := 0.0, 0.5
+    if g.N > 0 {
+        if g.Std > 1e-9 { z = (e.Amount - g.Mean) / g.Std }
+        i := sort.SearchFloat64s(g.Quantiles, e.Amount)
+        pct = float64(i) / float64(len(g.Quantiles)-1)
+        if pct > 1 { pct = 1 }
+    }
+    freq := 0.0
+    if med := ps.FreqMedian[freqKey(e)]; med > 0 {
+        freq = float64(ps.RequesterCount[e.RequesterID]) / med
+    }
+    return []float64{z, pct, math.Log1p(float64(g.N)), freq}
+}
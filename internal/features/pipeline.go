@@ -0,0 +1,208 @@
+package features
+
+import (
+    "encoding/gob"
+    "fmt"
+    "os"
+
+    "github.com/goccy/go-yaml"
+
+    "antifraude/internal/approvers"
+    "antifraude/internal/benford"
+    "antifraude/internal/calendar"
+    "antifraude/internal/data"
+    "antifraude/internal/dedup"
+    "antifraude/internal/featurestore"
+    "antifraude/internal/graph"
+    "antifraude/internal/merchants"
+    "antifraude/internal/orgchart"
+    "antifraude/internal/policy"
+)
+
+// Transformer produz um grupo de colunas a partir de uma despesa. Os nomes
+// não podem depender dos valores: o schema do modelo é derivado deles.
+type Transformer interface {
+    Names() []string
+    Transform(e data.Expense) []float64
+}
+
+// Fitter é implementado pelos passos que aprendem estado no treino.
+type Fitter interface {
+    Fit(es []data.Expense, labels []int)
+}
+
+// Observer é implementado pelos passos que acumulam histórico de despesas
+// (treino em ordem cronológica e, na API, cada despesa pontuada).
+type Observer interface {
+    Observe(e data.Expense)
+}
+
+// Spec descreve um passo registrado: nome usado no YAML, se precisa de Fit e
+// de quais outros passos depende.
+type Spec struct {
+    Name      string
+    NeedsFit  bool
+    DependsOn []string
+    New       func() Transformer
+}
+
+var (
+    registry      = map[string]Spec{}
+    registryOrder []string
+)
+
+// Register adiciona um passo ao catálogo. O tipo concreto é registrado no gob
+// para que o pipeline salvo com o modelo seja reconstruído na API.
+func Register(s Spec) {
+    if _, dup := registry[s.Name]; dup { panic("features: passo registrado duas vezes: " + s.Name) }
+    registry[s.Name] = s
+    registryOrder = append(registryOrder, s.Name)
+    gob.Register(s.New())
+}
+
+func Registered() []string { return append([]string(nil), registryOrder...) }
+
+func init() {
+    Register(Spec{Name: "base", New: func() Transformer { return NewBaseFeatures() }})
+    Register(Spec{Name: "text", NeedsFit: true, DependsOn: []string{"base"}, New: func() Transformer { return NewTextVectorizer() }})
+    Register(Spec{Name: "peers", NeedsFit: true, DependsOn: []string{"base"}, New: func() Transformer { return NewPeerStats() }})
+    Register(Spec{Name: "categorical", NeedsFit: true, DependsOn: []string{"base"}, New: func() Transformer { return NewCategoricalEncoder() }})
+    Register(Spec{Name: "benford", NeedsFit: true, DependsOn: []string{"base"}, New: func() Transformer { return benford.NewProfile() }})
+    Register(Spec{Name: "graph", NeedsFit: true, DependsOn: []string{"base"}, New: func() Transformer { return graph.New() }})
+    Register(Spec{Name: "approvers", NeedsFit: true, DependsOn: []string{"base"}, New: func() Transformer { return approvers.New() }})
+    Register(Spec{Name: "merchants", NeedsFit: true, DependsOn: []string{"base"}, New: func() Transformer { return merchants.NewProfile() }})
+    Register(Spec{Name: "dedup", DependsOn: []string{"base"}, New: func() Transformer { return dedup.New() }})
+    Register(Spec{Name: "splits", DependsOn: []string{"base"}, New: func() Transformer { return NewSplitIndex() }})
+    Register(Spec{Name: "trips", DependsOn: []string{"base"}, New: func() Transformer { return NewTripIndex() }})
+    Register(Spec{Name: "orgchart", DependsOn: []string{"base"}, New: func() Transformer { return orgchart.New() }})
+    Register(Spec{Name: "policy", DependsOn: []string{"base"}, New: func() Transformer { return policy.New() }})
+    Register(Spec{Name: "calendar", DependsOn: []string{"base"}, New: func() Transformer { return calendar.New() }})
+    Register(Spec{Name: "history", DependsOn: []string{"base"}, New: func() Transformer { return NewHistoryFeatures() }})
+}
+
+// BaseFeatures são as colunas originais de Vectorize; as categorias do
+// one-hot ficam salvas com o modelo.
+type BaseFeatures struct {
+    Categories []string
+}
+
+func NewBaseFeatures() *BaseFeatures { return &BaseFeatures{Categories: append([]string(nil), cats...)} }
+
+func (b *BaseFeatures) Names() []string {
+    _, names := vectorizeBase(data.Expense{}, b.Categories)
+    return names
+}
+
+func (b *BaseFeatures) Transform(e data.Expense) []float64 {
+    vec, _ := vectorizeBase(e, b.Categories)
+    return vec
+}
+
+// HistoryFeatures lê as janelas de velocidade do feature store, que é
+// estado de execução e não vai no gob.
+type HistoryFeatures struct {
+    Windows []int
+    store   *featurestore.Store
+}
+
+func NewHistoryFeatures() *HistoryFeatures {
+    return &HistoryFeatures{Windows: append([]int(nil), featurestore.Windows...)}
+}
+
+func (h *HistoryFeatures) SetStore(s *featurestore.Store) { h.store = s }
+func (h *HistoryFeatures) Names() []string                 { return featurestore.Names() }
+func (h *HistoryFeatures) Transform(e data.Expense) []float64 { return h.store.Features(e) }
+
+type StepConfig struct {
+    Name    string `yaml:"name"`
+    Enabled *bool  `yaml:"enabled"`
+}
+
+// PipelineConfig lista os passos na ordem das colunas; passos ausentes ou
+// com enabled: false ficam de fora.
+type PipelineConfig struct {
+    Steps []StepConfig `yaml:"steps"`
+}
+
+func DefaultPipelineConfig() PipelineConfig {
+    var cfg PipelineConfig
+    for _, n := range registryOrder { cfg.Steps = append(cfg.Steps, StepConfig{Name: n}) }
+    return cfg
+}
+
+func LoadPipelineConfig(path string) (PipelineConfig, error) {
+    var cfg PipelineConfig
+    b, err := os.ReadFile(path)
+    if err != nil { return cfg, err }
+    if err := yaml.Unmarshal(b, &cfg); err != nil { return cfg, fmt.Errorf("pipeline %s: %w", path, err) }
+    return cfg, nil
+}
+
+// Disable desliga um passo (usado pelas flags do trainer por cima do YAML).
+func (c *PipelineConfig) Disable(name string) {
+    off := false
+    for i := range c.Steps { if c.Steps[i].Name == name { c.Steps[i].Enabled = &off } }
+}
+
+func (c PipelineConfig) enabled() []string {
+    var out []string
+    for _, s := range c.Steps { if s.Enabled == nil || *s.Enabled { out = append(out, s.Name) } }
+    return out
+}
+
+type Step struct {
+    Name string
+    T    Transformer
+}
+
+type Pipeline struct {
+    Steps []Step
+}
+
+// NewPipeline valida a configuração: passos desconhecidos, repetidos ou com
+// dependência desligada são erro.
+func NewPipeline(cfg PipelineConfig) (*Pipeline, error) {
+    names := cfg.enabled()
+    on := map[string]bool{}
+    for _, n := range names {
+        if _, ok := registry[n]; !ok { return nil, fmt.Errorf("passo de features desconhecido: %q (disponíveis: %v)", n, registryOrder) }
+        if on[n] { return nil, fmt.Errorf("passo de features repetido: %q", n) }
+        on[n] = true
+    }
+    p := &Pipeline{}
+    for _, n := range names {
+        for _, d := range registry[n].DependsOn {
+            if !on[d] { return nil, fmt.Errorf("passo %q depende de %q, que está desligado", n, d) }
+        }
+        p.Steps = append(p.Steps, Step{Name: n, T: registry[n].New()})
+    }
+    return p, nil
+}
+
+func (p *Pipeline) Get(name string) Transformer {
+    if p == nil { return nil }
+    for _, s := range p.Steps { if s.Name == name { return s.T } }
+    return nil
+}
+
+func (p *Pipeline) Fit(es []data.Expense, labels []int) {
+    for _, s := range p.Steps {
+        if f, ok := s.T.(Fitter); ok && registry[s.Name].NeedsFit { f.Fit(es, labels) }
+    }
+}
+
+func (p *Pipeline) Observe(e data.Expense) {
+    for _, s := range p.Steps {
+        if o, ok := s.T.(Observer); ok { o.Observe(e) }
+    }
+}
+
+func (p *Pipeline) Transform(e data.Expense) ([]float64, []string) {
+    var vec []float64
+    var names []string
+    for _, s := range p.Steps {
+        vec = append(vec, s.T.Transform(e)...)
+        names = append(names, s.T.Names()...)
+    }
+    return vec, names
+}
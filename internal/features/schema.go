@@ -0,0 +1,133 @@
+package features
+
+import (
+    "crypto/sha256"
+    "encoding/gob"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// SchemaVersion muda quando o significado de uma feature muda sem mudar o
+// nome (ex.: nova normalização); mudanças de nome já alteram o hash.
+const SchemaVersion = 1
+
+const (
+    TypeNumeric = "numeric"
+    TypeBinary  = "binary"
+)
+
+// Schema descreve o vetor com que um modelo foi treinado. É salvo ao lado do
+// modelo e conferido na carga da API contra o vetorizador em uso. Classes
+// guarda os nomes das tipologias na ordem das classes do modelo multiclasse
+// (vazio no binário), para a API mapear por nome e não por posição.
+type Schema struct {
+    Version int
+    Names   []string
+    Types   []string
+    Hash    string
+    Classes []string
+    index   map[string]int
+}
+
+// Table é o acesso às linhas de treino que NewSchema precisa; a
+// data.Matrix e os Datasets do trainer atendem sem cópia.
+type Table interface {
+    Rows() int
+    At(i, j int) float64
+}
+
+// NewSchema infere o tipo de cada coluna a partir das linhas de treino:
+// colunas só com 0/1 são binárias (X nil ou sem linhas: tudo é numérico).
+func NewSchema(names []string, X Table) *Schema {
+    n := 0
+    if X != nil { n = X.Rows() }
+    types := make([]string, len(names))
+    for j := range names {
+        types[j] = TypeNumeric
+        if n > 0 { types[j] = TypeBinary }
+        for i := 0; i < n; i++ {
+            if v := X.At(i, j); v != 0 && v != 1 { types[j] = TypeNumeric; break }
+        }
+    }
+    s := &Schema{Version: SchemaVersion, Names: append([]string(nil), names...), Types: types}
+    s.Hash = s.hash()
+    s.reindex()
+    return s
+}
+
+func (s *Schema) reindex() {
+    s.index = make(map[string]int, len(s.Names))
+    for i, n := range s.Names { s.index[n] = i }
+}
+
+func (s *Schema) hash() string {
+    h := sha256.New()
+    fmt.Fprintf(h, "v%d\n", s.Version)
+    for _, n := range s.Names { fmt.Fprintln(h, n) }
+    return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func (s *Schema) Index(name string) (int, bool) {
+    if s.index == nil {
+        for i, n := range s.Names { if n == name { return i, true } }
+        return 0, false
+    }
+    i, ok := s.index[name]
+    return i, ok
+}
+
+// Value busca a feature pelo nome; ausente vale 0.
+func (s *Schema) Value(v []float64, name string) float64 {
+    if i, ok := s.Index(name); ok && i < len(v) { return v[i] }
+    return 0
+}
+
+// Check compara o schema salvo com os nomes produzidos agora e descreve a
+// primeira divergência.
+func (s *Schema) Check(names []string) error {
+    if s.Version != SchemaVersion {
+        return fmt.Errorf("schema de features versão %d, esperado %d: retreine o modelo", s.Version, SchemaVersion)
+    }
+    cur := &Schema{Version: SchemaVersion, Names: names}
+    if cur.hash() == s.Hash { return nil }
+    var missing, extra []string
+    have := map[string]bool{}
+    for _, n := range names { have[n] = true }
+    for _, n := range s.Names { if !have[n] { missing = append(missing, n) } }
+    for _, n := range names { if _, ok := s.Index(n); !ok { extra = append(extra, n) } }
+    msg := fmt.Sprintf("schema de features divergente (modelo %s com %d features, vetorizador %s com %d)", s.Hash, len(s.Names), cur.hash(), len(names))
+    if len(missing) > 0 { msg += "; ausentes: " + summarize(missing) }
+    if len(extra) > 0 { msg += "; novas: " + summarize(extra) }
+    if len(missing) == 0 && len(extra) == 0 {
+        for i := range names {
+            if names[i] != s.Names[i] { msg += fmt.Sprintf("; ordem difere na posição %d (%s != %s)", i, s.Names[i], names[i]); break }
+        }
+    }
+    return fmt.Errorf("%s", msg)
+}
+
+func summarize(ns []string) string {
+    if len(ns) > 5 { return strings.Join(ns[:5], ", ") + fmt.Sprintf(" e mais %d", len(ns)-5) }
+    return strings.Join(ns, ", ")
+}
+
+func SaveSchema(path string, s *Schema) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+    f, err := os.Create(path)
+    if err != nil { return err }
+    defer f.Close()
+    return gob.NewEncoder(f).Encode(s)
+}
+
+func LoadSchema(path string) (*Schema, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    defer f.Close()
+    var s Schema
+    if err := gob.NewDecoder(f).Decode(&s); err != nil { return nil, err }
+    s.reindex()
+    return &s, nil
+}
@@ -0,0 +1,162 @@
+package features
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/goccy/go-yaml"
+
+    "antifraude/internal/data"
+)
+
+// ApprovalLimits define o valor máximo por item antes de exigir alçada
+// superior. JobTitle multiplica o limite da categoria (cargo ausente = 1).
+type ApprovalLimits struct {
+    Category map[string]float64 `yaml:"category"`
+    JobTitle map[string]float64 `yaml:"job_title"`
+}
+
+func DefaultApprovalLimits() ApprovalLimits {
+    return ApprovalLimits{
+        Category: map[string]float64{"alimentação": 300, "transporte": 800, "taxi": 300, "pedágio": 200, "hospedagem": 600},
+        JobTitle: map[string]float64{"gerente": 1.5, "diretor": 2},
+    }
+}
+
+// LoadApprovalLimits lê os limites de um YAML com as chaves category e
+// job_title; categorias e cargos ausentes do arquivo ficam com o padrão.
+func LoadApprovalLimits(path string) (ApprovalLimits, error) {
+    l := DefaultApprovalLimits()
+    b, err := os.ReadFile(path)
+    if err != nil { return l, err }
+    var cfg ApprovalLimits
+    if err := yaml.Unmarshal(b, &cfg); err != nil { return l, fmt.Errorf("limites %s: %w", path, err) }
+    for k, v := range cfg.Category {
+        if v <= 0 { return l, fmt.Errorf("limites %s: categoria %q com limite %.2f", path, k, v) }
+        l.Category[strings.ToLower(k)] = v
+    }
+    for k, v := range cfg.JobTitle {
+        if v <= 0 { return l, fmt.Errorf("limites %s: cargo %q com multiplicador %.2f", path, k, v) }
+        l.JobTitle[strings.ToLower(k)] = v
+    }
+    return l, nil
+}
+
+func (l ApprovalLimits) For(category, jobTitle string) float64 {
+    lim, ok := l.Category[strings.ToLower(category)]
+    if !ok { return 0 }
+    if m, ok := l.JobTitle[strings.ToLower(jobTitle)]; ok { lim *= m }
+    return lim
+}
+
+type SplitItem struct {
+    Seq       int64
+    Day       int32
+    RequestID string
+    Category  string
+    Amount    float64
+    ExpenseID string
+}
+
+type SplitResult struct {
+    Items      []string
+    Sum        float64
+    Limit      float64
+    Structured bool
+}
+
+// SplitIndex guarda as despesas recentes de cada solicitante para achar
+// pedidos fracionados: vários itens abaixo do limite cuja soma o excede.
+type SplitIndex struct {
+    Requesters map[string][]SplitItem
+    NextSeq    int64
+    Window     int
+    Limits     ApprovalLimits
+    mu         sync.RWMutex
+}
+
+func NewSplitIndex() *SplitIndex {
+    return &SplitIndex{Requesters: map[string][]SplitItem{}, Window: 2, Limits: DefaultApprovalLimits()}
+}
+
+func (si *SplitIndex) Add(e data.Expense) bool {
+    si.mu.Lock()
+    defer si.mu.Unlock()
+    items := si.Requesters[e.RequesterID]
+    if e.ExpenseID != "" {
+        for _, it := range items { if it.ExpenseID == e.ExpenseID { return false } }
+    }
+    day := int32(e.RequestDate.Unix() / 86400)
+    items = append(items, SplitItem{Seq: si.NextSeq, Day: day, RequestID: e.RequestID, Category: strings.ToLower(e.Category), Amount: e.Amount, ExpenseID: e.ExpenseID})
+    si.NextSeq++
+    if n := len(items); n > 1 && items[n-2].Day > day {
+        sort.SliceStable(items, func(i, j int) bool { return items[i].Day < items[j].Day })
+    }
+    si.Requesters[e.RequesterID] = items
+    return true
+}
+
+func (si *SplitIndex) Observe(e data.Expense) { si.Add(e) }
+
+func (si *SplitIndex) Compact(days int) {
+    si.mu.Lock()
+    defer si.mu.Unlock()
+    var maxDay int32
+    for _, its := range si.Requesters { if n := len(its); n > 0 && its[n-1].Day > maxDay { maxDay = its[n-1].Day } }
+    cut := maxDay - int32(days)
+    for k, its := range si.Requesters {
+        i := 0
+        for i < len(its) && its[i].Day <= cut { i++ }
+        if i == len(its) { delete(si.Requesters, k); continue }
+        si.Requesters[k] = its[i:]
+    }
+}
+
+// Group devolve os itens anteriores do mesmo solicitante e categoria que
+// compartilham o RequestID ou caem na janela de dias da despesa.
+func (si *SplitIndex) Group(e data.Expense) []SplitItem {
+    if si == nil { return nil }
+    si.mu.RLock()
+    defer si.mu.RUnlock()
+    items := si.Requesters[e.RequesterID]
+    cutoff := int64(math.MaxInt64)
+    for _, it := range items { if e.ExpenseID != "" && it.ExpenseID == e.ExpenseID { cutoff = it.Seq; break } }
+    day := int32(e.RequestDate.Unix() / 86400)
+    cat := strings.ToLower(e.Category)
+    var out []SplitItem
+    for _, it := range items {
+        if it.Seq >= cutoff || it.Category != cat { continue }
+        sameReq := e.RequestID != "" && it.RequestID == e.RequestID
+        near := it.Day <= day && day-it.Day <= int32(si.Window)
+        if sameReq || near { out = append(out, it) }
+    }
+    return out
+}
+
+// Evaluate aplica os limites ao grupo somado à própria despesa.
+func (l ApprovalLimits) Evaluate(e data.Expense, group []SplitItem) SplitResult {
+    r := SplitResult{Sum: e.Amount, Limit: l.For(e.Category, e.JobTitle)}
+    below := r.Limit > 0 && e.Amount <= r.Limit
+    for _, it := range group {
+        r.Sum += it.Amount
+        r.Items = append(r.Items, it.ExpenseID)
+        if it.Amount > r.Limit { below = false }
+    }
+    r.Structured = below && len(group) > 0 && r.Sum > r.Limit
+    return r
+}
+
+func (si *SplitIndex) Names() []string {
+    return []string{"FracSomaSobreLimite", "FracItensGrupo", "FracSuspeito"}
+}
+
+func (si *SplitIndex) Transform(e data.Expense) []float64 {
+    r := si.Limits.Evaluate(e, si.Group(e))
+    ratio := 0.0
+    if r.Limit > 0 { ratio = r.Sum / r.Limit }
+    return []float64{ratio, float64(len(r.Items)), boolToFloat(r.Structured)}
+}
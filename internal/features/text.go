@@ -0,0 +1,147 @@
+package features
+
+import (
+    "fmt"
+    "hash/fnv"
+    "math"
+    "sort"
+    "strings"
+    "unicode"
+
+    "golang.org/x/text/runes"
+    "golang.org/x/text/transform"
+    "golang.org/x/text/unicode/norm"
+
+    "antifraude/internal/data"
+)
+
+var stopwordsPT = map[string]bool{
+    "a": true, "o": true, "as": true, "os": true, "e": true, "de": true, "da": true, "do": true, "das": true, "dos": true,
+    "em": true, "no": true, "na": true, "nos": true, "nas": true, "para": true, "pra": true, "por": true, "com": true,
+    "um": true, "uma": true, "ao": true, "aos": true, "que": true, "se": true, "sem": true, "ou": true,
+}
+
+var categoryKeywords = map[string][]string{
+    "alimentacao": {"almoco", "jantar", "cafe", "refeicao", "restaurante", "lanche", "alimentacao"},
+    "transporte":  {"combustivel", "gasolina", "passagem", "onibus", "aviao", "voo", "aluguel", "carro", "transporte", "estacionamento"},
+    "taxi":        {"taxi", "uber", "corrida", "99"},
+    "pedagio":     {"pedagio", "praca"},
+    "hospedagem":  {"hotel", "pousada", "diaria", "hospedagem", "hostel"},
+}
+
+func FoldAccents(s string) string {
+    t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+    out, _, err := transform.String(t, s)
+    if err != nil { return s }
+    return out
+}
+
+func Tokenize(s string) []string {
+    s = strings.ToLower(FoldAccents(s))
+    fields := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+    out := make([]string, 0, len(fields))
+    for _, f := range fields {
+        if stopwordsPT[f] { continue }
+        if len(f) < 2 && !unicode.IsDigit(rune(f[0])) { continue }
+        out = append(out, f)
+    }
+    return out
+}
+
+type TextVectorizer struct {
+    Buckets     int
+    IDF         []float64
+    DocCounts   map[string]int
+    MaxDocCount int
+    Docs        int
+}
+
+func NewTextVectorizer() *TextVectorizer {
+    return &TextVectorizer{Buckets: 32, MaxDocCount: 10000}
+}
+
+func (tv *TextVectorizer) Fit(es []data.Expense, labels []int) {
+    descriptions := make([]string, len(es))
+    for i, e := range es { descriptions[i] = e.Description }
+    if tv.Buckets <= 0 { tv.Buckets = 32 }
+    df := make([]float64, tv.Buckets)
+    counts := map[string]int{}
+    for _, d := range descriptions {
+        seen := map[int]bool{}
+        for _, tok := range Tokenize(d) { seen[tv.bucket(tok)] = true }
+        for b := range seen { df[b]++ }
+        counts[normalizeDoc(d)]++
+    }
+    tv.Docs = len(descriptions)
+    tv.IDF = make([]float64, tv.Buckets)
+    for b := range df { tv.IDF[b] = math.Log((1+float64(tv.Docs))/(1+df[b])) + 1 }
+    tv.DocCounts = topRepeated(counts, tv.MaxDocCount)
+}
+
+func topRepeated(counts map[string]int, max int) map[string]int {
+    keys := make([]string, 0, len(counts))
+    for k, c := range counts { if c > 1 { keys = append(keys, k) } }
+    sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+    if max > 0 && len(keys) > max { keys = keys[:max] }
+    out := make(map[string]int, len(keys))
+    for _, k := range keys { out[k] = counts[k] }
+    return out
+}
+
+func normalizeDoc(d string) string { return strings.Join(Tokenize(d), " ") }
+
+func (tv *TextVectorizer) bucket(tok string) int {
+    h := fnv.New32a()
+    h.Write([]byte(tok))
+    return int(h.Sum32() % uint32(tv.Buckets))
+}
+
+func (tv *TextVectorizer) Names() []string {
+    names := make([]string, 0, tv.Buckets+6)
+    for b := 0; b < tv.Buckets; b++ { names = append(names, fmt.Sprintf("TxtHash_%02d", b)) }
+    return append(names, "TxtTamanho", "TxtTokens", "TxtTokensUnicos", "TxtCategoriaCoerente", "TxtCategoriaDivergente", "TxtRepeticao")
+}
+
+func (tv *TextVectorizer) Transform(e data.Expense) []float64 {
+    description, category := e.Description, e.Category
+    toks := Tokenize(description)
+    vec := make([]float64, tv.Buckets, tv.Buckets+6)
+    for _, tok := range toks { vec[tv.bucket(tok)]++ }
+    norm2 := 0.0
+    for b := range vec {
+        if b < len(tv.IDF) { vec[b] *= tv.IDF[b] }
+        norm2 += vec[b] * vec[b]
+    }
+    if norm2 > 0 {
+        n := math.Sqrt(norm2)
+        for b := range vec { vec[b] /= n }
+    }
+
+    uniq := map[string]bool{}
+    for _, t := range toks { uniq[t] = true }
+    uniqRatio := 0.0
+    if len(toks) > 0 { uniqRatio = float64(len(uniq)) / float64(len(toks)) }
+
+    own, other := keywordMatch(uniq, category)
+    rep := float64(tv.DocCounts[strings.Join(toks, " ")])
+
+    return append(vec,
+        float64(len([]rune(strings.TrimSpace(description)))),
+        float64(len(toks)),
+        uniqRatio,
+        boolToFloat(own),
+        boolToFloat(other && !own),
+        math.Log1p(rep),
+    )
+}
+
+func keywordMatch(toks map[string]bool, category string) (own, other bool) {
+    cat := strings.ToLower(FoldAccents(category))
+    for c, kws := range categoryKeywords {
+        for _, kw := range kws {
+            if !toks[kw] { continue }
+            if c == cat { own = true } else { other = true }
+        }
+    }
+    return
+}
@@ -0,0 +1,170 @@
+package features
+
+import (
+    "math"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "antifraude/internal/data"
+)
+
+type TripItem struct {
+    Seq       int64
+    Day       int32
+    ExpenseID string
+    Category  string
+    Amount    float64
+}
+
+// Trip resume as despesas de um mesmo pedido e viajante. A janela da viagem
+// vem de transporte e hospedagem (a diária da noite d vai até d+1); sem
+// nenhum dos dois a janela fica indefinida.
+type Trip struct {
+    RequestID          string   `json:"request_id"`
+    TravellerID        string   `json:"traveller_id"`
+    Expenses           []string `json:"expenses"`
+    Total              float64  `json:"total"`
+    Days               int      `json:"days"`
+    SpendPerDay        float64  `json:"spend_per_day"`
+    Lodging            int      `json:"lodging"`
+    Transport          int      `json:"transport"`
+    Meals              int      `json:"meals"`
+    LodgingNoTransport bool     `json:"lodging_without_transport"`
+    MealsOutside       int      `json:"meals_outside_window"`
+    OverlappingNights  int      `json:"overlapping_lodging_nights"`
+    Start              string   `json:"start,omitempty"`
+    End                string   `json:"end,omitempty"`
+}
+
+func isTransport(cat string) bool { return cat == "transporte" || cat == "taxi" || cat == "pedágio" }
+
+func dayString(d int32) string { return time.Unix(int64(d)*86400, 0).UTC().Format("2006-01-02") }
+
+func summarizeTrip(requestID, travellerID string, items []TripItem) Trip {
+    t := Trip{RequestID: requestID, TravellerID: travellerID}
+    if len(items) == 0 { return t }
+    minDay, maxDay := int32(math.MaxInt32), int32(math.MinInt32)
+    winStart, winEnd := int32(math.MaxInt32), int32(math.MinInt32)
+    nights := map[int32]int{}
+    for _, it := range items {
+        t.Expenses = append(t.Expenses, it.ExpenseID)
+        t.Total += it.Amount
+        if it.Day < minDay { minDay = it.Day }
+        if it.Day > maxDay { maxDay = it.Day }
+        switch {
+        case it.Category == "hospedagem":
+            t.Lodging++
+            nights[it.Day]++
+            if nights[it.Day] > 1 { t.OverlappingNights++ }
+            if it.Day < winStart { winStart = it.Day }
+            if it.Day+1 > winEnd { winEnd = it.Day + 1 }
+        case isTransport(it.Category):
+            t.Transport++
+            if it.Day < winStart { winStart = it.Day }
+            if it.Day > winEnd { winEnd = it.Day }
+        case it.Category == "alimentação":
+            t.Meals++
+        }
+    }
+    t.Days = int(maxDay-minDay) + 1
+    t.SpendPerDay = t.Total / float64(t.Days)
+    t.LodgingNoTransport = t.Lodging > 0 && t.Transport == 0
+    if winStart <= winEnd {
+        t.Start, t.End = dayString(winStart), dayString(winEnd)
+        for _, it := range items {
+            if it.Category == "alimentação" && (it.Day < winStart || it.Day > winEnd) { t.MealsOutside++ }
+        }
+    }
+    return t
+}
+
+// TripIndex reconstrói as viagens (RequestID + viajante) a partir das
+// despesas observadas, em ordem de chegada, para features no nível da viagem.
+type TripIndex struct {
+    Trips   map[string]map[string][]TripItem
+    NextSeq int64
+    mu      sync.RWMutex
+}
+
+func NewTripIndex() *TripIndex { return &TripIndex{Trips: map[string]map[string][]TripItem{}} }
+
+func tripItem(e data.Expense) TripItem {
+    return TripItem{Day: int32(e.TravelDate.Unix() / 86400), ExpenseID: e.ExpenseID, Category: strings.ToLower(e.Category), Amount: e.Amount}
+}
+
+func (ti *TripIndex) Observe(e data.Expense) {
+    if e.RequestID == "" { return }
+    ti.mu.Lock()
+    defer ti.mu.Unlock()
+    byTraveller := ti.Trips[e.RequestID]
+    if byTraveller == nil { byTraveller = map[string][]TripItem{}; ti.Trips[e.RequestID] = byTraveller }
+    items := byTraveller[e.TravellerID]
+    if e.ExpenseID != "" {
+        for _, it := range items { if it.ExpenseID == e.ExpenseID { return } }
+    }
+    it := tripItem(e)
+    it.Seq = ti.NextSeq
+    ti.NextSeq++
+    byTraveller[e.TravellerID] = append(items, it)
+}
+
+// Compact descarta viagens cuja última despesa ficou mais de days dias antes
+// da mais recente do índice.
+func (ti *TripIndex) Compact(days int) {
+    ti.mu.Lock()
+    defer ti.mu.Unlock()
+    var maxDay int32
+    last := func(its []TripItem) int32 {
+        var d int32 = math.MinInt32
+        for _, it := range its { if it.Day > d { d = it.Day } }
+        return d
+    }
+    for _, byT := range ti.Trips {
+        for _, its := range byT { if d := last(its); d > maxDay { maxDay = d } }
+    }
+    cut := maxDay - int32(days)
+    for req, byT := range ti.Trips {
+        for tr, its := range byT { if last(its) <= cut { delete(byT, tr) } }
+        if len(byT) == 0 { delete(ti.Trips, req) }
+    }
+}
+
+// Trip devolve a viagem de e como era quando e chegou: itens observados
+// antes dela mais a própria despesa.
+func (ti *TripIndex) Trip(e data.Expense) Trip {
+    self := tripItem(e)
+    if ti == nil || e.RequestID == "" { return summarizeTrip(e.RequestID, e.TravellerID, []TripItem{self}) }
+    ti.mu.RLock()
+    defer ti.mu.RUnlock()
+    items := ti.Trips[e.RequestID][e.TravellerID]
+    cutoff := int64(math.MaxInt64)
+    for _, it := range items { if e.ExpenseID != "" && it.ExpenseID == e.ExpenseID { cutoff = it.Seq; break } }
+    group := make([]TripItem, 0, len(items)+1)
+    for _, it := range items { if it.Seq < cutoff { group = append(group, it) } }
+    return summarizeTrip(e.RequestID, e.TravellerID, append(group, self))
+}
+
+// ByRequest devolve uma viagem por viajante do pedido, com tudo que já foi
+// observado.
+func (ti *TripIndex) ByRequest(requestID string) []Trip {
+    if ti == nil { return nil }
+    ti.mu.RLock()
+    defer ti.mu.RUnlock()
+    var out []Trip
+    for tr, its := range ti.Trips[requestID] { out = append(out, summarizeTrip(requestID, tr, its)) }
+    sort.Slice(out, func(i, j int) bool { return out[i].TravellerID < out[j].TravellerID })
+    return out
+}
+
+func (ti *TripIndex) Names() []string {
+    return []string{"ViagemItens", "ViagemTotal", "ViagemDias", "ViagemGastoPorDia", "ViagemParticipacaoValor", "ViagemHospedagemSemTransporte", "ViagemRefeicoesForaJanela", "ViagemNoitesSobrepostas"}
+}
+
+func (ti *TripIndex) Transform(e data.Expense) []float64 {
+    t := ti.Trip(e)
+    share := 0.0
+    if t.Total > 0 { share = e.Amount / t.Total }
+    return []float64{float64(len(t.Expenses)), t.Total, float64(t.Days), t.SpendPerDay, share, boolToFloat(t.LodgingNoTransport), float64(t.MealsOutside), float64(t.OverlappingNights)}
+}
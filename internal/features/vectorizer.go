@@ -0,0 +1,175 @@
+package features
+
+import (
+    "encoding/gob"
+    "os"
+    "path/filepath"
+
+    "antifraude/internal/approvers"
+    "antifraude/internal/benford"
+    "antifraude/internal/calendar"
+    "antifraude/internal/data"
+    "antifraude/internal/dedup"
+    "antifraude/internal/featurestore"
+    "antifraude/internal/fx"
+    "antifraude/internal/graph"
+    "antifraude/internal/merchants"
+    "antifraude/internal/orgchart"
+    "antifraude/internal/policy"
+)
+
+// Vectorizer envolve o pipeline de features salvo com o modelo; a API carrega
+// o mesmo pipeline e reproduz exatamente as colunas do treino.
+type Vectorizer struct {
+    Pipeline *Pipeline
+    fx       *fx.Table
+}
+
+func NewVectorizer() *Vectorizer {
+    vz, _ := NewVectorizerFromConfig(DefaultPipelineConfig())
+    return vz
+}
+
+func NewVectorizerFromConfig(cfg PipelineConfig) (*Vectorizer, error) {
+    p, err := NewPipeline(cfg)
+    if err != nil { return nil, err }
+    return &Vectorizer{Pipeline: p}, nil
+}
+
+// SetStore liga o feature store ao passo de histórico, se ele estiver ativo.
+func (vz *Vectorizer) SetStore(s *featurestore.Store) {
+    if h, ok := vz.Pipeline.Get("history").(*HistoryFeatures); ok { h.SetStore(s) }
+}
+
+// SetFX define a tabela de câmbio usada para levar valores à moeda base antes
+// de vetorizar; despesas em moeda desconhecida seguem com o valor original.
+func (vz *Vectorizer) SetFX(t *fx.Table) { vz.fx = t }
+
+// Fit ajusta todos os passos que precisam de treino; labels pode ser nil
+// para os que não usam rótulo.
+func (vz *Vectorizer) Fit(es []data.Expense, labels []int) { vz.Pipeline.Fit(es, labels) }
+
+func (vz *Vectorizer) HasStep(name string) bool { return vz != nil && vz.Pipeline.Get(name) != nil }
+
+func (vz *Vectorizer) Graph() *graph.Graph {
+    if vz == nil { return nil }
+    g, _ := vz.Pipeline.Get("graph").(*graph.Graph)
+    return g
+}
+
+func (vz *Vectorizer) Calendar() *calendar.Calendar {
+    if vz == nil { return nil }
+    c, _ := vz.Pipeline.Get("calendar").(*calendar.Calendar)
+    return c
+}
+
+func (vz *Vectorizer) OrgChart() *orgchart.Chart {
+    if vz == nil { return nil }
+    c, _ := vz.Pipeline.Get("orgchart").(*orgchart.Chart)
+    return c
+}
+
+func (vz *Vectorizer) Policy() *policy.Policy {
+    if vz == nil { return nil }
+    p, _ := vz.Pipeline.Get("policy").(*policy.Policy)
+    return p
+}
+
+func (vz *Vectorizer) Approvers() *approvers.Analytics {
+    if vz == nil { return nil }
+    a, _ := vz.Pipeline.Get("approvers").(*approvers.Analytics)
+    return a
+}
+
+func (vz *Vectorizer) Merchants() *merchants.Profile {
+    if vz == nil { return nil }
+    m, _ := vz.Pipeline.Get("merchants").(*merchants.Profile)
+    return m
+}
+
+func (vz *Vectorizer) Cats() *CategoricalEncoder {
+    if vz == nil { return nil }
+    c, _ := vz.Pipeline.Get("categorical").(*CategoricalEncoder)
+    return c
+}
+
+func (vz *Vectorizer) Benford() *benford.Profile {
+    if vz == nil { return nil }
+    p, _ := vz.Pipeline.Get("benford").(*benford.Profile)
+    return p
+}
+
+func (vz *Vectorizer) Dedup() *dedup.Index {
+    if vz == nil { return nil }
+    d, _ := vz.Pipeline.Get("dedup").(*dedup.Index)
+    return d
+}
+
+func (vz *Vectorizer) Splits() *SplitIndex {
+    if vz == nil { return nil }
+    s, _ := vz.Pipeline.Get("splits").(*SplitIndex)
+    return s
+}
+
+func (vz *Vectorizer) Trips() *TripIndex {
+    if vz == nil { return nil }
+    t, _ := vz.Pipeline.Get("trips").(*TripIndex)
+    return t
+}
+
+// Duplicates devolve despesas já indexadas que parecem a mesma cobrança.
+func (vz *Vectorizer) Duplicates(e data.Expense) []dedup.Match {
+    return vz.Dedup().Duplicates(e)
+}
+
+// Observe alimenta os passos com histórico (duplicidade, fracionamento) para
+// os pedidos futuros.
+func (vz *Vectorizer) Observe(e data.Expense) {
+    if vz == nil { return }
+    vz.Pipeline.Observe(e)
+}
+
+// SplitGroup devolve os itens já vistos que podem compor um fracionamento com e.
+func (vz *Vectorizer) SplitGroup(e data.Expense) []SplitItem {
+    return vz.Splits().Group(e)
+}
+
+// Vectorize devolve os valores já arredondados para float32, a precisão com
+// que o trainer guarda a matriz: treino e API comparam os mesmos números com
+// os limiares das árvores.
+func (vz *Vectorizer) Vectorize(e data.Expense) ([]float64, []string) {
+    if vz == nil || vz.Pipeline == nil {
+        v, names := Vectorize(e)
+        return data.Round32(v), names
+    }
+    if vz.fx != nil {
+        if n, err := ToBase(vz.fx, e); err == nil { e = n }
+    }
+    v, names := vz.Pipeline.Transform(e)
+    return data.Round32(v), names
+}
+
+// Names devolve os nomes das colunas sem depender dos valores da despesa.
+func (vz *Vectorizer) Names() []string {
+    if vz == nil || vz.Pipeline == nil { _, names := Vectorize(data.Expense{}); return names }
+    var names []string
+    for _, s := range vz.Pipeline.Steps { names = append(names, s.T.Names()...) }
+    return names
+}
+
+func SaveVectorizer(path string, vz *Vectorizer) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+    f, err := os.Create(path)
+    if err != nil { return err }
+    defer f.Close()
+    return gob.NewEncoder(f).Encode(vz)
+}
+
+func LoadVectorizer(path string) (*Vectorizer, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    defer f.Close()
+    var vz Vectorizer
+    if err := gob.NewDecoder(f).Decode(&vz); err != nil { return nil, err }
+    return &vz, nil
+}
@@ -0,0 +1,169 @@
+package featurestore
+
+import (
+    "encoding/gob"
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+
+    "antifraude/internal/data"
+)
+
+var Windows = []int{1, 7, 30}
+var Roles = []string{"requester", "traveller", "approver"}
+
+type Event struct {
+    Seq       int64
+    Day       int32
+    Amount    float64
+    ExpenseID string
+}
+
+type Store struct {
+    Entities  map[string][]Event
+    NextSeq   int64
+    Retention int
+    path      string
+    dirty     bool
+    mu        sync.RWMutex
+}
+
+func New(path string) *Store {
+    return &Store{Entities: map[string][]Event{}, Retention: 30, path: path}
+}
+
+func Open(path string) (*Store, error) {
+    s := New(path)
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) { return s, nil }
+    if err != nil { return nil, err }
+    defer f.Close()
+    if err := gob.NewDecoder(f).Decode(s); err != nil { return nil, fmt.Errorf("feature store corrompido: %w", err) }
+    if s.Entities == nil { s.Entities = map[string][]Event{} }
+    s.path = path
+    return s, nil
+}
+
+func (s *Store) Save() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.path == "" { return errors.New("feature store sem caminho") }
+    if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil { return err }
+    tmp := s.path + ".tmp"
+    f, err := os.Create(tmp)
+    if err != nil { return err }
+    if err := gob.NewEncoder(f).Encode(s); err != nil { f.Close(); return err }
+    if err := f.Close(); err != nil { return err }
+    s.dirty = false
+    return os.Rename(tmp, s.path)
+}
+
+func (s *Store) Dirty() bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.dirty
+}
+
+func dayOf(t time.Time) int32 { return int32(t.Unix() / 86400) }
+
+func keys(e data.Expense) []string {
+    return []string{"requester:" + e.RequesterID, "traveller:" + e.TravellerID, "approver:" + e.ApproverID}
+}
+
+// Add registra a despesa para solicitante, viajante e aprovador. Reenvios do
+// mesmo expense_id são ignorados para que re-scoring não infle as contagens.
+func (s *Store) Add(e data.Expense) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    day := dayOf(e.RequestDate)
+    ks := keys(e)
+    if e.ExpenseID != "" {
+        for _, ev := range s.Entities[ks[0]] { if ev.ExpenseID == e.ExpenseID { return false } }
+    }
+    seq := s.NextSeq
+    s.NextSeq++
+    for _, k := range ks {
+        evs := append(s.Entities[k], Event{Seq: seq, Day: day, Amount: e.Amount, ExpenseID: e.ExpenseID})
+        if n := len(evs); n > 1 && evs[n-2].Day > day {
+            sort.SliceStable(evs, func(i, j int) bool { return evs[i].Day < evs[j].Day })
+        }
+        if s.Retention > 0 {
+            cut := evs[len(evs)-1].Day - int32(s.Retention)
+            i := 0
+            for i < len(evs) && evs[i].Day <= cut { i++ }
+            evs = evs[i:]
+        }
+        s.Entities[k] = evs
+    }
+    s.dirty = true
+    return true
+}
+
+func (s *Store) Compact(days int) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var maxDay int32
+    for _, evs := range s.Entities { if n := len(evs); n > 0 && evs[n-1].Day > maxDay { maxDay = evs[n-1].Day } }
+    cut := maxDay - int32(days)
+    for k, evs := range s.Entities {
+        i := 0
+        for i < len(evs) && evs[i].Day <= cut { i++ }
+        if i == len(evs) { delete(s.Entities, k); continue }
+        s.Entities[k] = evs[i:]
+    }
+    s.dirty = true
+}
+
+func Names() []string {
+    names := []string{}
+    for _, r := range Roles {
+        for _, w := range Windows { names = append(names, fmt.Sprintf("FS_%s_cnt_%dd", r, w)) }
+        for _, w := range Windows { names = append(names, fmt.Sprintf("FS_%s_sum_%dd", r, w)) }
+        names = append(names, "FS_"+r+"_mean_30d", "FS_"+r+"_std_30d", "FS_"+r+"_z_30d")
+    }
+    return names
+}
+
+// Features devolve os agregados vistos até a data da despesa. Se a despesa já
+// foi ingerida, só eventos anteriores a ela (por sequência) entram na conta.
+func (s *Store) Features(e data.Expense) []float64 {
+    out := make([]float64, 0, len(Roles)*(2*len(Windows)+3))
+    if s == nil { return append(out, make([]float64, cap(out))...) }
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    asOf := dayOf(e.RequestDate)
+    for _, k := range keys(e) {
+        evs := s.Entities[k]
+        cutoff := int64(math.MaxInt64)
+        for _, ev := range evs { if e.ExpenseID != "" && ev.ExpenseID == e.ExpenseID { cutoff = ev.Seq; break } }
+        cnt := make([]float64, len(Windows))
+        sum := make([]float64, len(Windows))
+        var n, mean, m2 float64
+        for _, ev := range evs {
+            if ev.Seq >= cutoff || ev.Day > asOf { continue }
+            age := asOf - ev.Day
+            for wi, w := range Windows {
+                if age < int32(w) { cnt[wi]++; sum[wi] += ev.Amount }
+            }
+            if age < 30 {
+                n++
+                d := ev.Amount - mean
+                mean += d / n
+                m2 += d * (ev.Amount - mean)
+            }
+        }
+        std := 0.0
+        if n > 1 { std = math.Sqrt(m2 / (n - 1)) }
+        z := 0.0
+        if std > 1e-9 { z = (e.Amount - mean) / std }
+        out = append(out, cnt...)
+        out = append(out, sum...)
+        out = append(out, mean, std, z)
+    }
+    return out
+}
@@ -0,0 +1,57 @@
+package featurestore
+
+import (
+    "slices"
+    "testing"
+    "time"
+
+    "antifraude/internal/data"
+)
+
+func TestFeaturesPointInTime(t *testing.T) {
+    d := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+    exp := func(id string, days int, amount float64) data.Expense {
+        return data.Expense{ExpenseID: id, RequesterID: "r1", TravellerID: "t1", ApproverID: "a1", RequestDate: d.AddDate(0, 0, days), Amount: amount}
+    }
+    s := New("")
+    s.Retention = 0
+    for _, e := range []data.Expense{
+        exp("e1", -40, 100),
+        exp("e2", -10, 200),
+        exp("e3", -3, 300),
+        exp("e4", 0, 400),
+        exp("e5", 5, 500),
+        exp("e6", -1, 600), // chega depois de e5, com data anterior
+    } {
+        if !s.Add(e) { t.Fatalf("Add(%s) recusado", e.ExpenseID) }
+    }
+    if s.Add(exp("e4", 0, 400)) { t.Fatal("reenvio de e4 foi contado") }
+
+    names := Names()
+    col := func(v []float64, name string) float64 { return v[slices.Index(names, name)] }
+    cases := []struct {
+        name              string
+        e                 data.Expense
+        cnt1, cnt7, cnt30 float64
+        sum30             float64
+    }{
+        {"despesa nova no dia D", exp("", 0, 1), 1, 3, 4, 1500},
+        {"e4 já ingerida vê só o que veio antes", exp("e4", 0, 400), 0, 1, 2, 500},
+        {"e3 no próprio dia", exp("e3", -3, 300), 0, 0, 1, 200},
+        {"data no passado ignora eventos futuros", exp("", -30, 1), 0, 0, 1, 100},
+        {"e6 atrasada vê e5 por sequência, mas não pela data", exp("e6", -1, 600), 0, 1, 2, 500},
+    }
+    for _, c := range cases {
+        t.Run(c.name, func(t *testing.T) {
+            v := s.Features(c.e)
+            if len(v) != len(names) { t.Fatalf("%d features, esperado %d", len(v), len(names)) }
+            got := []float64{col(v, "FS_requester_cnt_1d"), col(v, "FS_requester_cnt_7d"), col(v, "FS_requester_cnt_30d"), col(v, "FS_requester_sum_30d")}
+            want := []float64{c.cnt1, c.cnt7, c.cnt30, c.sum30}
+            if !slices.Equal(got, want) { t.Errorf("cnt_1d/7d/30d, sum_30d = %v, esperado %v", got, want) }
+            if col(v, "FS_approver_cnt_30d") != c.cnt30 { t.Errorf("aprovador com contagem diferente do solicitante: %v", col(v, "FS_approver_cnt_30d")) }
+        })
+    }
+
+    var empty *Store
+    if v := empty.Features(exp("", 0, 1)); len(v) != len(names) || slices.Max(v) != 0 { t.Errorf("store nil = %v", v) }
+}
@@ -0,0 +1,91 @@
+package fx
+
+import (
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "os"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var ErrUnknownCurrency = errors.New("moeda desconhecida")
+
+type Rate struct {
+    Date  time.Time
+    Value float64
+}
+
+// Table guarda cotações datadas em unidades da moeda base por unidade da
+// moeda estrangeira.
+type Table struct {
+    Base  string
+    Rates map[string][]Rate
+}
+
+func New(base string) *Table {
+    return &Table{Base: strings.ToUpper(base), Rates: map[string][]Rate{}}
+}
+
+// Load lê um CSV date,currency,rate (rate = moeda base por unidade) com base BRL.
+func Load(path string) (*Table, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil { return nil, err }
+    t := New("BRL")
+    for i, row := range rows {
+        if i == 0 && strings.EqualFold(row[0], "date") { continue }
+        if len(row) < 3 { return nil, fmt.Errorf("linha %d: esperado date,currency,rate", i+1) }
+        d, err := time.Parse("2006-01-02", row[0])
+        if err != nil { return nil, fmt.Errorf("linha %d: %w", i+1, err) }
+        v, err := strconv.ParseFloat(row[2], 64)
+        if err != nil || v <= 0 { return nil, fmt.Errorf("linha %d: cotação inválida %q", i+1, row[2]) }
+        t.Add(row[1], d, v)
+    }
+    return t, nil
+}
+
+// Add insere a cotação mantendo a ordem por data, depois das de mesma data
+// (a última carregada vale); CSV já em ordem só faz append.
+func (t *Table) Add(currency string, date time.Time, value float64) {
+    cur := strings.ToUpper(strings.TrimSpace(currency))
+    rs := t.Rates[cur]
+    i := sort.Search(len(rs), func(i int) bool { return rs[i].Date.After(date) })
+    t.Rates[cur] = slices.Insert(rs, i, Rate{Date: date, Value: value})
+}
+
+func (t *Table) Known(currency string) bool {
+    cur := strings.ToUpper(strings.TrimSpace(currency))
+    if cur == "" || cur == t.Base { return true }
+    return len(t.Rates[cur]) > 0
+}
+
+func (t *Table) Currencies() []string {
+    out := []string{t.Base}
+    for c := range t.Rates { out = append(out, c) }
+    sort.Strings(out[1:])
+    return out
+}
+
+// Rate devolve a última cotação até a data; antes da primeira cotação usa a
+// mais antiga. Moeda vazia é tratada como a base.
+func (t *Table) Rate(currency string, date time.Time) (float64, error) {
+    cur := strings.ToUpper(strings.TrimSpace(currency))
+    if cur == "" || cur == t.Base { return 1, nil }
+    rs := t.Rates[cur]
+    if len(rs) == 0 { return 0, fmt.Errorf("%w: %s", ErrUnknownCurrency, currency) }
+    i := sort.Search(len(rs), func(i int) bool { return rs[i].Date.After(date) })
+    if i == 0 { return rs[0].Value, nil }
+    return rs[i-1].Value, nil
+}
+
+func (t *Table) Convert(amount float64, currency string, date time.Time) (float64, error) {
+    r, err := t.Rate(currency, date)
+    if err != nil { return 0, err }
+    return amount * r, nil
+}
@@ -0,0 +1,245 @@
+package graph
+
+import (
+    "math"
+    "math/rand"
+    "sort"
+
+    "antifraude/internal/data"
+)
+
+type Edge struct {
+    Source string `json:"source"`
+    Target string `json:"target"`
+    Type   string `json:"type"`
+    Count  int    `json:"count"`
+}
+
+type NodeStats struct {
+    Total  int
+    Frauds int
+}
+
+type Graph struct {
+    Approvals   map[string]map[string]int
+    Travels     map[string]map[string]int
+    ApproverOf  map[string]map[string]int
+    Nodes       map[string]NodeStats
+    Community   map[string]int
+    Communities map[int]NodeStats
+    Prior       float64
+    Smoothing   float64
+    Folds       int
+}
+
+func New() *Graph {
+    return &Graph{Smoothing: 20, Folds: 5}
+}
+
+func addEdge(m map[string]map[string]int, a, b string) {
+    if m[a] == nil { m[a] = map[string]int{} }
+    m[a][b]++
+}
+
+func (g *Graph) Fit(es []data.Expense, labels []int) {
+    g.Approvals = map[string]map[string]int{}
+    g.Travels = map[string]map[string]int{}
+    g.ApproverOf = map[string]map[string]int{}
+    g.Nodes = map[string]NodeStats{}
+    frauds := 0
+    for i, e := range es {
+        addEdge(g.Approvals, e.RequesterID, e.ApproverID)
+        addEdge(g.ApproverOf, e.ApproverID, e.RequesterID)
+        if e.TravellerID != e.RequesterID { addEdge(g.Travels, e.RequesterID, e.TravellerID) }
+        fraud := labels != nil && labels[i] > 0
+        if fraud { frauds++ }
+        count(g.Nodes, e, fraud)
+    }
+    if len(es) > 0 { g.Prior = float64(frauds) / float64(len(es)) }
+    g.detectCommunities(10)
+}
+
+// count soma a despesa a cada pessoa envolvida, uma vez só por pessoa.
+func count(nodes map[string]NodeStats, e data.Expense, fraud bool) {
+    seen := map[string]bool{}
+    for _, id := range []string{e.RequesterID, e.TravellerID, e.ApproverID} {
+        if seen[id] { continue }
+        seen[id] = true
+        st := nodes[id]
+        st.Total++
+        if fraud { st.Frauds++ }
+        nodes[id] = st
+    }
+}
+
+// detectCommunities usa propagação de rótulos ponderada, em ordem determinística.
+func (g *Graph) detectCommunities(maxIter int) {
+    ids := make([]string, 0, len(g.Nodes))
+    for id := range g.Nodes { ids = append(ids, id) }
+    sort.Strings(ids)
+    label := make(map[string]int, len(ids))
+    for i, id := range ids { label[id] = i }
+    adj := make(map[string]map[string]int, len(ids))
+    link := func(a, b string, c int) {
+        if a == b { return }
+        if adj[a] == nil { adj[a] = map[string]int{} }
+        if adj[b] == nil { adj[b] = map[string]int{} }
+        adj[a][b] += c
+        adj[b][a] += c
+    }
+    for a, ns := range g.Approvals { for b, c := range ns { link(a, b, c) } }
+    for a, ns := range g.Travels { for b, c := range ns { link(a, b, c) } }
+    for it := 0; it < maxIter; it++ {
+        changed := false
+        for _, id := range ids {
+            votes := map[int]int{}
+            for n, c := range adj[id] { votes[label[n]] += c }
+            if len(votes) == 0 { continue }
+            best, bestVotes := label[id], -1
+            for l, v := range votes {
+                if v > bestVotes || v == bestVotes && l < best { best, bestVotes = l, v }
+            }
+            if best != label[id] { label[id] = best; changed = true }
+        }
+        if !changed { break }
+    }
+    g.Community = label
+    g.Communities = map[int]NodeStats{}
+    for id, l := range label {
+        st := g.Communities[l]
+        st.Total += g.Nodes[id].Total
+        st.Frauds += g.Nodes[id].Frauds
+        g.Communities[l] = st
+    }
+}
+
+func (g *Graph) smoothed(st NodeStats) float64 { return g.smoothedWith(st, g.Prior) }
+
+func (g *Graph) smoothedWith(st NodeStats, prior float64) float64 {
+    return (float64(st.Frauds) + prior*g.Smoothing) / (float64(st.Total) + g.Smoothing)
+}
+
+func (g *Graph) NodeFraudRate(id string) float64 { return g.smoothed(g.Nodes[id]) }
+
+func (g *Graph) CommunityFraudRate(id string) float64 {
+    l, ok := g.Community[id]
+    if !ok { return g.Prior }
+    return g.smoothed(g.Communities[l])
+}
+
+func (g *Graph) Names() []string {
+    return []string{"GrafoConcentracaoAprovador", "GrafoShareParAprovador", "GrafoAprovacaoReciproca", "GrafoGrauAprovador", "GrafoGrauSolicitante", "GrafoTaxaFraudeComunidade", "GrafoTaxaFraudeAprovador"}
+}
+
+// TargetNames são as colunas que dependem do rótulo; ficam no fim de Names.
+func (g *Graph) TargetNames() []string { return g.Names()[5:] }
+
+// OutOfFold devolve as taxas de fraude da comunidade e do aprovador de cada
+// linha de treino contadas sem a própria fold, para que o modelo não aprenda
+// com o rótulo da linha. As comunidades não dependem do rótulo e vêm do Fit.
+func (g *Graph) OutOfFold(es []data.Expense, labels []int, seed int64) [][]float64 {
+    k := g.Folds
+    if k < 2 { k = 2 }
+    fold := make([]int, len(es))
+    for i, j := range rand.New(rand.NewSource(seed)).Perm(len(es)) { fold[j] = i % k }
+    all := map[string]NodeStats{}
+    nodes := make([]map[string]NodeStats, k)
+    total, frauds := make([]int, k), make([]int, k)
+    for f := range nodes { nodes[f] = map[string]NodeStats{} }
+    for i, e := range es {
+        fraud := labels != nil && labels[i] > 0
+        total[fold[i]]++
+        if fraud { frauds[fold[i]]++ }
+        count(all, e, fraud)
+        count(nodes[fold[i]], e, fraud)
+    }
+    allFrauds := 0
+    for _, c := range frauds { allFrauds += c }
+    out := make([][]float64, len(es))
+    for f := 0; f < k; f++ {
+        prior := g.Prior
+        if n := len(es) - total[f]; n > 0 { prior = float64(allFrauds-frauds[f]) / float64(n) }
+        without := func(id string) NodeStats {
+            a, b := all[id], nodes[f][id]
+            return NodeStats{Total: a.Total - b.Total, Frauds: a.Frauds - b.Frauds}
+        }
+        comm := map[int]NodeStats{}
+        for id := range all {
+            l, ok := g.Community[id]
+            if !ok { continue }
+            st, w := comm[l], without(id)
+            st.Total += w.Total
+            st.Frauds += w.Frauds
+            comm[l] = st
+        }
+        for i, e := range es {
+            if fold[i] != f { continue }
+            cr := prior
+            if l, ok := g.Community[e.RequesterID]; ok { cr = g.smoothedWith(comm[l], prior) }
+            out[i] = []float64{cr, g.smoothedWith(without(e.ApproverID), prior)}
+        }
+    }
+    return out
+}
+
+func (g *Graph) Transform(e data.Expense) []float64 {
+    appr := g.Approvals[e.RequesterID]
+    total := 0
+    for _, c := range appr { total += c }
+    hhi, share := 0.0, 0.0
+    if total > 0 {
+        for _, c := range appr { p := float64(c) / float64(total); hhi += p * p }
+        share = float64(appr[e.ApproverID]) / float64(total)
+    }
+    reciprocal := 0.0
+    if e.RequesterID != e.ApproverID && g.Approvals[e.ApproverID][e.RequesterID] > 0 { reciprocal = 1 }
+    return []float64{
+        hhi,
+        share,
+        reciprocal,
+        math.Log1p(float64(len(g.ApproverOf[e.ApproverID]))),
+        math.Log1p(float64(len(appr))),
+        g.CommunityFraudRate(e.RequesterID),
+        g.NodeFraudRate(e.ApproverID),
+    }
+}
+
+type Neighbourhood struct {
+    UserID             string     `json:"user_id"`
+    Community          int        `json:"community"`
+    CommunityFraudRate float64    `json:"community_fraud_rate"`
+    Nodes              []NodeView `json:"nodes"`
+    Edges              []Edge     `json:"edges"`
+}
+
+type NodeView struct {
+    ID        string  `json:"id"`
+    Total     int     `json:"total"`
+    FraudRate float64 `json:"fraud_rate"`
+}
+
+func (g *Graph) Neighbourhood(id string, limit int) (Neighbourhood, bool) {
+    if _, ok := g.Nodes[id]; !ok { return Neighbourhood{}, false }
+    edges := []Edge{}
+    for n, c := range g.Approvals[id] { edges = append(edges, Edge{Source: id, Target: n, Type: "aprovado_por", Count: c}) }
+    for n, c := range g.ApproverOf[id] {
+        if n == id { continue }
+        edges = append(edges, Edge{Source: n, Target: id, Type: "aprovado_por", Count: c})
+    }
+    for n, c := range g.Travels[id] { edges = append(edges, Edge{Source: id, Target: n, Type: "viajante", Count: c}) }
+    sort.Slice(edges, func(i, j int) bool {
+        if edges[i].Count != edges[j].Count { return edges[i].Count > edges[j].Count }
+        return edges[i].Source+edges[i].Target < edges[j].Source+edges[j].Target
+    })
+    if limit > 0 && len(edges) > limit { edges = edges[:limit] }
+    seen := map[string]bool{id: true}
+    nodes := []NodeView{{ID: id, Total: g.Nodes[id].Total, FraudRate: g.NodeFraudRate(id)}}
+    for _, e := range edges {
+        for _, n := range []string{e.Source, e.Target} {
+            if seen[n] { continue }
+            seen[n] = true
+            nodes = append(nodes, NodeView{ID: n, Total: g.Nodes[n].Total, FraudRate: g.NodeFraudRate(n)})
+        }
+    }
+    return Neighbourhood{UserID: id, Community: g.Community[id], CommunityFraudRate: g.CommunityFraudRate(id), Nodes: nodes, Edges: edges}, true
+}
@@ -0,0 +1,52 @@
+package graph
+
+import (
+    "fmt"
+    "testing"
+
+    "antifraude/internal/data"
+)
+
+// Um anel só de fraudes, um anel limpo e uma despesa isolada: fora da fold,
+// os anéis continuam separados pelos rótulos das outras folds, e a despesa
+// isolada não tem de onde tirar sinal além do prior.
+func TestOutOfFoldCommunityRates(t *testing.T) {
+    var es []data.Expense
+    var labels []int
+    ring := func(prefix string, people, n, fraud int) []int {
+        var rows []int
+        for i := 0; i < n; i++ {
+            r := fmt.Sprintf("%s%d", prefix, i%people)
+            rows = append(rows, len(es))
+            es = append(es, data.Expense{RequesterID: r, TravellerID: r, ApproverID: prefix + "x"})
+            labels = append(labels, fraud)
+        }
+        return rows
+    }
+    fraudRing := ring("a", 5, 50, 1)
+    cleanRing := ring("b", 10, 150, 0)
+    lone := ring("s", 1, 1, 1)
+
+    g := New()
+    g.Fit(es, labels)
+    oof := g.OutOfFold(es, labels, 11)
+    cases := []struct {
+        name   string
+        rows   []int
+        lo, hi float64
+    }{
+        {"anel de fraude", fraudRing, 0.6, 1},
+        {"anel limpo", cleanRing, 0, 0.1},
+        {"despesa isolada fica no prior", lone, g.Prior - 0.05, g.Prior + 0.05},
+    }
+    for _, c := range cases {
+        for _, i := range c.rows {
+            for j, v := range oof[i] {
+                if v < c.lo || v > c.hi { t.Errorf("%s, linha %d, %s = %.3f, fora de [%.2f, %.2f]", c.name, i, g.TargetNames()[j], v, c.lo, c.hi) }
+            }
+        }
+    }
+    // no próprio Fit a fraude isolada puxa a taxa da comunidade para cima
+    in := g.Transform(es[lone[0]])[5]
+    if in <= oof[lone[0]][0]+0.02 { t.Errorf("taxa no treino %.3f não ficou acima da fora da fold %.3f", in, oof[lone[0]][0]) }
+}
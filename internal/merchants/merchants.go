@@ -0,0 +1,340 @@
+package merchants
+
+import (
+    "encoding/csv"
+    "fmt"
+    "math/rand"
+    "os"
+    "regexp"
+    "strings"
+    "time"
+    "unicode"
+
+    "golang.org/x/text/runes"
+    "golang.org/x/text/transform"
+    "golang.org/x/text/unicode/norm"
+
+    "antifraude/internal/data"
+)
+
+// CNPJDigits devolve só os dígitos do CNPJ (aceita com ou sem máscara).
+func CNPJDigits(s string) string {
+    var b strings.Builder
+    for _, r := range s { if r >= '0' && r <= '9' { b.WriteRune(r) } }
+    return b.String()
+}
+
+// CNPJCheckDigits calcula os dois dígitos verificadores a partir dos 12
+// primeiros dígitos.
+func CNPJCheckDigits(base string) string {
+    calc := func(ds string, weights []int) byte {
+        sum := 0
+        for i, w := range weights { sum += int(ds[i]-'0') * w }
+        r := sum % 11
+        if r < 2 { return '0' }
+        return byte('0' + 11 - r)
+    }
+    d1 := calc(base, []int{5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2})
+    d2 := calc(base+string(d1), []int{6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2})
+    return string([]byte{d1, d2})
+}
+
+// ValidCNPJ confere tamanho e dígitos verificadores; sequências repetidas
+// (00000000000000 etc.) são inválidas.
+func ValidCNPJ(s string) bool {
+    d := CNPJDigits(s)
+    if len(d) != 14 || strings.Count(d, d[:1]) == 14 { return false }
+    return CNPJCheckDigits(d[:12]) == d[12:]
+}
+
+func FormatCNPJ(s string) string {
+    d := CNPJDigits(s)
+    if len(d) != 14 { return s }
+    return d[:2] + "." + d[2:5] + "." + d[5:8] + "/" + d[8:12] + "-" + d[12:]
+}
+
+var legalSuffixes = map[string]bool{"ltda": true, "me": true, "epp": true, "eireli": true, "sa": true, "mei": true, "cia": true}
+
+// sociedadeAnonima junta "S/A" e "S.A." em "sa" antes de a pontuação virar
+// separador e quebrar a sigla em "s" e "a".
+var sociedadeAnonima = regexp.MustCompile(`(^|[^\pL\pN])s\s*[./]\s*a\.?($|[^\pL\pN])`)
+
+// NormalizeName deixa o nome comparável: minúsculas, sem acentos nem
+// pontuação e sem sufixos societários.
+func NormalizeName(s string) string {
+    t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+    if out, _, err := transform.String(t, s); err == nil { s = out }
+    s = sociedadeAnonima.ReplaceAllString(strings.ToLower(s), "${1}sa${2}")
+    fields := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+    out := fields[:0]
+    for _, f := range fields { if !legalSuffixes[f] { out = append(out, f) } }
+    return strings.Join(out, " ")
+}
+
+func Levenshtein(a, b string) int {
+    ra, rb := []rune(a), []rune(b)
+    prev := make([]int, len(rb)+1)
+    cur := make([]int, len(rb)+1)
+    for j := range prev { prev[j] = j }
+    for i := 1; i <= len(ra); i++ {
+        cur[0] = i
+        for j := 1; j <= len(rb); j++ {
+            cost := 1
+            if ra[i-1] == rb[j-1] { cost = 0 }
+            cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+        }
+        prev, cur = cur, prev
+    }
+    return prev[len(rb)]
+}
+
+// LevenshteinSim normaliza a distância pelo maior nome (1 = iguais).
+func LevenshteinSim(a, b string) float64 {
+    n := max(len([]rune(a)), len([]rune(b)))
+    if n == 0 { return 1 }
+    return 1 - float64(Levenshtein(a, b))/float64(n)
+}
+
+// JaroWinkler favorece nomes com o mesmo começo, comum em variações de
+// razão social ("Hotel Central" / "Hotel Central Plaza").
+func JaroWinkler(a, b string) float64 {
+    ra, rb := []rune(a), []rune(b)
+    if len(ra) == 0 && len(rb) == 0 { return 1 }
+    if len(ra) == 0 || len(rb) == 0 { return 0 }
+    win := max(len(ra), len(rb))/2 - 1
+    if win < 0 { win = 0 }
+    ma, mb := make([]bool, len(ra)), make([]bool, len(rb))
+    m := 0
+    for i := range ra {
+        for j := max(0, i-win); j < min(len(rb), i+win+1); j++ {
+            if mb[j] || ra[i] != rb[j] { continue }
+            ma[i], mb[j] = true, true
+            m++
+            break
+        }
+    }
+    if m == 0 { return 0 }
+    t, k := 0, 0
+    for i := range ra {
+        if !ma[i] { continue }
+        for !mb[k] { k++ }
+        if ra[i] != rb[k] { t++ }
+        k++
+    }
+    fm := float64(m)
+    jaro := (fm/float64(len(ra)) + fm/float64(len(rb)) + (fm-float64(t)/2)/fm) / 3
+    prefix := 0
+    for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] { prefix++ }
+    return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// Similarity é o maior entre Jaro-Winkler e Levenshtein normalizado, sobre
+// nomes já normalizados.
+func Similarity(a, b string) float64 { return max(JaroWinkler(a, b), LevenshteinSim(a, b)) }
+
+const (
+    Blocklist = "block"
+    Watchlist = "watch"
+)
+
+type ListEntry struct {
+    Name   string
+    CNPJ   string
+    List   string
+    Reason string
+    norm   string
+}
+
+type ListMatch struct {
+    Name       string  `json:"name"`
+    CNPJ       string  `json:"cnpj,omitempty"`
+    List       string  `json:"list"`
+    Reason     string  `json:"reason,omitempty"`
+    Similarity float64 `json:"similarity"`
+}
+
+// List é a lista local de estabelecimentos bloqueados ou em observação.
+// Threshold é a similaridade mínima de nome para considerar o mesmo
+// estabelecimento; CNPJ igual casa sempre.
+type List struct {
+    Entries   []ListEntry
+    Threshold float64
+}
+
+func NewList() *List { return &List{Threshold: 0.9} }
+
+// Load lê name,cnpj,list,reason (list = block|watch).
+func (l *List) Load(path string) error {
+    f, err := os.Open(path)
+    if err != nil { return err }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil { return err }
+    var entries []ListEntry
+    for i, row := range rows {
+        if len(row) < 3 { return fmt.Errorf("linha %d: esperado name,cnpj,list[,reason]", i+1) }
+        if i == 0 && strings.EqualFold(row[0], "name") { continue }
+        e := ListEntry{Name: row[0], CNPJ: CNPJDigits(row[1]), List: strings.ToLower(row[2])}
+        if e.List != Blocklist && e.List != Watchlist { return fmt.Errorf("linha %d: lista %q inválida (block|watch)", i+1, row[2]) }
+        if len(row) > 3 { e.Reason = row[3] }
+        e.norm = NormalizeName(e.Name)
+        entries = append(entries, e)
+    }
+    l.Entries = entries
+    return nil
+}
+
+// Match devolve a entrada mais parecida acima do limiar; bloqueio vence
+// observação em caso de empate.
+func (l *List) Match(name, cnpj string) (ListMatch, bool) {
+    if l == nil { return ListMatch{}, false }
+    n, d := NormalizeName(name), CNPJDigits(cnpj)
+    var best ListMatch
+    found := false
+    for _, e := range l.Entries {
+        sim := 0.0
+        if d != "" && e.CNPJ == d {
+            sim = 1
+        } else if n != "" {
+            en := e.norm
+            if en == "" { en = NormalizeName(e.Name) }
+            sim = Similarity(n, en)
+        }
+        if sim < l.Threshold { continue }
+        if !found || sim > best.Similarity || sim == best.Similarity && e.List == Blocklist {
+            best = ListMatch{Name: e.Name, CNPJ: e.CNPJ, List: e.List, Reason: e.Reason, Similarity: sim}
+            found = true
+        }
+    }
+    return best, found
+}
+
+// Key identifica o estabelecimento: CNPJ válido ou, na falta, o nome
+// normalizado.
+func Key(e data.Expense) string {
+    if ValidCNPJ(e.MerchantTaxID) { return CNPJDigits(e.MerchantTaxID) }
+    return NormalizeName(e.Merchant)
+}
+
+type Stats struct {
+    FirstSeen time.Time
+    N         int
+    Fraud     int
+    Employees int
+    seen      map[string]bool
+}
+
+// Profile reúne a lista de risco e os agregados por estabelecimento vistos
+// no treino (primeira aparição, funcionários distintos, taxa de fraude
+// suavizada para a global).
+type Profile struct {
+    List      *List
+    Merchants map[string]*Stats
+    Prior     float64
+    Smoothing float64
+    Folds     int
+}
+
+func NewProfile() *Profile {
+    return &Profile{List: NewList(), Merchants: map[string]*Stats{}, Smoothing: 10, Folds: 5}
+}
+
+func (p *Profile) Fit(es []data.Expense, labels []int) {
+    p.Merchants = map[string]*Stats{}
+    fraud, n := 0, 0
+    for i, e := range es {
+        k := Key(e)
+        if k == "" { continue }
+        st := p.Merchants[k]
+        if st == nil { st = &Stats{FirstSeen: e.RequestDate, seen: map[string]bool{}}; p.Merchants[k] = st }
+        if e.RequestDate.Before(st.FirstSeen) { st.FirstSeen = e.RequestDate }
+        st.N++
+        n++
+        if labels != nil && labels[i] == 1 { st.Fraud++; fraud++ }
+        if !st.seen[e.RequesterID] { st.seen[e.RequesterID] = true; st.Employees++ }
+    }
+    for _, st := range p.Merchants { st.seen = nil }
+    if n > 0 { p.Prior = float64(fraud) / float64(n) }
+}
+
+func (p *Profile) FraudRate(st *Stats) float64 {
+    if st == nil { return p.Prior }
+    return p.rate(st.Fraud, st.N, p.Prior)
+}
+
+func (p *Profile) rate(fraud, n int, prior float64) float64 {
+    return (float64(fraud) + p.Smoothing*prior) / (float64(n) + p.Smoothing)
+}
+
+// TargetNames é a coluna que depende do rótulo, a última de Names.
+func (p *Profile) TargetNames() []string { return p.Names()[8:] }
+
+// OutOfFold devolve a taxa de fraude do estabelecimento de cada linha de
+// treino contada sem a própria fold, para que o modelo não aprenda com o
+// rótulo da linha.
+func (p *Profile) OutOfFold(es []data.Expense, labels []int, seed int64) [][]float64 {
+    k := p.Folds
+    if k < 2 { k = 2 }
+    fold := make([]int, len(es))
+    for i, j := range rand.New(rand.NewSource(seed)).Perm(len(es)) { fold[j] = i % k }
+    keys := make([]string, len(es))
+    all := map[string]*Stats{}
+    byFold := make([]map[string]*Stats, k)
+    for f := range byFold { byFold[f] = map[string]*Stats{} }
+    var total Stats
+    foldTotals := make([]Stats, k)
+    for i, e := range es {
+        keys[i] = Key(e)
+        if keys[i] == "" { continue }
+        fraud := 0
+        if labels != nil && labels[i] == 1 { fraud = 1 }
+        for _, m := range []map[string]*Stats{all, byFold[fold[i]]} {
+            st := m[keys[i]]
+            if st == nil { st = &Stats{}; m[keys[i]] = st }
+            st.N++
+            st.Fraud += fraud
+        }
+        total.N++
+        total.Fraud += fraud
+        foldTotals[fold[i]].N++
+        foldTotals[fold[i]].Fraud += fraud
+    }
+    out := make([][]float64, len(es))
+    for i := range es {
+        tf := foldTotals[fold[i]]
+        prior := p.Prior
+        if n := total.N - tf.N; n > 0 { prior = float64(total.Fraud-tf.Fraud) / float64(n) }
+        rate := prior
+        if keys[i] != "" {
+            st, sf := all[keys[i]], byFold[fold[i]][keys[i]]
+            if n := st.N - sf.N; n > 0 { rate = p.rate(st.Fraud-sf.Fraud, n, prior) }
+        }
+        out[i] = []float64{rate}
+    }
+    return out
+}
+
+// Check resume os sinais de estabelecimento de uma despesa para a API.
+func (p *Profile) Check(e data.Expense) (ListMatch, bool, bool) {
+    cnpjInvalid := e.MerchantTaxID != "" && !ValidCNPJ(e.MerchantTaxID)
+    m, ok := p.List.Match(e.Merchant, e.MerchantTaxID)
+    return m, ok, cnpjInvalid
+}
+
+func (p *Profile) Names() []string {
+    return []string{"MercInformado", "MercCNPJInvalido", "MercBloqueado", "MercObservado", "MercSimilaridadeLista", "MercConhecido", "MercDiasDesdePrimeiraVez", "MercFuncionarios", "MercTaxaFraude"}
+}
+
+func (p *Profile) Transform(e data.Expense) []float64 {
+    b := func(v bool) float64 { if v { return 1 }; return 0 }
+    k := Key(e)
+    if k == "" { return []float64{0, 0, 0, 0, 0, 0, 0, 0, p.Prior} }
+    m, listed, invalid := p.Check(e)
+    st := p.Merchants[k]
+    days, emps := 0.0, 0.0
+    if st != nil {
+        days = max(0, e.RequestDate.Sub(st.FirstSeen).Hours()/24)
+        emps = float64(st.Employees)
+    }
+    return []float64{1, b(invalid), b(listed && m.List == Blocklist), b(listed && m.List == Watchlist), m.Similarity, b(st != nil), days, emps, p.FraudRate(st)}
+}
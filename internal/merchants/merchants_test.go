@@ -0,0 +1,91 @@
+package merchants
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "testing"
+
+    "antifraude/internal/data"
+)
+
+func TestNormalizeName(t *testing.T) {
+    cases := []struct{ in, want string }{
+        {"Foo S/A", "foo"},
+        {"Foo S.A.", "foo"},
+        {"Foo S.A", "foo"},
+        {"FOO LTDA", "foo"},
+        {"Foo s/a Ltda.", "foo"},
+        {"Hotel São João EIRELI", "hotel sao joao"},
+        {"Casa & Cia", "casa"},
+        {"Posto Sol", "posto sol"},
+    }
+    for _, c := range cases {
+        if got := NormalizeName(c.in); got != c.want { t.Errorf("NormalizeName(%q) = %q, esperado %q", c.in, got, c.want) }
+    }
+}
+
+func TestValidCNPJ(t *testing.T) {
+    if got := CNPJCheckDigits("112223330001"); got != "81" { t.Fatalf("CNPJCheckDigits = %q, esperado 81", got) }
+    cases := []struct {
+        cnpj string
+        ok   bool
+    }{
+        {"11.222.333/0001-81", true},
+        {"11222333000181", true},
+        {"11.444.777/0001-61", true},
+        {"11.222.333/0001-80", false},
+        {"11.222.333/0001-18", false},
+        {"00.000.000/0000-00", false},
+        {"1122233300018", false},
+        {"", false},
+    }
+    for _, c := range cases {
+        if got := ValidCNPJ(c.cnpj); got != c.ok { t.Errorf("ValidCNPJ(%q) = %v", c.cnpj, got) }
+    }
+}
+
+func TestStringDistances(t *testing.T) {
+    cases := []struct {
+        a, b string
+        lev  int
+        jw   float64
+    }{
+        {"", "", 0, 1},
+        {"abc", "", 3, 0},
+        {"kitten", "sitting", 3, 0.746},
+        {"martha", "marhta", 2, 0.961},
+        {"dwayne", "duane", 2, 0.840},
+        {"são", "sao", 1, 0.800},
+        {"hotel central", "hotel central", 0, 1},
+    }
+    for _, c := range cases {
+        if got := Levenshtein(c.a, c.b); got != c.lev { t.Errorf("Levenshtein(%q, %q) = %d, esperado %d", c.a, c.b, got, c.lev) }
+        if got := Levenshtein(c.b, c.a); got != c.lev { t.Errorf("Levenshtein(%q, %q) = %d, esperado %d", c.b, c.a, got, c.lev) }
+        if got := JaroWinkler(c.a, c.b); math.Abs(got-c.jw) > 1e-3 { t.Errorf("JaroWinkler(%q, %q) = %.4f, esperado %.3f", c.a, c.b, got, c.jw) }
+    }
+}
+
+// A taxa fora da fold de uma linha não pode mudar quando só o rótulo dela
+// muda; a de uma linha de outra fold do mesmo estabelecimento, sim.
+func TestOutOfFoldIgnoresOwnLabel(t *testing.T) {
+    rng := rand.New(rand.NewSource(3))
+    es := make([]data.Expense, 300)
+    labels := make([]int, len(es))
+    for i := range es {
+        es[i] = data.Expense{ExpenseID: fmt.Sprint(i), Merchant: fmt.Sprintf("Loja %d", i%6)}
+        if rng.Float64() < 0.3 { labels[i] = 1 }
+    }
+    p := NewProfile()
+    p.Fit(es, labels)
+    before := p.OutOfFold(es, labels, 42)
+    for _, i := range []int{0, 7, 150, 299} {
+        flipped := append([]int(nil), labels...)
+        flipped[i] = 1 - flipped[i]
+        after := p.OutOfFold(es, flipped, 42)
+        if before[i][0] != after[i][0] { t.Errorf("linha %d: taxa fora da fold mudou com o próprio rótulo (%.4f -> %.4f)", i, before[i][0], after[i][0]) }
+        changed := false
+        for j := range es { if es[j].Merchant == es[i].Merchant && before[j][0] != after[j][0] { changed = true } }
+        if !changed { t.Errorf("linha %d: o rótulo não chegou a nenhuma outra fold", i) }
+    }
+}
@@ -9,6 +9,7 @@ type Bagging struct {
     MaxDepth    int
     MinSamples  int
     MaxThresholdsPerFe int
+    NClasses    int
     Trees       []*DecisionTree
 }
 
@@ -19,21 +20,46 @@ func NewBagging() *Bagging {
 func (bg *Bagging) Name() string { return "Bagging" }
 
 func (bg *Bagging) Fit(X [][]float64, y []int) error {
+    return bg.FitMulti(X, y, 2)
+}
+
+func (bg *Bagging) FitMulti(X [][]float64, y []int, nClasses int) error {
+    return bg.fit(Dense(X), y, nClasses, nil)
+}
+
+// FitWeighted treina com peso por amostra (binário); cada árvore recebe os
+// pesos das linhas sorteadas no bootstrap.
+func (bg *Bagging) FitWeighted(X [][]float64, y []int, w []float64) error {
+    return bg.FitDataset(Dense(X), y, 2, w)
+}
+
+func (bg *Bagging) FitDataset(X Dataset, y []int, nClasses int, w []float64) error {
+    if err := checkWeights(y, nClasses, w); err != nil { return err }
+    return bg.fit(X, y, nClasses, w)
+}
+
+func (bg *Bagging) fit(X Dataset, y []int, nClasses int, w []float64) error {
+    if err := checkClasses(y, nClasses); err != nil { return err }
+    bg.NClasses = nClasses
     if bg.NEstimators <= 0 { bg.NEstimators = 30 }
-    n := len(X)
+    n := X.Rows()
     bg.Trees = make([]*DecisionTree, 0, bg.NEstimators)
     for k := 0; k < bg.NEstimators; k++ {
         idx := make([]int, n)
         for i := 0; i < n; i++ { idx[i] = rand.Intn(n) }
-        Xb := make([][]float64, n)
         yb := make([]int, n)
-        for i := 0; i < n; i++ { Xb[i] = X[idx[i]]; yb[i] = y[idx[i]] }
+        var wb []float64
+        if w != nil { wb = make([]float64, n) }
+        for i := 0; i < n; i++ {
+            yb[i] = y[idx[i]]
+            if w != nil { wb[i] = w[idx[i]] }
+        }
         dt := NewDecisionTree()
         dt.MaxDepth = bg.MaxDepth
         dt.MinSamplesSplit = bg.MinSamples
         dt.MaxThresholdsPerFe = bg.MaxThresholdsPerFe
         dt.MaxFeatures = 0
-        if err := dt.Fit(Xb, yb); err != nil { return err }
+        if err := dt.fit(Subset(X, idx), yb, nClasses, wb); err != nil { return err }
         bg.Trees = append(bg.Trees, dt)
     }
     return nil
@@ -57,4 +83,10 @@ func (bg *Bagging) PredictProba(X [][]float64) []float64 {
     m := float64(len(bg.Trees))
     for i := 0; i < n; i++ { out[i] /= m }
     return out
-}
\ No newline at end of file
+}
+
+func (bg *Bagging) Classes() int { return bg.NClasses }
+
+func (bg *Bagging) PredictClassProba(X [][]float64) [][]float64 {
+    return averageClassProba(bg.Trees, X)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+    "errors"
+    "sort"
+)
+
+type Conformal struct {
+    Base   Model
+    Alpha  float64
+    Scores [2][]float64
+}
+
+func NewConformal(base Model, alpha float64) *Conformal {
+    return &Conformal{Base: base, Alpha: alpha}
+}
+
+func (cf *Conformal) Name() string {
+    if cf.Base == nil { return "Conformal" }
+    return "Conformal(" + cf.Base.Name() + ")"
+}
+
+func (cf *Conformal) Fit(X [][]float64, y []int) error {
+    if cf.Base == nil { return errors.New("conformal sem modelo base") }
+    return cf.Base.Fit(X, y)
+}
+
+func (cf *Conformal) Predict(X [][]float64) []int { return cf.Base.Predict(X) }
+
+func (cf *Conformal) PredictProba(X [][]float64) []float64 { return cf.Base.PredictProba(X) }
+
+// Calibrate guarda os escores de não conformidade (1 - p da classe verdadeira)
+// separados por classe, o que mantém a cobertura mesmo com classes desbalanceadas.
+func (cf *Conformal) Calibrate(X [][]float64, y []int) error {
+    if cf.Base == nil { return errors.New("conformal sem modelo base") }
+    if len(X) != len(y) { return errors.New("X e y com tamanhos diferentes") }
+    ps := cf.Base.PredictProba(X)
+    cf.Scores = [2][]float64{}
+    for i, p := range ps {
+        c := 0
+        if y[i] > 0 { c = 1 }
+        cf.Scores[c] = append(cf.Scores[c], nonconformity(p, c))
+    }
+    if len(cf.Scores[0]) == 0 || len(cf.Scores[1]) == 0 {
+        return errors.New("conjunto de calibração precisa conter as duas classes")
+    }
+    sort.Float64s(cf.Scores[0])
+    sort.Float64s(cf.Scores[1])
+    return nil
+}
+
+func (cf *Conformal) Calibrated() bool { return len(cf.Scores[0]) > 0 && len(cf.Scores[1]) > 0 }
+
+func (cf *Conformal) PValues(X [][]float64) [][2]float64 {
+    ps := cf.Base.PredictProba(X)
+    out := make([][2]float64, len(ps))
+    for i, p := range ps {
+        for c := 0; c < 2; c++ {
+            s := nonconformity(p, c)
+            cal := cf.Scores[c]
+            ge := len(cal) - sort.SearchFloat64s(cal, s)
+            out[i][c] = float64(ge+1) / float64(len(cal)+1)
+        }
+    }
+    return out
+}
+
+func (cf *Conformal) PredictSets(X [][]float64) [][]int {
+    pv := cf.PValues(X)
+    out := make([][]int, len(pv))
+    for i := range pv { out[i] = cf.PredictionSet(pv[i]) }
+    return out
+}
+
+func (cf *Conformal) PredictionSet(pv [2]float64) []int {
+    out := []int{}
+    for c := 0; c < 2; c++ { if pv[c] > cf.Alpha { out = append(out, c) } }
+    return out
+}
+
+func (cf *Conformal) Uncertain(pv [2]float64) bool { return len(cf.PredictionSet(pv)) != 1 }
+
+func nonconformity(p float64, c int) float64 {
+    if c == 1 { return 1 - p }
+    return p
+}
@@ -0,0 +1,94 @@
+package models
+
+// Dataset é a matriz de treino lida célula a célula. Dense adapta
+// [][]float64; a data.Matrix colunar em float32 implementa direto, o que
+// permite treinar sem materializar uma cópia em float64.
+type Dataset interface {
+    Rows() int
+    NumCols() int
+    At(i, j int) float64
+}
+
+// Dense adapta [][]float64 a Dataset.
+type Dense [][]float64
+
+func (d Dense) Rows() int { return len(d) }
+
+func (d Dense) NumCols() int {
+    if len(d) == 0 { return 0 }
+    return len(d[0])
+}
+
+func (d Dense) At(i, j int) float64 { return d[i][j] }
+
+type subset struct {
+    X   Dataset
+    idx []int
+}
+
+func (s subset) Rows() int { return len(s.idx) }
+func (s subset) NumCols() int { return s.X.NumCols() }
+func (s subset) At(i, j int) float64 { return s.X.At(s.idx[i], j) }
+
+// Subset é a visão das linhas idx de X, sem copiar os valores; linhas podem
+// se repetir (bootstrap). Visão de visão aponta direto para a base.
+func Subset(X Dataset, idx []int) Dataset {
+    if s, ok := X.(subset); ok {
+        base := make([]int, len(idx))
+        for k, i := range idx { base[k] = s.idx[i] }
+        return subset{X: s.X, idx: base}
+    }
+    return subset{X: X, idx: idx}
+}
+
+// Range é a visão das linhas [from, to) de X.
+func Range(X Dataset, from, to int) Dataset {
+    idx := make([]int, to-from)
+    for i := range idx { idx[i] = from + i }
+    return Subset(X, idx)
+}
+
+// ToDense materializa as linhas [from, to) de X em um só bloco.
+func ToDense(X Dataset, from, to int) [][]float64 {
+    if d, ok := X.(Dense); ok { return d[from:to] }
+    k := X.NumCols()
+    buf := make([]float64, (to-from)*k)
+    out := make([][]float64, to-from)
+    for r := range out {
+        row := buf[r*k : (r+1)*k : (r+1)*k]
+        for j := range row { row[j] = X.At(from+r, j) }
+        out[r] = row
+    }
+    return out
+}
+
+// PredictBlock é o tamanho dos blocos materializados ao prever um Dataset.
+const PredictBlock = 4096
+
+// PredictDataset é Model.Predict sobre X, em blocos de PredictBlock linhas.
+func PredictDataset(m Model, X Dataset) []int {
+    out := make([]int, 0, X.Rows())
+    for from := 0; from < X.Rows(); from += PredictBlock {
+        out = append(out, m.Predict(ToDense(X, from, min(from+PredictBlock, X.Rows())))...)
+    }
+    return out
+}
+
+// PredictProbaDataset prevê X em blocos de PredictBlock linhas, sem copiar o
+// Dataset inteiro para float64.
+func PredictProbaDataset(m Model, X Dataset) []float64 {
+    out := make([]float64, 0, X.Rows())
+    for from := 0; from < X.Rows(); from += PredictBlock {
+        out = append(out, m.PredictProba(ToDense(X, from, min(from+PredictBlock, X.Rows())))...)
+    }
+    return out
+}
+
+// PredictClassProbaDataset é PredictProbaDataset para as probabilidades por classe.
+func PredictClassProbaDataset(m MultiClassModel, X Dataset) [][]float64 {
+    out := make([][]float64, 0, X.Rows())
+    for from := 0; from < X.Rows(); from += PredictBlock {
+        out = append(out, m.PredictClassProba(ToDense(X, from, min(from+PredictBlock, X.Rows())))...)
+    }
+    return out
+}
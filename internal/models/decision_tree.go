@@ -1,17 +1,20 @@
 package models
 
 import (
+    "errors"
+    "fmt"
     "math"
     "math/rand"
 )
 
 type DTNode struct {
-    Feature   int
-    Threshold float64
-    Left      *DTNode
-    Right     *DTNode
-    IsLeaf    bool
-    ProbaLeaf float64
+    Feature    int
+    Threshold  float64
+    Left       *DTNode
+    Right      *DTNode
+    IsLeaf     bool
+    ProbaLeaf  float64
+    ClassProba []float64
 }
 
 type DecisionTree struct {
@@ -19,7 +22,9 @@ type DecisionTree struct {
     MinSamplesSplit    int
     MaxThresholdsPerFe int
     MaxFeatures        int
+    NClasses           int
     Root               *DTNode
+    w                  []float64
 }
 
 func NewDecisionTree() *DecisionTree {
@@ -29,12 +34,56 @@ func NewDecisionTree() *DecisionTree {
 func (dt *DecisionTree) Name() string { return "DecisionTree" }
 
 func (dt *DecisionTree) Fit(X [][]float64, y []int) error {
-    idx := make([]int, len(X))
+    return dt.FitMulti(X, y, 2)
+}
+
+func (dt *DecisionTree) FitMulti(X [][]float64, y []int, nClasses int) error {
+    return dt.fit(Dense(X), y, nClasses, nil)
+}
+
+// FitWeighted treina com peso por amostra (binário); w nil = pesos 1.
+func (dt *DecisionTree) FitWeighted(X [][]float64, y []int, w []float64) error {
+    return dt.FitDataset(Dense(X), y, 2, w)
+}
+
+func (dt *DecisionTree) FitDataset(X Dataset, y []int, nClasses int, w []float64) error {
+    if err := checkWeights(y, nClasses, w); err != nil { return err }
+    return dt.fit(X, y, nClasses, w)
+}
+
+func (dt *DecisionTree) fit(X Dataset, y []int, nClasses int, w []float64) error {
+    if err := checkClasses(y, nClasses); err != nil { return err }
+    if X.Rows() != len(y) { return errors.New("X e y com tamanhos diferentes") }
+    dt.NClasses = nClasses
+    idx := make([]int, X.Rows())
     for i := range idx { idx[i] = i }
+    dt.w = w
     dt.Root = dt.build(X, y, idx, 0)
+    dt.w = nil
     return nil
 }
 
+func (dt *DecisionTree) Classes() int { return dt.NClasses }
+
+func (dt *DecisionTree) PredictClassProba(X [][]float64) [][]float64 {
+    out := make([][]float64, len(X))
+    for i := range X { out[i] = dt.classProbaOne(X[i]) }
+    return out
+}
+
+func (dt *DecisionTree) classProbaOne(x []float64) []float64 {
+    n := dt.Root
+    for n != nil && !n.IsLeaf {
+        if x[n.Feature] <= n.Threshold { n = n.Left } else { n = n.Right }
+    }
+    if n == nil || len(n.ClassProba) == 0 {
+        p := 0.5
+        if n != nil { p = n.ProbaLeaf }
+        return []float64{1 - p, p}
+    }
+    return n.ClassProba
+}
+
 func (dt *DecisionTree) Predict(X [][]float64) []int {
     out := make([]int, len(X))
     for i := range X {
@@ -60,15 +109,18 @@ func (dt *DecisionTree) predictProbaOne(x []float64) float64 {
     return n.ProbaLeaf
 }
 
-func (dt *DecisionTree) build(X [][]float64, y []int, idx []int, depth int) *DTNode {
+func (dt *DecisionTree) build(X Dataset, y []int, idx []int, depth int) *DTNode {
     node := &DTNode{}
+    multi := dt.NClasses > 2
     if len(idx) < dt.MinSamplesSplit || depth >= dt.MaxDepth {
-        node.IsLeaf = true
-        node.ProbaLeaf = classProba(y, idx)
-        return node
+        return dt.leaf(node, y, idx)
     }
-    p := classProba(y, idx)
-    if p == 0 || p == 1 {
+    p := classProba(y, idx, dt.w)
+    if multi {
+        pure := true
+        for _, i := range idx { if y[i] != y[idx[0]] { pure = false; break } }
+        if pure { return dt.leaf(node, y, idx) }
+    } else if p == 0 || p == 1 {
         node.IsLeaf = true
         node.ProbaLeaf = p
         return node
@@ -79,14 +131,15 @@ func (dt *DecisionTree) build(X [][]float64, y []int, idx []int, depth int) *DTN
     leftIdxBest := []int{}
     rightIdxBest := []int{}
 
-    nFeats := len(X[0])
+    nFeats := X.NumCols()
     feats := pickFeatures(nFeats, dt.MaxFeatures)
     for _, f := range feats {
         cand := candidateThresholds(X, idx, f, dt.MaxThresholdsPerFe)
         for _, thr := range cand {
             lIdx, rIdx := splitIdx(X, idx, f, thr)
             if len(lIdx) == 0 || len(rIdx) == 0 { continue }
-            imp := giniImpurity(y, lIdx, rIdx)
+            var imp float64
+            if multi { imp = giniImpurityMulti(y, lIdx, rIdx, dt.NClasses, dt.w) } else { imp = giniImpurity(y, lIdx, rIdx, dt.w) }
             if imp < bestImp {
                 bestImp = imp
                 bestFeature = f
@@ -98,9 +151,7 @@ func (dt *DecisionTree) build(X [][]float64, y []int, idx []int, depth int) *DTN
     }
 
     if bestFeature == -1 {
-        node.IsLeaf = true
-        node.ProbaLeaf = p
-        return node
+        return dt.leaf(node, y, idx)
     }
     node.Feature = bestFeature
     node.Threshold = bestThr
@@ -109,40 +160,103 @@ func (dt *DecisionTree) build(X [][]float64, y []int, idx []int, depth int) *DTN
     return node
 }
 
-func classProba(y []int, idx []int) float64 {
-    sum := 0
-    for _, i := range idx { sum += y[i] }
-    return float64(sum)/float64(len(idx))
+func (dt *DecisionTree) leaf(node *DTNode, y []int, idx []int) *DTNode {
+    node.IsLeaf = true
+    if dt.NClasses <= 2 {
+        node.ProbaLeaf = classProba(y, idx, dt.w)
+        return node
+    }
+    node.ClassProba = classDistribution(y, idx, dt.NClasses, dt.w)
+    node.ProbaLeaf = 1 - node.ClassProba[0]
+    return node
+}
+
+// weight é o peso da amostra i (1 sem pesos).
+func weight(w []float64, i int) float64 {
+    if w == nil { return 1 }
+    return w[i]
+}
+
+func classProba(y []int, idx []int, w []float64) float64 {
+    sum, tot := 0.0, 0.0
+    for _, i := range idx {
+        tot += weight(w, i)
+        if y[i] > 0 { sum += weight(w, i) }
+    }
+    if tot == 0 { return 0 }
+    return sum/tot
+}
+
+func classDistribution(y []int, idx []int, k int, w []float64) []float64 {
+    out := make([]float64, k)
+    if len(idx) == 0 { return out }
+    tot := 0.0
+    for _, i := range idx { out[y[i]] += weight(w, i); tot += weight(w, i) }
+    if tot == 0 { return out }
+    for c := range out { out[c] /= tot }
+    return out
+}
+
+// checkWeights valida os pesos: um por amostra e só no binário.
+func checkWeights(y []int, k int, w []float64) error {
+    if w == nil { return nil }
+    if len(w) != len(y) { return errors.New("pesos com tamanho diferente de y") }
+    if k > 2 { return errors.New("pesos por amostra só no treino binário") }
+    return nil
+}
+
+func checkClasses(y []int, k int) error {
+    if k < 2 { return fmt.Errorf("número de classes inválido: %d", k) }
+    for _, c := range y {
+        if c < 0 || c >= k { return fmt.Errorf("rótulo %d fora do intervalo [0, %d)", c, k) }
+    }
+    return nil
 }
 
-func splitIdx(X [][]float64, idx []int, f int, thr float64) ([]int, []int) {
+func splitIdx(X Dataset, idx []int, f int, thr float64) ([]int, []int) {
     l := make([]int, 0, len(idx))
     r := make([]int, 0, len(idx))
     for _, i := range idx {
-        if X[i][f] <= thr { l = append(l, i) } else { r = append(r, i) }
+        if X.At(i, f) <= thr { l = append(l, i) } else { r = append(r, i) }
     }
     return l, r
 }
 
-func giniImpurity(y []int, lIdx, rIdx []int) float64 {
-    g := func(ids []int) float64 {
-        if len(ids) == 0 { return 0 }
-        p := 0.0
-        for _, i := range ids { p += float64(y[i]) }
-        p = p/float64(len(ids))
-        return p*(1-p)
+func giniImpurity(y []int, lIdx, rIdx []int, w []float64) float64 {
+    g := func(ids []int) (float64, float64) {
+        p, tot := 0.0, 0.0
+        for _, i := range ids { p += weight(w, i)*float64(y[i]); tot += weight(w, i) }
+        if tot == 0 { return 0, 0 }
+        p = p/tot
+        return p*(1-p), tot
     }
-    gl := g(lIdx)
-    gr := g(rIdx)
-    wl := float64(len(lIdx))
-    wr := float64(len(rIdx))
+    gl, wl := g(lIdx)
+    gr, wr := g(rIdx)
     n := wl+wr
+    if n == 0 { return 0 }
     return (wl/n)*gl + (wr/n)*gr
 }
 
-func candidateThresholds(X [][]float64, idx []int, f int, maxC int) []float64 {
+func giniImpurityMulti(y []int, lIdx, rIdx []int, k int, w []float64) float64 {
+    g := func(ids []int) (float64, float64) {
+        counts := make([]float64, k)
+        tot := 0.0
+        for _, i := range ids { counts[y[i]] += weight(w, i); tot += weight(w, i) }
+        if tot == 0 { return 0, 0 }
+        s := 1.0
+        for _, c := range counts { p := c/tot; s -= p*p }
+        return s, tot
+    }
+    gl, wl := g(lIdx)
+    gr, wr := g(rIdx)
+    n := wl+wr
+    if n == 0 { return 0 }
+    return (wl/n)*gl + (wr/n)*gr
+}
+
+func candidateThresholds(X Dataset, idx []int, f int, maxC int) []float64 {
     values := make([]float64, len(idx))
-    for j, i := range idx { values[j] = X[i][f] }
+    for j, i := range idx { values[j] = X.At(i, f) }
     for i := range values {
         j := rand.Intn(len(values))
         values[i], values[j] = values[j], values[i]
@@ -168,4 +282,4 @@ func pickFeatures(nFeats int, maxFeats int) []int {
     out := make([]int, maxFeats)
     copy(out, idx[:maxFeats])
     return out
-}
\ No newline at end of file
+}
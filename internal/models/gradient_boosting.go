@@ -1,6 +1,7 @@
 package models
 
 import (
+    "errors"
     "math"
     "sort"
 )
@@ -18,7 +19,10 @@ type GradientBoosting struct {
     MaxDepth     int
     MinSamples   int
     MaxThresholdsPerFe int
+    NClasses     int
     Trees        []gbTree
+    ClassTrees   [][]gbTree
+    ClassInit    []float64
 }
 
 func NewGradientBoosting() *GradientBoosting {
@@ -30,11 +34,32 @@ func (gb *GradientBoosting) Name() string { return "GradientBoosting" }
 func sigmoid(z float64) float64 { return 1.0 / (1.0 + math.Exp(-z)) }
 
 func (gb *GradientBoosting) Fit(X [][]float64, y []int) error {
-    n := len(X)
+    return gb.FitWeighted(X, y, nil)
+}
+
+// FitWeighted treina o binário com peso por amostra: o log-odds inicial, as
+// médias das folhas e o SSE dos stumps passam a ser ponderados.
+func (gb *GradientBoosting) FitWeighted(X [][]float64, y []int, w []float64) error {
+    return gb.FitDataset(Dense(X), y, 2, w)
+}
+
+func (gb *GradientBoosting) FitDataset(X Dataset, y []int, nClasses int, w []float64) error {
+    if err := checkWeights(y, nClasses, w); err != nil { return err }
+    if nClasses > 2 { return gb.fitMulti(X, y, nClasses) }
+    gb.NClasses, gb.ClassTrees = 2, nil
+    return gb.fit(X, y, w)
+}
+
+func (gb *GradientBoosting) fit(X Dataset, y []int, w []float64) error {
+    n := X.Rows()
     if n == 0 { return nil }
-    pos := 0
-    for i := 0; i < n; i++ { if y[i] == 1 { pos++ } }
-    base := float64(pos) / float64(n)
+    pos, tot := 0.0, 0.0
+    for i := 0; i < n; i++ {
+        tot += weight(w, i)
+        if y[i] == 1 { pos += weight(w, i) }
+    }
+    if tot == 0 { return errors.New("soma dos pesos é zero") }
+    base := pos / tot
     if base <= 1e-3 { base = 1e-3 }
     if base >= 1-1e-3 { base = 1 - 1e-3 }
     init := math.Log(base / (1.0 - base))
@@ -48,54 +73,143 @@ func (gb *GradientBoosting) Fit(X [][]float64, y []int) error {
             r[i] = float64(y[i]) - p
         }
 
-        best := gbTree{Feature: -1}
-        bestSSE := math.MaxFloat64
-        nFeats := len(X[0])
-        for j := 0; j < nFeats; j++ {
-            cands := gbCandidateThresholds(X, j, gb.MaxThresholdsPerFe)
-            for _, thr := range cands {
-                leftSum, leftCount := 0.0, 0.0
-                rightSum, rightCount := 0.0, 0.0
-                for i := 0; i < n; i++ {
-                    if X[i][j] <= thr { leftSum += r[i]; leftCount++ } else { rightSum += r[i]; rightCount++ }
-                }
-                if int(leftCount) < gb.MinSamples || int(rightCount) < gb.MinSamples { continue }
-                if leftCount == 0 || rightCount == 0 { continue }
-                leftAvg := leftSum / leftCount
-                rightAvg := rightSum / rightCount
-
-                leftSS, rightSS := 0.0, 0.0
-                for i := 0; i < n; i++ {
-                    if X[i][j] <= thr {
-                        d := r[i] - leftAvg
-                        leftSS += d * d
-                    } else {
-                        d := r[i] - rightAvg
-                        rightSS += d * d
-                    }
-                }
-                sse := leftSS + rightSS
-                if sse < bestSSE {
-                    bestSSE = sse
-                    best.Feature = j
-                    best.Threshold = thr
-                    best.LeftVal = leftAvg
-                    best.RightVal = rightAvg
-                }
-            }
-        }
+        best := gb.bestStump(X, r, w)
         if best.Feature == -1 { break }
         gb.Trees = append(gb.Trees, best)
         for i := 0; i < n; i++ {
             inc := best.LeftVal
-            if X[i][best.Feature] > best.Threshold { inc = best.RightVal }
+            if X.At(i, best.Feature) > best.Threshold { inc = best.RightVal }
             F[i] += gb.LearningRate * inc
         }
     }
     return nil
 }
 
+func (gb *GradientBoosting) bestStump(X Dataset, r []float64, w []float64) gbTree {
+    n := X.Rows()
+    best := gbTree{Feature: -1}
+    bestSSE := math.MaxFloat64
+    nFeats := X.NumCols()
+    for j := 0; j < nFeats; j++ {
+        cands := gbCandidateThresholds(X, j, gb.MaxThresholdsPerFe)
+        for _, thr := range cands {
+            leftSum, leftW, leftCount := 0.0, 0.0, 0
+            rightSum, rightW, rightCount := 0.0, 0.0, 0
+            for i := 0; i < n; i++ {
+                wi := weight(w, i)
+                if X.At(i, j) <= thr { leftSum += wi * r[i]; leftW += wi; leftCount++ } else { rightSum += wi * r[i]; rightW += wi; rightCount++ }
+            }
+            if leftCount < gb.MinSamples || rightCount < gb.MinSamples { continue }
+            if leftW == 0 || rightW == 0 { continue }
+            leftAvg := leftSum / leftW
+            rightAvg := rightSum / rightW
+
+            leftSS, rightSS := 0.0, 0.0
+            for i := 0; i < n; i++ {
+                if X.At(i, j) <= thr {
+                    d := r[i] - leftAvg
+                    leftSS += weight(w, i) * d * d
+                } else {
+                    d := r[i] - rightAvg
+                    rightSS += weight(w, i) * d * d
+                }
+            }
+            sse := leftSS + rightSS
+            if sse < bestSSE {
+                bestSSE = sse
+                best.Feature = j
+                best.Threshold = thr
+                best.LeftVal = leftAvg
+                best.RightVal = rightAvg
+            }
+        }
+    }
+    return best
+}
+
+func (gb *GradientBoosting) FitMulti(X [][]float64, y []int, nClasses int) error {
+    return gb.FitDataset(Dense(X), y, nClasses, nil)
+}
+
+func (gb *GradientBoosting) fitMulti(X Dataset, y []int, nClasses int) error {
+    if err := checkClasses(y, nClasses); err != nil { return err }
+    n := X.Rows()
+    if n == 0 { return nil }
+    gb.NClasses = nClasses
+    gb.Trees = nil
+    gb.ClassTrees = make([][]gbTree, nClasses)
+    gb.ClassInit = make([]float64, nClasses)
+    counts := make([]float64, nClasses)
+    for i := 0; i < n; i++ { counts[y[i]]++ }
+    for k := range counts { gb.ClassInit[k] = math.Log((counts[k] + 1) / (float64(n) + float64(nClasses))) }
+    F := make([][]float64, n)
+    for i := range F { F[i] = append([]float64(nil), gb.ClassInit...) }
+    r := make([]float64, n)
+    for m := 0; m < gb.NEstimators; m++ {
+        P := make([][]float64, n)
+        for i := range F { P[i] = softmax(F[i]) }
+        progress := false
+        for k := 0; k < nClasses; k++ {
+            for i := 0; i < n; i++ {
+                t := 0.0
+                if y[i] == k { t = 1 }
+                r[i] = t - P[i][k]
+            }
+            best := gb.bestStump(X, r, nil)
+            if best.Feature == -1 { continue }
+            progress = true
+            gb.ClassTrees[k] = append(gb.ClassTrees[k], best)
+            for i := 0; i < n; i++ {
+                inc := best.LeftVal
+                if X.At(i, best.Feature) > best.Threshold { inc = best.RightVal }
+                F[i][k] += gb.LearningRate * inc
+            }
+        }
+        if !progress { break }
+    }
+    return nil
+}
+
+func (gb *GradientBoosting) Classes() int { return gb.NClasses }
+
+func (gb *GradientBoosting) PredictClassProba(X [][]float64) [][]float64 {
+    out := make([][]float64, len(X))
+    if gb.NClasses <= 2 {
+        ps := gb.PredictProba(X)
+        for i := range ps { out[i] = []float64{1 - ps[i], ps[i]} }
+        return out
+    }
+    for i := range X {
+        f := append([]float64(nil), gb.ClassInit...)
+        for k, trees := range gb.ClassTrees {
+            for _, t := range trees {
+                inc := t.LeftVal
+                if X[i][t.Feature] > t.Threshold { inc = t.RightVal }
+                f[k] += gb.LearningRate * inc
+            }
+        }
+        out[i] = softmax(f)
+    }
+    return out
+}
+
+func softmax(f []float64) []float64 {
+    mx := math.Inf(-1)
+    for _, v := range f { if v > mx { mx = v } }
+    out := make([]float64, len(f))
+    sum := 0.0
+    for k, v := range f { out[k] = math.Exp(v - mx); sum += out[k] }
+    for k := range out { out[k] /= sum }
+    return out
+}
+
 func (gb *GradientBoosting) PredictProba(X [][]float64) []float64 {
+    if gb.NClasses > 2 {
+        cp := gb.PredictClassProba(X)
+        out := make([]float64, len(X))
+        for i := range cp { out[i] = 1 - cp[i][0] }
+        return out
+    }
     out := make([]float64, len(X))
     for i := range X {
         f := 0.0
@@ -118,11 +232,11 @@ func (gb *GradientBoosting) Predict(X [][]float64) []int {
     return out
 }
 
-func gbCandidateThresholds(X [][]float64, j int, nCand int) []float64 {
+func gbCandidateThresholds(X Dataset, j int, nCand int) []float64 {
     if nCand <= 0 { nCand = 16 }
-    n := len(X)
+    n := X.Rows()
     vals := make([]float64, n)
-    for i := 0; i < n; i++ { vals[i] = X[i][j] }
+    for i := 0; i < n; i++ { vals[i] = X.At(i, j) }
     sort.Float64s(vals)
     out := make([]float64, 0, nCand)
     for k := 1; k < nCand; k++ {
@@ -0,0 +1,280 @@
+package models
+
+import (
+    "bytes"
+    "encoding/gob"
+    "errors"
+    "io"
+    "math"
+    "sync"
+)
+
+type IncrementalModel interface {
+    Model
+    PartialFit(X [][]float64, y []int) error
+}
+
+type HTGaussian struct {
+    N    float64
+    Mean float64
+    M2   float64
+    Min  float64
+    Max  float64
+}
+
+func (g *HTGaussian) Add(x float64) {
+    if g.N == 0 || x < g.Min { g.Min = x }
+    if g.N == 0 || x > g.Max { g.Max = x }
+    g.N++
+    d := x - g.Mean
+    g.Mean += d / g.N
+    g.M2 += d * (x - g.Mean)
+}
+
+func (g *HTGaussian) cdf(x float64) float64 {
+    if g.N == 0 { return 0 }
+    if x < g.Min { return 0 }
+    if x >= g.Max { return 1 }
+    sd := 0.0
+    if g.N > 1 { sd = math.Sqrt(g.M2 / (g.N - 1)) }
+    if sd < 1e-9 { if x >= g.Mean { return 1 } ; return 0 }
+    return 0.5 * (1 + math.Erf((x-g.Mean)/(sd*math.Sqrt2)))
+}
+
+type HTDrift struct {
+    N      float64
+    Errors float64
+    PMin   float64
+    SMin   float64
+}
+
+func (d *HTDrift) Add(miss bool) bool {
+    d.N++
+    if miss { d.Errors++ }
+    if d.N < 30 { return false }
+    p := d.Errors / d.N
+    s := math.Sqrt(p * (1 - p) / d.N)
+    if d.PMin == 0 && d.SMin == 0 || p+s < d.PMin+d.SMin {
+        d.PMin, d.SMin = p, s
+    }
+    if p+s > d.PMin+3*d.SMin {
+        *d = HTDrift{}
+        return true
+    }
+    return false
+}
+
+type HTNode struct {
+    Feature    int
+    Threshold  float64
+    Left       *HTNode
+    Right      *HTNode
+    IsLeaf     bool
+    Counts     [2]float64
+    Stats      [][2]HTGaussian
+    LastEval   float64
+    Drift      HTDrift
+    Alt        *HTNode
+    AltSeen    float64
+    AltErrors  float64
+    MainErrors float64
+}
+
+type HoeffdingTree struct {
+    GracePeriod   int
+    Delta         float64
+    TieThreshold  float64
+    MaxDepth      int
+    NumThresholds int
+    Adaptive      bool
+    AltMinSamples int
+    Root          *HTNode
+    Seen          int
+    mu            sync.RWMutex
+}
+
+func NewHoeffdingTree() *HoeffdingTree {
+    return &HoeffdingTree{GracePeriod: 200, Delta: 1e-7, TieThreshold: 0.05, MaxDepth: 12, NumThresholds: 16, AltMinSamples: 300}
+}
+
+func NewAdaptiveHoeffdingTree() *HoeffdingTree {
+    ht := NewHoeffdingTree()
+    ht.Adaptive = true
+    return ht
+}
+
+func (ht *HoeffdingTree) Name() string {
+    if ht.Adaptive { return "AdaptiveHoeffdingTree" }
+    return "HoeffdingTree"
+}
+
+func (ht *HoeffdingTree) Fit(X [][]float64, y []int) error {
+    ht.mu.Lock()
+    ht.Root = nil
+    ht.Seen = 0
+    ht.mu.Unlock()
+    return ht.PartialFit(X, y)
+}
+
+func (ht *HoeffdingTree) PartialFit(X [][]float64, y []int) error {
+    if len(X) != len(y) { return errors.New("X e y com tamanhos diferentes") }
+    ht.mu.Lock()
+    defer ht.mu.Unlock()
+    for i := range X {
+        if y[i] != 0 && y[i] != 1 { return errors.New("rótulo deve ser 0 ou 1") }
+        if ht.Root == nil { ht.Root = newHTLeaf(len(X[i])) }
+        ht.Root = ht.learn(ht.Root, X[i], y[i], 0)
+        ht.Seen++
+    }
+    return nil
+}
+
+func (ht *HoeffdingTree) Predict(X [][]float64) []int {
+    ps := ht.PredictProba(X)
+    out := make([]int, len(ps))
+    for i := range ps { if ps[i] >= 0.5 { out[i] = 1 } }
+    return out
+}
+
+func (ht *HoeffdingTree) PredictProba(X [][]float64) []float64 {
+    ht.mu.RLock()
+    defer ht.mu.RUnlock()
+    out := make([]float64, len(X))
+    for i := range X { out[i] = htLeaf(ht.Root, X[i]).proba() }
+    return out
+}
+
+func (ht *HoeffdingTree) Encode(w io.Writer) error {
+    ht.mu.RLock()
+    defer ht.mu.RUnlock()
+    var buf bytes.Buffer
+    if err := gob.NewEncoder(&buf).Encode(ht); err != nil { return err }
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+func newHTLeaf(nFeats int) *HTNode {
+    return &HTNode{IsLeaf: true, Stats: make([][2]HTGaussian, nFeats)}
+}
+
+func htLeaf(n *HTNode, x []float64) *HTNode {
+    for n != nil && !n.IsLeaf {
+        if x[n.Feature] <= n.Threshold { n = n.Left } else { n = n.Right }
+    }
+    return n
+}
+
+func (n *HTNode) proba() float64 {
+    if n == nil { return 0.5 }
+    t := n.Counts[0] + n.Counts[1]
+    if t == 0 { return 0.5 }
+    return n.Counts[1] / t
+}
+
+func (ht *HoeffdingTree) learn(n *HTNode, x []float64, y int, depth int) *HTNode {
+    if ht.Adaptive {
+        miss := htPredictLabel(n, x) != y
+        if n.Alt != nil {
+            n.AltSeen++
+            if miss { n.MainErrors++ }
+            if htPredictLabel(n.Alt, x) != y { n.AltErrors++ }
+            n.Alt = ht.learn(n.Alt, x, y, depth)
+            if n.AltSeen >= float64(ht.AltMinSamples) {
+                if n.AltErrors < n.MainErrors { return n.Alt }
+                if n.AltSeen >= float64(10*ht.AltMinSamples) { n.Alt = nil }
+            }
+        }
+        if n.Drift.Add(miss) && !n.IsLeaf && n.Alt == nil {
+            n.Alt = newHTLeaf(len(x))
+            n.AltSeen, n.AltErrors, n.MainErrors = 0, 0, 0
+        }
+    }
+    n.Counts[y]++
+    if !n.IsLeaf {
+        if x[n.Feature] <= n.Threshold {
+            n.Left = ht.learn(n.Left, x, y, depth+1)
+        } else {
+            n.Right = ht.learn(n.Right, x, y, depth+1)
+        }
+        return n
+    }
+    for f := range n.Stats { n.Stats[f][y].Add(x[f]) }
+    seen := n.Counts[0] + n.Counts[1]
+    if seen-n.LastEval < float64(ht.GracePeriod) || depth >= ht.MaxDepth { return n }
+    n.LastEval = seen
+    if n.Counts[0] == 0 || n.Counts[1] == 0 { return n }
+    ht.trySplit(n, seen)
+    return n
+}
+
+func htPredictLabel(n *HTNode, x []float64) int {
+    if htLeaf(n, x).proba() >= 0.5 { return 1 }
+    return 0
+}
+
+func (ht *HoeffdingTree) trySplit(n *HTNode, seen float64) {
+    parent := htEntropy(n.Counts[0], n.Counts[1])
+    best, second := -1.0, 0.0
+    bestF, bestThr := -1, 0.0
+    var bestL, bestR [2]float64
+    for f := range n.Stats {
+        gain, thr, l, r, ok := ht.bestThreshold(n.Stats[f], parent)
+        if !ok { continue }
+        if gain > best {
+            second = math.Max(best, 0)
+            best, bestF, bestThr, bestL, bestR = gain, f, thr, l, r
+        } else if gain > second {
+            second = gain
+        }
+    }
+    if bestF < 0 || best <= 0 { return }
+    eps := math.Sqrt(math.Log(1/ht.Delta) / (2 * seen))
+    if best-second <= eps && eps >= ht.TieThreshold { return }
+    nFeats := len(n.Stats)
+    n.IsLeaf = false
+    n.Feature = bestF
+    n.Threshold = bestThr
+    n.Stats = nil
+    n.Left = newHTLeaf(nFeats)
+    n.Left.Counts = bestL
+    n.Right = newHTLeaf(nFeats)
+    n.Right.Counts = bestR
+}
+
+func (ht *HoeffdingTree) bestThreshold(st [2]HTGaussian, parent float64) (float64, float64, [2]float64, [2]float64, bool) {
+    lo := math.Min(st[0].Min, st[1].Min)
+    hi := math.Max(st[0].Max, st[1].Max)
+    if st[0].N == 0 { lo, hi = st[1].Min, st[1].Max }
+    if st[1].N == 0 { lo, hi = st[0].Min, st[0].Max }
+    if hi <= lo { return 0, 0, [2]float64{}, [2]float64{}, false }
+    k := ht.NumThresholds
+    if k <= 0 { k = 16 }
+    bestGain := -1.0
+    bestThr := 0.0
+    var bestL, bestR [2]float64
+    total := st[0].N + st[1].N
+    for i := 1; i < k; i++ {
+        thr := lo + (hi-lo)*float64(i)/float64(k)
+        var l, r [2]float64
+        for c := 0; c < 2; c++ {
+            l[c] = st[c].N * st[c].cdf(thr)
+            r[c] = st[c].N - l[c]
+        }
+        nl := l[0] + l[1]
+        nr := r[0] + r[1]
+        if nl < 1 || nr < 1 { continue }
+        gain := parent - (nl/total)*htEntropy(l[0], l[1]) - (nr/total)*htEntropy(r[0], r[1])
+        if gain > bestGain { bestGain, bestThr, bestL, bestR = gain, thr, l, r }
+    }
+    return bestGain, bestThr, bestL, bestR, bestGain >= 0
+}
+
+func htEntropy(a, b float64) float64 {
+    t := a + b
+    if t == 0 { return 0 }
+    h := 0.0
+    for _, c := range []float64{a, b} {
+        if c > 0 { p := c / t; h -= p * math.Log2(p) }
+    }
+    return h
+}
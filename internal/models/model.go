@@ -5,4 +5,18 @@ type Model interface {
     Predict(X [][]float64) []int
     PredictProba(X [][]float64) []float64
     Name() string
-}
\ No newline at end of file
+}
+
+type MultiClassModel interface {
+    Model
+    FitMulti(X [][]float64, y []int, nClasses int) error
+    PredictClassProba(X [][]float64) [][]float64
+    Classes() int
+}
+
+// DatasetModel treina direto de um Dataset, com peso por amostra opcional
+// (w nil = pesos 1; pesos só no binário).
+type DatasetModel interface {
+    Model
+    FitDataset(X Dataset, y []int, nClasses int, w []float64) error
+}
@@ -0,0 +1,278 @@
+package models
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "strings"
+
+    "google.golang.org/protobuf/encoding/protowire"
+)
+
+type ONNXTreeEnsemble struct {
+    FeatureNames []string
+    ens          treeEnsemble
+    roots        map[int64]int
+    index        map[[2]int64]int
+    weights      map[[2]int64][]classWeight
+}
+
+type classWeight struct {
+    class  int64
+    weight float32
+}
+
+func LoadONNX(path string) (*ONNXTreeEnsemble, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    m := &ONNXTreeEnsemble{}
+    var graph []byte
+    err = walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+        switch num {
+        case 7:
+            graph = v
+        case 14:
+            k, val := decodeStringEntry(v)
+            if k == "feature_names" && val != "" { m.FeatureNames = strings.Split(val, ",") }
+        }
+        return nil
+    })
+    if err != nil { return nil, err }
+    if graph == nil { return nil, errors.New("ONNX sem grafo") }
+    found := false
+    err = walkFields(graph, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+        if num != 1 || found { return nil }
+        ok, err := m.decodeNode(v)
+        found = ok
+        return err
+    })
+    if err != nil { return nil, err }
+    if !found { return nil, errors.New("nó TreeEnsembleClassifier não encontrado") }
+    m.buildIndex()
+    return m, nil
+}
+
+func (m *ONNXTreeEnsemble) Name() string { return "ONNX(TreeEnsembleClassifier)" }
+
+func (m *ONNXTreeEnsemble) Fit(X [][]float64, y []int) error {
+    return errors.New("modelo ONNX é somente leitura")
+}
+
+func (m *ONNXTreeEnsemble) Predict(X [][]float64) []int {
+    ps := m.PredictProba(X)
+    out := make([]int, len(ps))
+    for i := range ps { if ps[i] >= 0.5 { out[i] = 1 } }
+    return out
+}
+
+// scores soma os pesos das folhas por classe (antes do post_transform).
+func (m *ONNXTreeEnsemble) scores(x []float64) []float32 {
+    s := make([]float32, m.Classes())
+    for tid, root := range m.roots {
+        leaf := m.leaf(tid, root, x)
+        for _, w := range m.weights[[2]int64{tid, leaf}] {
+            if w.class >= 0 && int(w.class) < len(s) { s[w.class] += w.weight }
+        }
+    }
+    return s
+}
+
+// PredictProba é P(fraude): a classe 1 no binário e 1 - P(classe 0) no
+// multiclasse, como nos modelos em Go.
+func (m *ONNXTreeEnsemble) PredictProba(X [][]float64) []float64 {
+    out := make([]float64, len(X))
+    for i := range X {
+        s := m.scores(X[i])
+        p := float64(s[1])
+        if len(s) > 2 { p = 1 - float64(s[0]) }
+        if m.ens.PostTransform == "LOGISTIC" { p = float64(float32(sigmoid(p))) }
+        out[i] = p
+    }
+    return out
+}
+
+func (m *ONNXTreeEnsemble) Classes() int { return max(2, m.ens.NClasses) }
+
+func (m *ONNXTreeEnsemble) PredictClassProba(X [][]float64) [][]float64 {
+    out := make([][]float64, len(X))
+    if m.Classes() == 2 {
+        for i, p := range m.PredictProba(X) { out[i] = []float64{1 - p, p} }
+        return out
+    }
+    for i := range X {
+        s := m.scores(X[i])
+        out[i] = make([]float64, len(s))
+        for k, v := range s { out[i][k] = float64(v) }
+    }
+    return out
+}
+
+func (m *ONNXTreeEnsemble) leaf(tid int64, pos int, x []float64) int64 {
+    e := &m.ens
+    for e.Modes[pos] != "LEAF" {
+        v := float32(x[e.FeatureIDs[pos]])
+        thr := e.Values[pos]
+        var next int64
+        switch e.Modes[pos] {
+        case "BRANCH_LEQ": next = pick(v <= thr, e.TrueIDs[pos], e.FalseIDs[pos])
+        case "BRANCH_LT": next = pick(v < thr, e.TrueIDs[pos], e.FalseIDs[pos])
+        case "BRANCH_GTE": next = pick(v >= thr, e.TrueIDs[pos], e.FalseIDs[pos])
+        case "BRANCH_GT": next = pick(v > thr, e.TrueIDs[pos], e.FalseIDs[pos])
+        case "BRANCH_EQ": next = pick(v == thr, e.TrueIDs[pos], e.FalseIDs[pos])
+        default: next = pick(v != thr, e.TrueIDs[pos], e.FalseIDs[pos])
+        }
+        p, ok := m.index[[2]int64{tid, next}]
+        if !ok { break }
+        pos = p
+    }
+    return e.NodeIDs[pos]
+}
+
+func pick(cond bool, a, b int64) int64 { if cond { return a } ; return b }
+
+func (m *ONNXTreeEnsemble) buildIndex() {
+    e := &m.ens
+    m.roots = map[int64]int{}
+    m.index = map[[2]int64]int{}
+    for i := range e.NodeIDs {
+        m.index[[2]int64{e.TreeIDs[i], e.NodeIDs[i]}] = i
+        if e.NodeIDs[i] == 0 { m.roots[e.TreeIDs[i]] = i }
+    }
+    m.weights = map[[2]int64][]classWeight{}
+    for i := range e.ClassIDs {
+        k := [2]int64{e.ClassTreeIDs[i], e.ClassNodeIDs[i]}
+        m.weights[k] = append(m.weights[k], classWeight{e.ClassIDs[i], e.ClassWeights[i]})
+    }
+}
+
+func (m *ONNXTreeEnsemble) decodeNode(b []byte) (bool, error) {
+    opType := ""
+    var attrs [][]byte
+    err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+        switch num {
+        case 4: opType = string(v)
+        case 5: attrs = append(attrs, v)
+        }
+        return nil
+    })
+    if err != nil || opType != "TreeEnsembleClassifier" { return false, err }
+    e := &m.ens
+    e.PostTransform = "NONE"
+    for _, a := range attrs {
+        var name, s string
+        var ints []int64
+        var floats []float32
+        var strs []string
+        err := walkFields(a, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+            switch num {
+            case 1: name = string(v)
+            case 4: s = string(v)
+            case 7:
+                if typ == protowire.Fixed32Type { floats = append(floats, math.Float32frombits(uint32(x))); return nil }
+                for len(v) > 0 {
+                    u, n := protowire.ConsumeFixed32(v)
+                    if n < 0 { return protowire.ParseError(n) }
+                    floats = append(floats, math.Float32frombits(u))
+                    v = v[n:]
+                }
+            case 8:
+                if typ == protowire.VarintType { ints = append(ints, int64(x)); return nil }
+                for len(v) > 0 {
+                    u, n := protowire.ConsumeVarint(v)
+                    if n < 0 { return protowire.ParseError(n) }
+                    ints = append(ints, int64(u))
+                    v = v[n:]
+                }
+            case 9: strs = append(strs, string(v))
+            }
+            return nil
+        })
+        if err != nil { return false, err }
+        switch name {
+        case "nodes_treeids": e.TreeIDs = ints
+        case "nodes_nodeids": e.NodeIDs = ints
+        case "nodes_featureids": e.FeatureIDs = ints
+        case "nodes_values": e.Values = floats
+        case "nodes_modes": e.Modes = strs
+        case "nodes_truenodeids": e.TrueIDs = ints
+        case "nodes_falsenodeids": e.FalseIDs = ints
+        case "class_treeids": e.ClassTreeIDs = ints
+        case "class_nodeids": e.ClassNodeIDs = ints
+        case "class_ids": e.ClassIDs = ints
+        case "class_weights": e.ClassWeights = floats
+        case "post_transform": e.PostTransform = s
+        case "classlabels_int64s": e.NClasses = len(ints)
+        }
+    }
+    n := len(e.NodeIDs)
+    if len(e.TreeIDs) != n || len(e.FeatureIDs) != n || len(e.Values) != n || len(e.Modes) != n || len(e.TrueIDs) != n || len(e.FalseIDs) != n {
+        return false, errors.New("atributos nodes_* com tamanhos inconsistentes")
+    }
+    c := len(e.ClassIDs)
+    if len(e.ClassTreeIDs) != c || len(e.ClassNodeIDs) != c || len(e.ClassWeights) != c {
+        return false, errors.New("atributos class_* com tamanhos inconsistentes")
+    }
+    return true, nil
+}
+
+// VerifyONNX compara os scores do arquivo com os do modelo em Go; no
+// multiclasse compara também a probabilidade de cada classe.
+func VerifyONNX(m Model, path string, X [][]float64, tol float64) (float64, error) {
+    om, err := LoadONNX(path)
+    if err != nil { return 0, err }
+    want := m.PredictProba(X)
+    got := om.PredictProba(X)
+    maxDiff := 0.0
+    for i := range want {
+        if d := math.Abs(want[i] - got[i]); d > maxDiff { maxDiff = d }
+    }
+    if mc, ok := m.(MultiClassModel); ok && mc.Classes() > 2 {
+        if om.Classes() != mc.Classes() { return 0, fmt.Errorf("ONNX com %d classes, modelo com %d", om.Classes(), mc.Classes()) }
+        wc, gc := mc.PredictClassProba(X), om.PredictClassProba(X)
+        for i := range wc {
+            for k := range wc[i] {
+                if d := math.Abs(wc[i][k] - gc[i][k]); d > maxDiff { maxDiff = d }
+            }
+        }
+    }
+    if maxDiff > tol { return maxDiff, fmt.Errorf("scores do ONNX divergem do modelo original (diferença máxima %.6f)", maxDiff) }
+    return maxDiff, nil
+}
+
+func decodeStringEntry(b []byte) (string, string) {
+    var k, v string
+    _ = walkFields(b, func(num protowire.Number, typ protowire.Type, val []byte, _ uint64) error {
+        if num == 1 { k = string(val) } else if num == 2 { v = string(val) }
+        return nil
+    })
+    return k, v
+}
+
+func walkFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+    for len(b) > 0 {
+        num, typ, n := protowire.ConsumeTag(b)
+        if n < 0 { return protowire.ParseError(n) }
+        b = b[n:]
+        var v []byte
+        var x uint64
+        switch typ {
+        case protowire.VarintType:
+            x, n = protowire.ConsumeVarint(b)
+        case protowire.Fixed32Type:
+            var u uint32
+            u, n = protowire.ConsumeFixed32(b)
+            x = uint64(u)
+        case protowire.Fixed64Type:
+            x, n = protowire.ConsumeFixed64(b)
+        case protowire.BytesType:
+            v, n = protowire.ConsumeBytes(b)
+        default:
+            n = protowire.ConsumeFieldValue(num, typ, b)
+        }
+        if n < 0 { return fmt.Errorf("ONNX inválido: %w", protowire.ParseError(n)) }
+        b = b[n:]
+        if err := fn(num, typ, v, x); err != nil { return err }
+    }
+    return nil
+}
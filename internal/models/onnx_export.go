@@ -0,0 +1,276 @@
+package models
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "google.golang.org/protobuf/encoding/protowire"
+)
+
+// Mensagens do onnx.proto escritas com protowire, sem código gerado.
+
+const (
+    onnxIRVersion    = 8
+    onnxOpsetVersion = 17
+    onnxMLOpset      = 3
+    onnxMLDomain     = "ai.onnx.ml"
+
+    onnxAttrString  = 3
+    onnxAttrFloats  = 6
+    onnxAttrInts    = 7
+    onnxAttrStrings = 8
+
+    onnxElemFloat = 1
+    onnxElemInt64 = 7
+)
+
+type treeEnsemble struct {
+    TreeIDs       []int64
+    NodeIDs       []int64
+    FeatureIDs    []int64
+    Values        []float32
+    Modes         []string
+    TrueIDs       []int64
+    FalseIDs      []int64
+    ClassTreeIDs  []int64
+    ClassNodeIDs  []int64
+    ClassIDs      []int64
+    ClassWeights  []float32
+    NClasses      int
+    PostTransform string
+}
+
+func ExportONNX(m Model, featureNames []string, path string) error {
+    ens, err := toTreeEnsemble(m)
+    if err != nil { return err }
+    if len(featureNames) == 0 { return errors.New("nomes das features são obrigatórios para exportar ONNX") }
+    for _, f := range ens.FeatureIDs {
+        if int(f) >= len(featureNames) { return fmt.Errorf("feature %d fora do vetor de %d features", f, len(featureNames)) }
+    }
+    if dir := filepath.Dir(path); dir != "" {
+        if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+    }
+    return os.WriteFile(path, encodeONNXModel(m.Name(), ens, featureNames), 0o644)
+}
+
+func toTreeEnsemble(m Model) (*treeEnsemble, error) {
+    ens := &treeEnsemble{NClasses: 2, PostTransform: "NONE"}
+    switch t := m.(type) {
+    case *DecisionTree:
+        if t.Root == nil { return nil, errors.New("árvore não treinada") }
+        ens.NClasses = max(2, t.NClasses)
+        ens.addDTNode(0, t.Root, 1)
+    case *RandomForest:
+        if len(t.Trees) == 0 { return nil, errors.New("floresta não treinada") }
+        ens.NClasses = max(2, t.NClasses)
+        w := 1.0 / float64(len(t.Trees))
+        for k, dt := range t.Trees { ens.addDTNode(int64(k), dt.Root, w) }
+    case *Bagging:
+        if len(t.Trees) == 0 { return nil, errors.New("bagging não treinado") }
+        ens.NClasses = max(2, t.NClasses)
+        w := 1.0 / float64(len(t.Trees))
+        for k, dt := range t.Trees { ens.addDTNode(int64(k), dt.Root, w) }
+    case *GradientBoosting:
+        if t.NClasses > 2 { return nil, errors.New("exportação ONNX de gradient boosting multiclasse não suportada") }
+        if len(t.Trees) == 0 { return nil, errors.New("gradient boosting não treinado") }
+        ens.PostTransform = "LOGISTIC"
+        for k, st := range t.Trees {
+            tid := int64(k)
+            ens.addBranch(tid, 0, st.Feature, st.Threshold, 1, 2)
+            ens.addLeaf(tid, 1)
+            ens.addLeaf(tid, 2)
+            ens.addWeight(tid, 1, 1, t.LearningRate*st.LeftVal)
+            ens.addWeight(tid, 2, 1, t.LearningRate*st.RightVal)
+        }
+    default:
+        return nil, fmt.Errorf("exportação ONNX não suportada para %s", m.Name())
+    }
+    return ens, nil
+}
+
+// Folhas recebem peso em todas as classes: a soma já é a probabilidade. No
+// multiclasse (tipologia) os pesos vêm de ClassProba, como em
+// PredictClassProba.
+func (ens *treeEnsemble) addDTNode(tid int64, n *DTNode, w float64) int64 {
+    var walk func(n *DTNode, id int64) int64
+    walk = func(n *DTNode, id int64) int64 {
+        if n == nil || n.IsLeaf {
+            ens.addLeaf(tid, id)
+            if n != nil && ens.NClasses > 2 && len(n.ClassProba) == ens.NClasses {
+                for k, p := range n.ClassProba { ens.addWeight(tid, id, int64(k), w*p) }
+                return id + 1
+            }
+            p := 0.5
+            if n != nil { p = n.ProbaLeaf }
+            ens.addWeight(tid, id, 0, w*(1-p))
+            ens.addWeight(tid, id, 1, w*p)
+            return id + 1
+        }
+        pos := len(ens.NodeIDs)
+        ens.addBranch(tid, id, n.Feature, n.Threshold, id+1, 0)
+        next := walk(n.Left, id+1)
+        ens.FalseIDs[pos] = next
+        return walk(n.Right, next)
+    }
+    return walk(n, 0)
+}
+
+func (ens *treeEnsemble) addBranch(tid, id int64, feature int, thr float64, trueID, falseID int64) {
+    ens.TreeIDs = append(ens.TreeIDs, tid)
+    ens.NodeIDs = append(ens.NodeIDs, id)
+    ens.FeatureIDs = append(ens.FeatureIDs, int64(feature))
+    ens.Values = append(ens.Values, float32(thr))
+    ens.Modes = append(ens.Modes, "BRANCH_LEQ")
+    ens.TrueIDs = append(ens.TrueIDs, trueID)
+    ens.FalseIDs = append(ens.FalseIDs, falseID)
+}
+
+func (ens *treeEnsemble) addLeaf(tid, id int64) {
+    ens.TreeIDs = append(ens.TreeIDs, tid)
+    ens.NodeIDs = append(ens.NodeIDs, id)
+    ens.FeatureIDs = append(ens.FeatureIDs, 0)
+    ens.Values = append(ens.Values, 0)
+    ens.Modes = append(ens.Modes, "LEAF")
+    ens.TrueIDs = append(ens.TrueIDs, 0)
+    ens.FalseIDs = append(ens.FalseIDs, 0)
+}
+
+func (ens *treeEnsemble) addWeight(tid, id, class int64, w float64) {
+    ens.ClassTreeIDs = append(ens.ClassTreeIDs, tid)
+    ens.ClassNodeIDs = append(ens.ClassNodeIDs, id)
+    ens.ClassIDs = append(ens.ClassIDs, class)
+    ens.ClassWeights = append(ens.ClassWeights, float32(w))
+}
+
+func encodeONNXModel(name string, ens *treeEnsemble, featureNames []string) []byte {
+    var b []byte
+    b = appendVarintField(b, 1, onnxIRVersion)
+    b = appendStringField(b, 2, "antifraude")
+    b = appendStringField(b, 3, "1")
+    b = appendStringField(b, 4, "antifraude.models")
+    b = appendStringField(b, 6, name)
+    b = appendMessageField(b, 7, encodeONNXGraph(ens, featureNames))
+    b = appendMessageField(b, 8, encodeOpset("", onnxOpsetVersion))
+    b = appendMessageField(b, 8, encodeOpset(onnxMLDomain, onnxMLOpset))
+    b = appendMessageField(b, 14, encodeStringEntry("model", name))
+    b = appendMessageField(b, 14, encodeStringEntry("feature_names", strings.Join(featureNames, ",")))
+    return b
+}
+
+func encodeOpset(domain string, version int64) []byte {
+    var b []byte
+    b = appendStringField(b, 1, domain)
+    return appendVarintField(b, 2, uint64(version))
+}
+
+func encodeStringEntry(k, v string) []byte {
+    var b []byte
+    b = appendStringField(b, 1, k)
+    return appendStringField(b, 2, v)
+}
+
+func encodeONNXGraph(ens *treeEnsemble, featureNames []string) []byte {
+    labels := make([]int64, max(2, ens.NClasses))
+    for k := range labels { labels[k] = int64(k) }
+    var node []byte
+    node = appendStringField(node, 1, "X")
+    node = appendStringField(node, 2, "label")
+    node = appendStringField(node, 2, "probabilities")
+    node = appendStringField(node, 3, "TreeEnsembleClassifier")
+    node = appendStringField(node, 4, "TreeEnsembleClassifier")
+    node = appendStringField(node, 7, onnxMLDomain)
+    attrs := [][]byte{
+        intsAttr("nodes_treeids", ens.TreeIDs),
+        intsAttr("nodes_nodeids", ens.NodeIDs),
+        intsAttr("nodes_featureids", ens.FeatureIDs),
+        floatsAttr("nodes_values", ens.Values),
+        stringsAttr("nodes_modes", ens.Modes),
+        intsAttr("nodes_truenodeids", ens.TrueIDs),
+        intsAttr("nodes_falsenodeids", ens.FalseIDs),
+        intsAttr("nodes_missing_value_tracks_true", make([]int64, len(ens.NodeIDs))),
+        intsAttr("class_treeids", ens.ClassTreeIDs),
+        intsAttr("class_nodeids", ens.ClassNodeIDs),
+        intsAttr("class_ids", ens.ClassIDs),
+        floatsAttr("class_weights", ens.ClassWeights),
+        intsAttr("classlabels_int64s", labels),
+        stringAttr("post_transform", ens.PostTransform),
+    }
+    for _, a := range attrs { node = appendMessageField(node, 5, a) }
+
+    var g []byte
+    g = appendMessageField(g, 1, node)
+    g = appendStringField(g, 2, "antifraude_tree_ensemble")
+    g = appendMessageField(g, 11, encodeValueInfo("X", onnxElemFloat, []int64{-1, int64(len(featureNames))}, strings.Join(featureNames, ",")))
+    g = appendMessageField(g, 12, encodeValueInfo("label", onnxElemInt64, []int64{-1}, ""))
+    g = appendMessageField(g, 12, encodeValueInfo("probabilities", onnxElemFloat, []int64{-1, int64(len(labels))}, ""))
+    return g
+}
+
+func encodeValueInfo(name string, elem int32, dims []int64, doc string) []byte {
+    var shape []byte
+    for _, d := range dims {
+        var dim []byte
+        if d < 0 { dim = appendStringField(dim, 2, "N") } else { dim = appendVarintField(dim, 1, uint64(d)) }
+        shape = appendMessageField(shape, 1, dim)
+    }
+    var tensor []byte
+    tensor = appendVarintField(tensor, 1, uint64(elem))
+    tensor = appendMessageField(tensor, 2, shape)
+    var typ []byte
+    typ = appendMessageField(typ, 1, tensor)
+    var b []byte
+    b = appendStringField(b, 1, name)
+    b = appendMessageField(b, 2, typ)
+    if doc != "" { b = appendStringField(b, 3, doc) }
+    return b
+}
+
+func intsAttr(name string, vs []int64) []byte {
+    var b []byte
+    b = appendStringField(b, 1, name)
+    for _, v := range vs { b = appendVarintField(b, 8, uint64(v)) }
+    return appendVarintField(b, 20, onnxAttrInts)
+}
+
+func floatsAttr(name string, vs []float32) []byte {
+    var b []byte
+    b = appendStringField(b, 1, name)
+    for _, v := range vs {
+        b = protowire.AppendTag(b, 7, protowire.Fixed32Type)
+        b = protowire.AppendFixed32(b, math.Float32bits(v))
+    }
+    return appendVarintField(b, 20, onnxAttrFloats)
+}
+
+func stringsAttr(name string, vs []string) []byte {
+    var b []byte
+    b = appendStringField(b, 1, name)
+    for _, v := range vs { b = appendStringField(b, 9, v) }
+    return appendVarintField(b, 20, onnxAttrStrings)
+}
+
+func stringAttr(name, v string) []byte {
+    var b []byte
+    b = appendStringField(b, 1, name)
+    b = appendStringField(b, 4, v)
+    return appendVarintField(b, 20, onnxAttrString)
+}
+
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+    b = protowire.AppendTag(b, num, protowire.VarintType)
+    return protowire.AppendVarint(b, v)
+}
+
+func appendStringField(b []byte, num protowire.Number, v string) []byte {
+    b = protowire.AppendTag(b, num, protowire.BytesType)
+    return protowire.AppendString(b, v)
+}
+
+func appendMessageField(b []byte, num protowire.Number, msg []byte) []byte {
+    b = protowire.AppendTag(b, num, protowire.BytesType)
+    return protowire.AppendBytes(b, msg)
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+    "math"
+    "math/rand"
+    "path/filepath"
+    "testing"
+)
+
+// onnxTestData gera um problema binário pequeno com valores representáveis
+// em float32, para que os limiares exportados não mudem o caminho na árvore.
+func onnxTestData(n int, seed int64) ([][]float64, []int) {
+    rng := rand.New(rand.NewSource(seed))
+    X := make([][]float64, n)
+    y := make([]int, n)
+    for i := range X {
+        x := make([]float64, 4)
+        for j := range x { x[j] = float64(float32(rng.NormFloat64() * 100)) }
+        X[i] = x
+        z := 0.03*x[0] - 0.02*x[1] + 0.01*x[2]*math.Copysign(1, x[3])
+        if rng.Float64() < sigmoid(z) { y[i] = 1 }
+    }
+    return X, y
+}
+
+func TestONNXRoundTrip(t *testing.T) {
+    names := []string{"f0", "f1", "f2", "f3"}
+    cases := []struct {
+        name  string
+        model func() Model
+    }{
+        {"dt", func() Model { m := NewDecisionTree(); m.MinSamplesSplit = 20; return m }},
+        {"rf", func() Model { m := NewRandomForest(); m.NEstimators = 10; m.MinSamples = 20; return m }},
+        {"bagging", func() Model { m := NewBagging(); m.NEstimators = 10; m.MinSamples = 20; return m }},
+        {"gb", func() Model { m := NewGradientBoosting(); m.NEstimators = 30; m.MinSamples = 20; return m }},
+    }
+    for _, c := range cases {
+        t.Run(c.name, func(t *testing.T) {
+            rand.Seed(7)
+            X, y := onnxTestData(2000, 1)
+            m := c.model()
+            if err := m.Fit(X, y); err != nil { t.Fatalf("Fit: %v", err) }
+            path := filepath.Join(t.TempDir(), c.name+".onnx")
+            if err := ExportONNX(m, names, path); err != nil { t.Fatalf("ExportONNX: %v", err) }
+
+            om, err := LoadONNX(path)
+            if err != nil { t.Fatalf("LoadONNX: %v", err) }
+            if len(om.FeatureNames) != len(names) { t.Fatalf("feature_names = %v, esperado %v", om.FeatureNames, names) }
+
+            Xe, _ := onnxTestData(500, 2)
+            want := m.PredictProba(Xe)
+            got := om.PredictProba(Xe)
+            for i := range want {
+                if d := math.Abs(want[i] - got[i]); d > 1e-5 {
+                    t.Fatalf("linha %d: ONNX %.7f, Go %.7f (diferença %.2g)", i, got[i], want[i], d)
+                }
+            }
+            if _, err := VerifyONNX(m, path, Xe, 1e-5); err != nil { t.Fatalf("VerifyONNX: %v", err) }
+        })
+    }
+}
+
+func TestONNXRejectsUntrained(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "m.onnx")
+    for _, m := range []Model{NewDecisionTree(), NewRandomForest(), NewBagging(), NewGradientBoosting()} {
+        if err := ExportONNX(m, []string{"f0"}, path); err == nil { t.Errorf("%s sem treino exportou sem erro", m.Name()) }
+    }
+}
+
+func TestONNXMultiClass(t *testing.T) {
+    rand.Seed(7)
+    X, y := onnxTestData(2000, 3)
+    for i, x := range X {
+        if y[i] == 1 && x[2] > 0 { y[i] = 2 }
+    }
+    names := []string{"f0", "f1", "f2", "f3"}
+    Xe, _ := onnxTestData(300, 4)
+    rf := NewRandomForest()
+    rf.NEstimators, rf.MinSamples = 10, 20
+    dt := NewDecisionTree()
+    dt.MinSamplesSplit = 20
+    for _, m := range []MultiClassModel{dt, rf} {
+        if err := m.FitMulti(X, y, 3); err != nil { t.Fatalf("FitMulti: %v", err) }
+        path := filepath.Join(t.TempDir(), "multi.onnx")
+        if err := ExportONNX(m, names, path); err != nil { t.Fatalf("ExportONNX: %v", err) }
+        om, err := LoadONNX(path)
+        if err != nil { t.Fatalf("LoadONNX: %v", err) }
+        if om.Classes() != 3 { t.Fatalf("%s: ONNX com %d classes, esperado 3", m.Name(), om.Classes()) }
+        want, got := m.PredictClassProba(Xe), om.PredictClassProba(Xe)
+        for i := range want {
+            for k := range want[i] {
+                if d := math.Abs(want[i][k] - got[i][k]); d > 1e-5 { t.Fatalf("%s linha %d classe %d: ONNX %.7f, Go %.7f", m.Name(), i, k, got[i][k], want[i][k]) }
+            }
+        }
+        if _, err := VerifyONNX(m, path, Xe, 1e-5); err != nil { t.Fatalf("%s: VerifyONNX: %v", m.Name(), err) }
+    }
+
+    gb := NewGradientBoosting()
+    gb.NEstimators, gb.MinSamples = 5, 20
+    if err := gb.FitMulti(X, y, 3); err != nil { t.Fatalf("FitMulti: %v", err) }
+    if err := ExportONNX(gb, names, filepath.Join(t.TempDir(), "gb.onnx")); err == nil { t.Error("gradient boosting multiclasse exportou sem erro") }
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+    "errors"
+    "math"
+    "math/rand"
+)
+
+type PULearner struct {
+    NewModel    func() Model
+    HoldoutFrac float64
+    C           float64
+    Prior       float64
+    Classifier  Model
+    Final       Model
+}
+
+func NewPULearner(newModel func() Model) *PULearner {
+    return &PULearner{NewModel: newModel, HoldoutFrac: 0.2}
+}
+
+func (pu *PULearner) Name() string {
+    if pu.Final == nil { return "PU" }
+    return "PU(" + pu.Final.Name() + ")"
+}
+
+// Fit segue Elkan & Noto (2008): y = 1 fraude confirmada, 0 limpa confirmada,
+// -1 não rotulada. c = P(rotulado | fraude) é estimado em positivos de holdout
+// e o modelo final é treinado com as não rotuladas duplicadas e ponderadas.
+func (pu *PULearner) Fit(X [][]float64, y []int) error { return pu.FitDataset(Dense(X), y) }
+
+// FitDataset é o Fit lendo de um Dataset; holdout e duplicatas são visões das
+// linhas de X, sem cópia.
+func (pu *PULearner) FitDataset(X Dataset, y []int) error {
+    if X.Rows() != len(y) { return errors.New("X e y com tamanhos diferentes") }
+    if _, ok := pu.NewModel().(DatasetModel); !ok { return errors.New("PU learning precisa de um modelo com pesos por amostra (dt, rf, bagging ou gb)") }
+    var posIdx []int
+    for i := range y { if y[i] == 1 { posIdx = append(posIdx, i) } }
+    if len(posIdx) < 2 { return errors.New("PU learning precisa de ao menos 2 fraudes confirmadas") }
+
+    // o holdout tira a mesma fração das demais linhas: tirar só fraudes
+    // rotuladas baixaria a proporção de rotuladas no treino e c junto
+    perm := rand.Perm(len(posIdx))
+    nHold := int(math.Max(1, pu.HoldoutFrac*float64(len(posIdx))))
+    hold := map[int]bool{}
+    for _, k := range perm[:nHold] { hold[posIdx[k]] = true }
+    skip := map[int]bool{}
+    for i := range y { if y[i] != 1 && rand.Float64() < pu.HoldoutFrac { skip[i] = true } }
+    gIdx := make([]int, 0, len(y)-nHold-len(skip))
+    s := make([]int, 0, cap(gIdx))
+    hIdx := make([]int, 0, nHold)
+    for i := range y {
+        if hold[i] { hIdx = append(hIdx, i); continue }
+        if skip[i] { continue }
+        gIdx = append(gIdx, i)
+        if y[i] == 1 { s = append(s, 1) } else { s = append(s, 0) }
+    }
+    classifier := pu.NewModel().(DatasetModel)
+    pu.Classifier = classifier
+    if err := classifier.FitDataset(Subset(X, gIdx), s, 2, nil); err != nil { return err }
+    c := 0.0
+    for _, p := range PredictProbaDataset(pu.Classifier, Subset(X, hIdx)) { c += p }
+    c /= float64(len(hIdx))
+    if c <= 1e-6 { return errors.New("estimativa de c inválida: classificador não separa fraudes rotuladas") }
+    if c > 1 { c = 1 }
+    pu.C = c
+
+    // Cada não rotulada entra duas vezes: como fraude com peso w e como limpa
+    // com peso 1 - w.
+    g := PredictProbaDataset(pu.Classifier, X)
+    idx := make([]int, 0, len(y)+len(y)/2)
+    yf := make([]int, 0, cap(idx))
+    wf := make([]float64, 0, cap(idx))
+    expectedPos := 0.0
+    for i := range y {
+        switch y[i] {
+        case 1:
+            idx, yf, wf = append(idx, i), append(yf, 1), append(wf, 1)
+            expectedPos++
+        case 0:
+            idx, yf, wf = append(idx, i), append(yf, 0), append(wf, 1)
+        default:
+            w := puWeight(g[i], c)
+            expectedPos += w
+            if w > 0 { idx, yf, wf = append(idx, i), append(yf, 1), append(wf, w) }
+            if w < 1 { idx, yf, wf = append(idx, i), append(yf, 0), append(wf, 1-w) }
+        }
+    }
+    pu.Prior = expectedPos / float64(len(y))
+    final := pu.NewModel().(DatasetModel)
+    pu.Final = final
+    return final.FitDataset(Subset(X, idx), yf, 2, wf)
+}
+
+func puWeight(g, c float64) float64 {
+    if g >= 1 { return 1 }
+    w := (1 - c) / c * g / (1 - g)
+    return math.Max(0, math.Min(1, w))
+}
+
+func (pu *PULearner) Predict(X [][]float64) []int { return pu.Final.Predict(X) }
+
+func (pu *PULearner) PredictProba(X [][]float64) []float64 { return pu.Final.PredictProba(X) }
@@ -0,0 +1,53 @@
+package models
+
+import (
+    "math"
+    "math/rand"
+    "testing"
+)
+
+// scarData sorteia fraudes (30%) longe das limpas e rotula cada fraude com
+// probabilidade c, ao acaso (SCAR); o resto fica como não rotulado (-1).
+func scarData(n int, c float64, rng *rand.Rand) ([][]float64, []int) {
+    X := make([][]float64, n)
+    y := make([]int, n)
+    for i := range X {
+        mu := -3.0
+        y[i] = -1
+        if rng.Float64() < 0.3 {
+            mu = 3
+            if rng.Float64() < c { y[i] = 1 }
+        }
+        X[i] = []float64{mu + rng.NormFloat64(), mu + rng.NormFloat64()}
+    }
+    return X, y
+}
+
+func TestPULearnerEstimatesC(t *testing.T) {
+    for _, c := range []float64{0.2, 0.5, 0.8} {
+        rand.Seed(int64(c * 100))
+        X, y := scarData(4000, c, rand.New(rand.NewSource(1)))
+        pu := NewPULearner(func() Model { m := NewDecisionTree(); m.MaxDepth = 3; m.MinSamplesSplit = 100; return m })
+        if err := pu.Fit(X, y); err != nil { t.Fatalf("c=%.1f: Fit: %v", c, err) }
+        if math.Abs(pu.C-c) > 0.04 { t.Errorf("c=%.1f: estimado %.3f", c, pu.C) }
+        if math.Abs(pu.Prior-0.3) > 0.03 { t.Errorf("c=%.1f: prior estimado %.3f, esperado ~0.3", c, pu.Prior) }
+    }
+}
+
+func TestPUWeight(t *testing.T) {
+    for _, tc := range []struct{ g, c, w float64 }{
+        {0, 0.5, 0},
+        {0.25, 0.5, 1.0 / 3},
+        {0.5, 0.5, 1},
+        {0.9, 0.5, 1},
+        {1, 0.5, 1},
+        {0.1, 0.9, 1.0 / 81},
+    } {
+        if got := puWeight(tc.g, tc.c); math.Abs(got-tc.w) > 1e-12 { t.Errorf("puWeight(%v, %v) = %v, esperado %v", tc.g, tc.c, got, tc.w) }
+    }
+}
+
+func TestPULearnerNeedsLabeledFrauds(t *testing.T) {
+    pu := NewPULearner(func() Model { return NewDecisionTree() })
+    if err := pu.Fit([][]float64{{0}, {1}, {2}}, []int{1, -1, -1}); err == nil { t.Error("Fit aceitou uma fraude rotulada só") }
+}
@@ -11,6 +11,7 @@ type RandomForest struct {
     MinSamples  int
     MaxThresholdsPerFe int
     MaxFeatures int
+    NClasses    int
     Trees       []*DecisionTree
 }
 
@@ -21,9 +22,30 @@ func NewRandomForest() *RandomForest {
 func (rf *RandomForest) Name() string { return "RandomForest" }
 
 func (rf *RandomForest) Fit(X [][]float64, y []int) error {
+    return rf.FitMulti(X, y, 2)
+}
+
+func (rf *RandomForest) FitMulti(X [][]float64, y []int, nClasses int) error {
+    return rf.fit(Dense(X), y, nClasses, nil)
+}
+
+// FitWeighted treina com peso por amostra (binário); cada árvore recebe os
+// pesos das linhas sorteadas no bootstrap.
+func (rf *RandomForest) FitWeighted(X [][]float64, y []int, w []float64) error {
+    return rf.FitDataset(Dense(X), y, 2, w)
+}
+
+func (rf *RandomForest) FitDataset(X Dataset, y []int, nClasses int, w []float64) error {
+    if err := checkWeights(y, nClasses, w); err != nil { return err }
+    return rf.fit(X, y, nClasses, w)
+}
+
+func (rf *RandomForest) fit(X Dataset, y []int, nClasses int, w []float64) error {
+    if err := checkClasses(y, nClasses); err != nil { return err }
+    rf.NClasses = nClasses
     if rf.NEstimators <= 0 { rf.NEstimators = 30 }
-    n := len(X)
-    nFeats := len(X[0])
+    n := X.Rows()
+    nFeats := X.NumCols()
     if rf.MaxFeatures <= 0 {
         rf.MaxFeatures = int(math.Max(1, math.Min(float64(nFeats), math.Sqrt(float64(nFeats)))))
     }
@@ -31,15 +53,19 @@ func (rf *RandomForest) Fit(X [][]float64, y []int) error {
     for k := 0; k < rf.NEstimators; k++ {
         idx := make([]int, n)
         for i := 0; i < n; i++ { idx[i] = rand.Intn(n) }
-        Xb := make([][]float64, n)
         yb := make([]int, n)
-        for i := 0; i < n; i++ { Xb[i] = X[idx[i]]; yb[i] = y[idx[i]] }
+        var wb []float64
+        if w != nil { wb = make([]float64, n) }
+        for i := 0; i < n; i++ {
+            yb[i] = y[idx[i]]
+            if w != nil { wb[i] = w[idx[i]] }
+        }
         dt := NewDecisionTree()
         dt.MaxDepth = rf.MaxDepth
         dt.MinSamplesSplit = rf.MinSamples
         dt.MaxThresholdsPerFe = rf.MaxThresholdsPerFe
         dt.MaxFeatures = rf.MaxFeatures
-        if err := dt.Fit(Xb, yb); err != nil { return err }
+        if err := dt.fit(Subset(X, idx), yb, nClasses, wb); err != nil { return err }
         rf.Trees = append(rf.Trees, dt)
     }
     return nil
@@ -63,4 +89,28 @@ func (rf *RandomForest) PredictProba(X [][]float64) []float64 {
     m := float64(len(rf.Trees))
     for i := 0; i < n; i++ { out[i] /= m }
     return out
-}
\ No newline at end of file
+}
+
+func (rf *RandomForest) Classes() int { return rf.NClasses }
+
+func (rf *RandomForest) PredictClassProba(X [][]float64) [][]float64 {
+    return averageClassProba(rf.Trees, X)
+}
+
+func averageClassProba(trees []*DecisionTree, X [][]float64) [][]float64 {
+    out := make([][]float64, len(X))
+    if len(trees) == 0 {
+        for i := range out { out[i] = []float64{0.5, 0.5} }
+        return out
+    }
+    for _, dt := range trees {
+        ps := dt.PredictClassProba(X)
+        for i := range ps {
+            if out[i] == nil { out[i] = make([]float64, len(ps[i])) }
+            for c := range ps[i] { if c < len(out[i]) { out[i][c] += ps[i][c] } }
+        }
+    }
+    m := float64(len(trees))
+    for i := range out { for c := range out[i] { out[i][c] /= m } }
+    return out
+}
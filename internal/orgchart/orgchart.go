@@ -0,0 +1,135 @@
+package orgchart
+
+import (
+    "encoding/csv"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "antifraude/internal/data"
+)
+
+// Seniority ordena os cargos; cargo fora da lista não entra na comparação.
+var Seniority = map[string]int{"analista": 1, "especialista": 2, "coordenador": 3, "gerente": 4, "diretor": 5}
+
+// Employee vem do cadastro de RH. End zero significa ativo.
+type Employee struct {
+    ID         string
+    JobTitle   string
+    Department string
+    ManagerID  string
+    Start      time.Time
+    End        time.Time
+}
+
+func (e Employee) ActiveAt(t time.Time) bool {
+    if !e.Start.IsZero() && t.Before(e.Start) { return false }
+    if !e.End.IsZero() && t.After(e.End) { return false }
+    return true
+}
+
+// Chart é o organograma carregado do CSV de RH. Vai serializado com o
+// vetorizador, como o calendário: o modelo usa o cadastro com que foi treinado.
+type Chart struct {
+    Employees map[string]Employee
+}
+
+func New() *Chart { return &Chart{Employees: map[string]Employee{}} }
+
+// Load substitui o cadastro pelo CSV employee_id,job_title,department,
+// manager_id,start_date,end_date; datas vazias ficam em aberto.
+func (c *Chart) Load(path string) error {
+    f, err := os.Open(path)
+    if err != nil { return err }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil { return err }
+    emps := map[string]Employee{}
+    parse := func(s string) (time.Time, error) {
+        if s == "" { return time.Time{}, nil }
+        return time.Parse("2006-01-02", s)
+    }
+    for i, row := range rows {
+        if i == 0 && strings.EqualFold(row[0], "employee_id") { continue }
+        if len(row) < 6 { return fmt.Errorf("linha %d: esperado employee_id,job_title,department,manager_id,start_date,end_date", i+1) }
+        e := Employee{ID: row[0], JobTitle: row[1], Department: row[2], ManagerID: row[3]}
+        if e.Start, err = parse(row[4]); err != nil { return fmt.Errorf("linha %d: start_date inválida %q", i+1, row[4]) }
+        if e.End, err = parse(row[5]); err != nil { return fmt.Errorf("linha %d: end_date inválida %q", i+1, row[5]) }
+        emps[e.ID] = e
+    }
+    c.Employees = emps
+    return nil
+}
+
+func (c *Chart) Get(id string) (Employee, bool) {
+    e, ok := c.Employees[id]
+    return e, ok
+}
+
+// Manages indica se manager está acima de id na cadeia de gestores.
+func (c *Chart) Manages(manager, id string) bool {
+    seen := map[string]bool{}
+    for cur := c.Employees[id].ManagerID; cur != "" && !seen[cur]; cur = c.Employees[cur].ManagerID {
+        if cur == manager { return true }
+        seen[cur] = true
+    }
+    return false
+}
+
+// Result é a checagem da cadeia de aprovação de uma despesa. Aprovar dentro
+// da própria cadeia de gestores nunca conta como fora do departamento.
+type Result struct {
+    ApproverUnknown      bool
+    ApproverJunior       bool
+    ApproverOutsideDept  bool
+    ApproverInactive     bool
+    RequesterInactive    bool
+    TravellerNotEmployee bool
+    ApproverInChain      bool
+}
+
+// Check usa a data da solicitação para quem aprova e solicita e a data da
+// viagem para o viajante. Solicitante fora do cadastro usa cargo e
+// departamento informados na despesa.
+func (c *Chart) Check(e data.Expense) Result {
+    var r Result
+    if c == nil || len(c.Employees) == 0 { return r }
+    req, reqOK := c.Get(e.RequesterID)
+    if !reqOK { req = Employee{ID: e.RequesterID, JobTitle: e.JobTitle, Department: e.Department} }
+    if reqOK && !req.ActiveAt(e.RequestDate) { r.RequesterInactive = true }
+    if e.TravellerID != "" {
+        if t, ok := c.Get(e.TravellerID); !ok || !t.ActiveAt(e.TravelDate) { r.TravellerNotEmployee = true }
+    }
+    if e.ApproverID == "" || e.ApproverID == e.RequesterID { return r }
+    ap, ok := c.Get(e.ApproverID)
+    if !ok { r.ApproverUnknown = true; return r }
+    r.ApproverInactive = !ap.ActiveAt(e.RequestDate)
+    r.ApproverInChain = c.Manages(ap.ID, req.ID)
+    ra, okA := Seniority[strings.ToLower(ap.JobTitle)]
+    rr, okR := Seniority[strings.ToLower(req.JobTitle)]
+    r.ApproverJunior = okA && okR && ra < rr
+    r.ApproverOutsideDept = !r.ApproverInChain && !strings.EqualFold(ap.Department, req.Department)
+    return r
+}
+
+func (r Result) Flags() []string {
+    var flags []string
+    if r.ApproverUnknown { flags = append(flags, "aprovador fora do cadastro de RH") }
+    if r.ApproverJunior { flags = append(flags, "aprovador com cargo abaixo do solicitante") }
+    if r.ApproverOutsideDept { flags = append(flags, "aprovador de outro departamento") }
+    if r.ApproverInactive { flags = append(flags, "aprovador desligado ou ainda não contratado na data") }
+    if r.RequesterInactive { flags = append(flags, "solicitante desligado ou ainda não contratado na data") }
+    if r.TravellerNotEmployee { flags = append(flags, "viajante não é funcionário na data da viagem") }
+    return flags
+}
+
+func (c *Chart) Names() []string {
+    return []string{"OrgAprovadorDesconhecido", "OrgAprovadorJunior", "OrgAprovadorOutroDepto", "OrgAprovadorInativo", "OrgSolicitanteInativo", "OrgViajanteNaoFuncionario", "OrgAprovadorNaCadeia"}
+}
+
+func (c *Chart) Transform(e data.Expense) []float64 {
+    r := c.Check(e)
+    b := func(v bool) float64 { if v { return 1 }; return 0 }
+    return []float64{b(r.ApproverUnknown), b(r.ApproverJunior), b(r.ApproverOutsideDept), b(r.ApproverInactive), b(r.RequesterInactive), b(r.TravellerNotEmployee), b(r.ApproverInChain)}
+}
@@ -0,0 +1,309 @@
+package policy
+
+import (
+    "encoding/csv"
+    "fmt"
+    "math"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "unicode"
+
+    "golang.org/x/text/runes"
+    "golang.org/x/text/transform"
+    "golang.org/x/text/unicode/norm"
+
+    "antifraude/internal/data"
+)
+
+// Allowance é o teto diário de refeições e o de uma diária de hospedagem.
+type Allowance struct {
+    Meals   float64
+    Lodging float64
+}
+
+// DefaultTiers classifica as cidades: 1 = SP, RJ e Brasília, 2 = demais
+// capitais; cidade fora da lista cai no DefaultTier.
+var DefaultTiers = map[string]int{
+    "sao paulo": 1, "rio de janeiro": 1, "brasilia": 1,
+    "belo horizonte": 2, "curitiba": 2, "porto alegre": 2, "florianopolis": 2, "salvador": 2, "recife": 2,
+    "fortaleza": 2, "vitoria": 2, "goiania": 2, "natal": 2, "joao pessoa": 2, "aracaju": 2, "manaus": 2, "belem": 2,
+}
+
+// DefaultPerDiem é a tabela de diárias por faixa de cidade e cargo.
+func DefaultPerDiem() map[int]map[string]Allowance {
+    return map[int]map[string]Allowance{
+        1: {"analista": {150, 450}, "especialista": {150, 450}, "coordenador": {180, 550}, "gerente": {200, 650}, "diretor": {250, 900}},
+        2: {"analista": {120, 350}, "especialista": {120, 350}, "coordenador": {150, 420}, "gerente": {170, 500}, "diretor": {210, 700}},
+        3: {"analista": {100, 250}, "especialista": {100, 250}, "coordenador": {120, 300}, "gerente": {140, 380}, "diretor": {180, 550}},
+    }
+}
+
+// CityKey normaliza o nome da cidade: minúsculas, sem acentos e sem UF
+// ("São Paulo/SP", "Sao Paulo - SP" e "são paulo" dão a mesma chave).
+func CityKey(s string) string {
+    t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+    if out, _, err := transform.String(t, s); err == nil { s = out }
+    s = strings.ToLower(s)
+    if i := strings.IndexAny(s, "/,"); i >= 0 { s = s[:i] }
+    if i := strings.LastIndex(s, " - "); i >= 0 && len(strings.TrimSpace(s[i+3:])) == 2 { s = s[:i] }
+    return strings.Join(strings.Fields(s), " ")
+}
+
+func pairKey(a, b string) string {
+    a, b = CityKey(a), CityKey(b)
+    if b < a { a, b = b, a }
+    return a + "|" + b
+}
+
+const (
+    Leve     = 1
+    Moderado = 2
+    Grave    = 3
+)
+
+var severityNames = map[int]string{Leve: "leve", Moderado: "moderado", Grave: "grave"}
+
+// Violation é um item fora da política; Ratio é valor / teto.
+type Violation struct {
+    Rule     string  `json:"rule"`
+    Severity string  `json:"severity"`
+    Level    int     `json:"level"`
+    Amount   float64 `json:"amount"`
+    Limit    float64 `json:"limit"`
+    Ratio    float64 `json:"ratio"`
+    Detail   string  `json:"detail"`
+}
+
+// Policy reúne a tabela de distâncias, as faixas de cidade, as diárias e a
+// taxa de quilometragem. Vai serializada com o vetorizador, como o
+// calendário. Tolerance é a folga sobre o teto antes de sinalizar; acima de
+// ModerateRatio e GraveRatio a violação sobe de grau.
+// Days acumula refeições e hospedagem por solicitante, dia da viagem, cidade
+// e categoria: a diária vale para a soma do dia, não para cada item.
+type Policy struct {
+    Distances     map[string]float64
+    Tiers         map[string]int
+    DefaultTier   int
+    PerDiem       map[int]map[string]Allowance
+    MileageRate   float64
+    Tolerance     float64
+    ModerateRatio float64
+    GraveRatio    float64
+    Days          map[string][]DayItem
+    NextSeq       int64
+    mu            sync.RWMutex
+}
+
+// DayItem é uma despesa já vista que conta para a diária do dia.
+type DayItem struct {
+    Seq       int64
+    Day       int32
+    ExpenseID string
+    Amount    float64
+}
+
+func New() *Policy {
+    tiers := map[string]int{}
+    for k, v := range DefaultTiers { tiers[k] = v }
+    return &Policy{Distances: map[string]float64{}, Tiers: tiers, DefaultTier: 3, PerDiem: DefaultPerDiem(), MileageRate: 1.10, Tolerance: 1.1, ModerateRatio: 1.5, GraveRatio: 2, Days: map[string][]DayItem{}}
+}
+
+// LoadDistances substitui a tabela pelo CSV origin,destination,km; os
+// trechos valem nos dois sentidos.
+func (p *Policy) LoadDistances(path string) error {
+    f, err := os.Open(path)
+    if err != nil { return err }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil { return err }
+    dist := map[string]float64{}
+    for i, row := range rows {
+        if len(row) < 3 { return fmt.Errorf("linha %d: esperado origin,destination,km", i+1) }
+        if i == 0 && strings.EqualFold(row[0], "origin") { continue }
+        km, err := strconv.ParseFloat(row[2], 64)
+        if err != nil || km <= 0 { return fmt.Errorf("linha %d: km inválido %q", i+1, row[2]) }
+        dist[pairKey(row[0], row[1])] = km
+    }
+    p.Distances = dist
+    return nil
+}
+
+func (p *Policy) Distance(a, b string) (float64, bool) {
+    if CityKey(a) == "" || CityKey(b) == "" { return 0, false }
+    if CityKey(a) == CityKey(b) { return 0, true }
+    km, ok := p.Distances[pairKey(a, b)]
+    return km, ok
+}
+
+func (p *Policy) Tier(city string) int {
+    if t, ok := p.Tiers[CityKey(city)]; ok { return t }
+    return p.DefaultTier
+}
+
+// Allowance usa a cidade de destino e o cargo; cargo fora da tabela usa o de
+// analista.
+func (p *Policy) Allowance(city, jobTitle string) Allowance {
+    row := p.PerDiem[p.Tier(city)]
+    if a, ok := row[strings.ToLower(jobTitle)]; ok { return a }
+    return row["analista"]
+}
+
+// IsMileage reconhece reembolso de quilometragem pela descrição de uma
+// despesa de transporte; "ida e volta" dobra a distância do trecho.
+func IsMileage(e data.Expense) (bool, bool) {
+    if !strings.EqualFold(e.Category, "Transporte") { return false, false }
+    d := strings.ToLower(e.Description)
+    if !strings.Contains(d, "quilometragem") && !strings.Contains(d, "km rodado") { return false, false }
+    return true, strings.Contains(d, "ida e volta")
+}
+
+func (p *Policy) grade(rule string, amount, limit float64, detail string) (Violation, bool) {
+    if limit <= 0 { return Violation{}, false }
+    r := amount / limit
+    if r <= p.Tolerance { return Violation{}, false }
+    lvl := Leve
+    if r > p.GraveRatio {
+        lvl = Grave
+    } else if r > p.ModerateRatio {
+        lvl = Moderado
+    }
+    return Violation{Rule: rule, Severity: severityNames[lvl], Level: lvl, Amount: amount, Limit: limit, Ratio: r, Detail: detail}, true
+}
+
+func city(e data.Expense) string {
+    if e.Destination != "" { return e.Destination }
+    return e.Origin
+}
+
+// limit devolve a regra e o teto aplicáveis à despesa (teto zero quando
+// nenhuma regra se aplica). unknownRoute indica quilometragem sem trecho na
+// tabela.
+func (p *Policy) limit(e data.Expense) (rule string, limit float64, detail string, unknownRoute bool) {
+    if ok, round := IsMileage(e); ok {
+        km, known := p.Distance(e.Origin, e.Destination)
+        if !known { return "", 0, "", true }
+        if round { km *= 2 }
+        return "quilometragem", km * p.MileageRate, fmt.Sprintf("%s–%s, %.0f km × %.2f", e.Origin, e.Destination, km, p.MileageRate), false
+    }
+    c := city(e)
+    if c == "" { return "", 0, "", false }
+    a := p.Allowance(c, e.JobTitle)
+    detail = fmt.Sprintf("%s, faixa %d, %s", c, p.Tier(c), e.JobTitle)
+    switch strings.ToLower(e.Category) {
+    case "alimentação":
+        return "diária de refeição", a.Meals, detail, false
+    case "hospedagem":
+        return "diária de hospedagem", a.Lodging, detail, false
+    }
+    return "", 0, "", false
+}
+
+func perDiem(e data.Expense) bool {
+    c := strings.ToLower(e.Category)
+    return c == "alimentação" || c == "hospedagem"
+}
+
+func dayKey(e data.Expense) (string, int32) {
+    day := int32(e.TravelDate.Unix() / 86400)
+    return e.RequesterID + "|" + strconv.Itoa(int(day)) + "|" + CityKey(city(e)) + "|" + strings.ToLower(e.Category), day
+}
+
+// Observe registra refeições e hospedagem para somar na diária dos itens
+// seguintes do mesmo dia; expense_id repetido é ignorado.
+func (p *Policy) Observe(e data.Expense) {
+    if !perDiem(e) || city(e) == "" { return }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.Days == nil { p.Days = map[string][]DayItem{} }
+    k, day := dayKey(e)
+    items := p.Days[k]
+    if e.ExpenseID != "" {
+        for _, it := range items { if it.ExpenseID == e.ExpenseID { return } }
+    }
+    p.Days[k] = append(items, DayItem{Seq: p.NextSeq, Day: day, ExpenseID: e.ExpenseID, Amount: e.Amount})
+    p.NextSeq++
+}
+
+// Compact descarta os dias mais de days dias antes do mais recente.
+func (p *Policy) Compact(days int) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    var maxDay int32
+    for _, its := range p.Days { if len(its) > 0 && its[0].Day > maxDay { maxDay = its[0].Day } }
+    for k, its := range p.Days {
+        if len(its) == 0 || its[0].Day < maxDay-int32(days) { delete(p.Days, k) }
+    }
+}
+
+// dayTotal soma a despesa aos itens anteriores do mesmo dia (pela ordem de
+// ingestão, como no fracionamento) e devolve também a quantidade de itens.
+func (p *Policy) dayTotal(e data.Expense) (float64, int) {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    k, _ := dayKey(e)
+    items := p.Days[k]
+    cutoff := int64(math.MaxInt64)
+    for _, it := range items { if e.ExpenseID != "" && it.ExpenseID == e.ExpenseID { cutoff = it.Seq; break } }
+    sum, n := e.Amount, 1
+    for _, it := range items {
+        if it.Seq >= cutoff { continue }
+        sum += it.Amount
+        n++
+    }
+    return sum, n
+}
+
+// amount é o valor comparado ao teto: a soma do dia para diárias, o próprio
+// valor para quilometragem.
+func (p *Policy) amount(e data.Expense, rule string) (float64, int) {
+    if rule == "" || !perDiem(e) { return e.Amount, 1 }
+    return p.dayTotal(e)
+}
+
+// Check valida quilometragem contra taxa × distância e refeições/hospedagem
+// (somadas por solicitante, dia e cidade) contra a diária da cidade e do
+// cargo. Trecho sem distância na tabela não é violação; o segundo retorno
+// indica que não deu para conferir.
+func (p *Policy) Check(e data.Expense) ([]Violation, bool) {
+    if p == nil { return nil, false }
+    rule, lim, detail, unknown := p.limit(e)
+    amt, n := p.amount(e, rule)
+    if n > 1 { detail += fmt.Sprintf(", %d itens no dia", n) }
+    if v, bad := p.grade(rule, amt, lim, detail); bad { return []Violation{v}, unknown }
+    return nil, unknown
+}
+
+func Flags(vs []Violation, unknownRoute bool) []string {
+    var flags []string
+    for _, v := range vs {
+        flags = append(flags, fmt.Sprintf("política (%s): %s %.2f acima do teto %.2f (%s)", v.Severity, v.Rule, v.Amount, v.Limit, v.Detail))
+    }
+    if unknownRoute { flags = append(flags, "quilometragem sem trecho na tabela de distâncias") }
+    return flags
+}
+
+// MaxLevel é o maior grau entre as violações (0 se nenhuma).
+func MaxLevel(vs []Violation) int {
+    lvl := 0
+    for _, v := range vs { lvl = max(lvl, v.Level) }
+    return lvl
+}
+
+func (p *Policy) Names() []string {
+    return []string{"PolRazaoTeto", "PolSeveridade", "PolQuilometragem", "PolDistanciaKm", "PolTrechoDesconhecido", "PolFaixaCidade"}
+}
+
+func (p *Policy) Transform(e data.Expense) []float64 {
+    b := func(v bool) float64 { if v { return 1 }; return 0 }
+    vs, unknown := p.Check(e)
+    rule, lim, _, _ := p.limit(e)
+    ratio := 0.0
+    if lim > 0 { amt, _ := p.amount(e, rule); ratio = amt / lim }
+    mileage, _ := IsMileage(e)
+    km, _ := p.Distance(e.Origin, e.Destination)
+    tier := 0.0
+    if city(e) != "" { tier = float64(p.Tier(city(e))) }
+    return []float64{ratio, float64(MaxLevel(vs)), b(mileage), km, b(unknown), tier}
+}
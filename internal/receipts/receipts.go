@@ -0,0 +1,205 @@
+package receipts
+
+import (
+    "bytes"
+    "encoding/gob"
+    "errors"
+    "fmt"
+    "image"
+    "image/color"
+    _ "image/gif"
+    _ "image/jpeg"
+    _ "image/png"
+    "io"
+    "math/bits"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+
+    _ "golang.org/x/image/bmp"
+    "golang.org/x/image/draw"
+    _ "golang.org/x/image/tiff"
+    _ "golang.org/x/image/webp"
+)
+
+// MaxBytes limita o tamanho de uma imagem de recibo aceita pela API e
+// MaxPixels as dimensões declaradas: um PNG pequeno pode anunciar uma imagem
+// enorme e esgotar a memória ao decodificar.
+const (
+    MaxBytes  = 10 << 20
+    MaxPixels = 25_000_000
+)
+
+// Hash guarda o aHash (média) e o dHash (gradiente horizontal), 64 bits cada.
+type Hash struct {
+    A uint64 `json:"ahash"`
+    D uint64 `json:"dhash"`
+}
+
+func (h Hash) String() string { return fmt.Sprintf("%016x%016x", h.A, h.D) }
+
+// Distance soma as distâncias de Hamming dos dois hashes (0 a 128).
+func (h Hash) Distance(o Hash) int {
+    return bits.OnesCount64(h.A^o.A) + bits.OnesCount64(h.D^o.D)
+}
+
+func gray(img image.Image, w, hgt int) [][]float64 {
+    dst := image.NewGray(image.Rect(0, 0, w, hgt))
+    draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+    px := make([][]float64, hgt)
+    for y := 0; y < hgt; y++ {
+        px[y] = make([]float64, w)
+        for x := 0; x < w; x++ { px[y][x] = float64(color.GrayModel.Convert(dst.At(x, y)).(color.Gray).Y) }
+    }
+    return px
+}
+
+// Compute reduz a imagem a tons de cinza em 8x8 (aHash) e 9x8 (dHash), o que
+// torna o hash estável a recompressão, redimensionamento e pequenos ajustes.
+func Compute(img image.Image) Hash {
+    var h Hash
+    a := gray(img, 8, 8)
+    mean := 0.0
+    for _, row := range a { for _, v := range row { mean += v } }
+    mean /= 64
+    bit := uint(0)
+    for _, row := range a {
+        for _, v := range row {
+            if v > mean { h.A |= 1 << bit }
+            bit++
+        }
+    }
+    d := gray(img, 9, 8)
+    bit = 0
+    for _, row := range d {
+        for x := 0; x < 8; x++ {
+            if row[x] > row[x+1] { h.D |= 1 << bit }
+            bit++
+        }
+    }
+    return h
+}
+
+// Decode lê jpeg, png, gif, bmp, tiff ou webp até MaxBytes; o cabeçalho é
+// conferido contra MaxPixels antes de decodificar a imagem.
+func Decode(r io.Reader) (Hash, string, error) {
+    raw, err := io.ReadAll(io.LimitReader(r, MaxBytes))
+    if err != nil { return Hash{}, "", fmt.Errorf("imagem de recibo inválida: %w", err) }
+    cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+    if err != nil { return Hash{}, "", fmt.Errorf("imagem de recibo inválida: %w", err) }
+    if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+        return Hash{}, "", fmt.Errorf("imagem de recibo com %dx%d pixels (máximo %d)", cfg.Width, cfg.Height, MaxPixels)
+    }
+    img, format, err := image.Decode(bytes.NewReader(raw))
+    if err != nil { return Hash{}, "", fmt.Errorf("imagem de recibo inválida: %w", err) }
+    return Compute(img), format, nil
+}
+
+type Entry struct {
+    ExpenseID  string
+    EmployeeID string
+    Hash       Hash
+    Added      time.Time
+}
+
+type Match struct {
+    ExpenseID    string `json:"expense_id"`
+    EmployeeID   string `json:"employee_id"`
+    Distance     int    `json:"distance"`
+    SameEmployee bool   `json:"same_employee"`
+}
+
+// Index é o índice local de recibos por despesa, persistido em gob como o
+// feature store. Threshold é a distância máxima (aHash + dHash) para colisão.
+type Index struct {
+    Entries   []Entry
+    Threshold int
+    path      string
+    dirty     bool
+    mu        sync.RWMutex
+}
+
+func New(path string) *Index { return &Index{Threshold: 10, path: path} }
+
+func Open(path string) (*Index, error) {
+    ix := New(path)
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) { return ix, nil }
+    if err != nil { return nil, err }
+    defer f.Close()
+    if err := gob.NewDecoder(f).Decode(ix); err != nil { return nil, fmt.Errorf("índice de recibos corrompido: %w", err) }
+    ix.path = path
+    return ix, nil
+}
+
+func (ix *Index) Save() error {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    if ix.path == "" { return errors.New("índice de recibos sem caminho") }
+    if err := os.MkdirAll(filepath.Dir(ix.path), 0o755); err != nil { return err }
+    tmp := ix.path + ".tmp"
+    f, err := os.Create(tmp)
+    if err != nil { return err }
+    if err := gob.NewEncoder(f).Encode(ix); err != nil { f.Close(); return err }
+    if err := f.Close(); err != nil { return err }
+    ix.dirty = false
+    return os.Rename(tmp, ix.path)
+}
+
+func (ix *Index) Dirty() bool {
+    ix.mu.RLock()
+    defer ix.mu.RUnlock()
+    return ix.dirty
+}
+
+// Matches devolve recibos de outras despesas dentro do limiar, do mais
+// parecido para o menos. Reenviar o recibo da mesma despesa não conta.
+func (ix *Index) Matches(expenseID, employeeID string, h Hash) []Match {
+    ix.mu.RLock()
+    defer ix.mu.RUnlock()
+    return ix.matches(expenseID, employeeID, h)
+}
+
+func (ix *Index) matches(expenseID, employeeID string, h Hash) []Match {
+    var out []Match
+    seen := map[string]bool{}
+    for _, en := range ix.Entries {
+        if en.ExpenseID == expenseID || seen[en.ExpenseID] { continue }
+        if d := h.Distance(en.Hash); d <= ix.Threshold {
+            seen[en.ExpenseID] = true
+            out = append(out, Match{ExpenseID: en.ExpenseID, EmployeeID: en.EmployeeID, Distance: d, SameEmployee: en.EmployeeID == employeeID})
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Distance != out[j].Distance { return out[i].Distance < out[j].Distance }
+        return out[i].ExpenseID < out[j].ExpenseID
+    })
+    return out
+}
+
+// Add registra o recibo da despesa; o mesmo hash repetido na mesma despesa é
+// ignorado.
+func (ix *Index) Add(expenseID, employeeID string, h Hash) bool {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    return ix.add(expenseID, employeeID, h)
+}
+
+func (ix *Index) add(expenseID, employeeID string, h Hash) bool {
+    for _, en := range ix.Entries { if en.ExpenseID == expenseID && en.Hash == h { return false } }
+    ix.Entries = append(ix.Entries, Entry{ExpenseID: expenseID, EmployeeID: employeeID, Hash: h, Added: time.Now()})
+    ix.dirty = true
+    return true
+}
+
+// Check compara e registra sob a mesma trava, como no upload de recibo: dois envios
+// simultâneos da mesma imagem não passam ambos como inéditos.
+func (ix *Index) Check(expenseID, employeeID string, h Hash) []Match {
+    ix.mu.Lock()
+    defer ix.mu.Unlock()
+    ms := ix.matches(expenseID, employeeID, h)
+    ix.add(expenseID, employeeID, h)
+    return ms
+}
@@ -0,0 +1,69 @@
+package receipts
+
+import (
+    "image"
+    "image/color"
+    "testing"
+)
+
+// flip inverte os n primeiros bits do hash, metade em cada componente.
+func flip(h Hash, n int) Hash {
+    for i := 0; i < n; i++ {
+        if i%2 == 0 { h.A ^= 1 << uint(i/2) } else { h.D ^= 1 << uint(i/2) }
+    }
+    return h
+}
+
+func TestThreshold(t *testing.T) {
+    base := Hash{A: 0xf0f0f0f0f0f0f0f0, D: 0x0123456789abcdef}
+    ix := New("")
+    ix.Add("e1", "u1", base)
+    for _, tc := range []struct {
+        name  string
+        bits  int
+        match bool
+    }{
+        {"idêntico", 0, true},
+        {"no limiar", 10, true},
+        {"acima do limiar", 11, false},
+        {"muito diferente", 64, false},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            h := flip(base, tc.bits)
+            if d := base.Distance(h); d != tc.bits { t.Fatalf("Distance = %d, esperado %d", d, tc.bits) }
+            ms := ix.Matches("e2", "u2", h)
+            if (len(ms) == 1) != tc.match { t.Fatalf("Matches com %d bits = %+v", tc.bits, ms) }
+        })
+    }
+}
+
+func TestCheckDedup(t *testing.T) {
+    h := Hash{A: 42, D: 7}
+    ix := New("")
+    if ms := ix.Check("e1", "u1", h); len(ms) != 0 { t.Fatalf("primeiro envio casou com %+v", ms) }
+    if ms := ix.Check("e1", "u1", h); len(ms) != 0 { t.Fatalf("reenvio da mesma despesa casou com %+v", ms) }
+    if len(ix.Entries) != 1 { t.Fatalf("reenvio gravou %d entradas", len(ix.Entries)) }
+    // a mesma despesa com duas imagens parecidas aparece uma vez só
+    ix.Check("e1", "u1", flip(h, 2))
+    ms := ix.Check("e2", "u1", flip(h, 1))
+    if len(ms) != 1 || ms[0].ExpenseID != "e1" || !ms[0].SameEmployee || ms[0].Distance != 1 { t.Fatalf("Check(e2) = %+v", ms) }
+    ms = ix.Check("e3", "u9", h)
+    if len(ms) != 2 || ms[0].ExpenseID != "e1" || ms[1].ExpenseID != "e2" || ms[0].SameEmployee { t.Fatalf("Check(e3) = %+v", ms) }
+    if !ix.Dirty() { t.Error("índice alterado sem marcar dirty") }
+}
+
+func TestComputeStableUnderResize(t *testing.T) {
+    render := func(w, h int) image.Image {
+        img := image.NewGray(image.Rect(0, 0, w, h))
+        for y := 0; y < h; y++ {
+            for x := 0; x < w; x++ {
+                v := uint8(255 * x / w)
+                if y*4/h == 1 { v = 255 - v }
+                img.SetGray(x, y, color.Gray{Y: v})
+            }
+        }
+        return img
+    }
+    a, b := Compute(render(160, 240)), Compute(render(480, 720))
+    if d := a.Distance(b); d > New("").Threshold { t.Errorf("mesmo recibo em outra resolução a distância %d", d) }
+}